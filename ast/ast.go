@@ -0,0 +1,152 @@
+// Package ast converts Gemini text to JSON and back, for tools that are not
+// written in Go.  Text can be converted to a stream of lines in the JSON
+// Lines format, with a JSON object for each line:
+//
+//     {"num":1,"type":"Head1","text":"Title","offset":0}
+//     {"num":2,"type":"Link","text":"Blog","url":"/blog/","offset":8}
+//
+// Text can also be converted to a Document of blocks, where consecutive list
+// items, quote lines and preformatted lines are grouped, with the title and
+// table of contents of the text.  Both can be decoded back to lines and
+// written as Gemini text with a gmitxt.Writer.
+package ast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Line is a line of Gemini text in JSON.
+type Line struct {
+	// Num is the line number of the line.
+	Num uint32 `json:"num"`
+	// Type is the type of the line, such as "Head1" or "Link".
+	Type gmitxt.LineType `json:"type"`
+	// Text is the text of the line.
+	Text string `json:"text"`
+	// URL is the URL of a link line.
+	URL string `json:"url,omitempty"`
+	// Offset is the byte offset of the start of the line in the text.
+	Offset int64 `json:"offset"`
+}
+
+// NewLine returns the JSON line of the line of Gemini text.
+func NewLine(line gmitxt.Line) Line {
+	return Line{
+		Num:    line.Num,
+		Type:   line.Type,
+		Text:   string(line.Text),
+		URL:    string(line.URL),
+		Offset: line.Offset,
+	}
+}
+
+// Line returns the line of Gemini text of the JSON line.
+func (l Line) Line() gmitxt.Line {
+	line := gmitxt.Line{
+		Num:    l.Num,
+		Type:   l.Type,
+		Text:   []byte(l.Text),
+		Offset: l.Offset,
+	}
+
+	if l.URL != "" {
+		line.URL = []byte(l.URL)
+	}
+
+	return line
+}
+
+// EncodeLines reads Gemini text from src and writes its lines to dst as JSON
+// Lines.
+func EncodeLines(dst io.Writer, src io.Reader) error {
+	return EncodeLinesContext(context.Background(), dst, src)
+}
+
+// EncodeLinesContext is like EncodeLines, but stops reading when the context
+// is done, and returns the error of the context.
+func EncodeLinesContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+) error {
+	s := gmitxt.NewScanner(src)
+	enc := json.NewEncoder(dst)
+	enc.SetEscapeHTML(false)
+
+	for s.ScanContext(ctx) {
+		if err := enc.Encode(NewLine(s.Line())); err != nil {
+			return fmt.Errorf("problem writing JSON: %w", err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	return nil
+}
+
+// LineDecoder decodes lines of Gemini text from JSON Lines.
+type LineDecoder struct {
+	dec *json.Decoder
+	num int // number of lines decoded
+}
+
+// NewLineDecoder returns a LineDecoder that reads JSON Lines from r.
+func NewLineDecoder(r io.Reader) *LineDecoder {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	return &LineDecoder{dec: dec}
+}
+
+// Decode decodes the next line.  It returns io.EOF when there are no more
+// lines.  A line with no type is a text line.
+func (d *LineDecoder) Decode() (gmitxt.Line, error) {
+	l := Line{Type: gmitxt.Text}
+
+	if err := d.dec.Decode(&l); err != nil {
+		if errors.Is(err, io.EOF) {
+			return gmitxt.Line{}, io.EOF
+		}
+
+		return gmitxt.Line{}, fmt.Errorf("problem decoding line %d: %w",
+			d.num+1, err)
+	}
+
+	d.num++
+
+	return l.Line(), nil
+}
+
+// DecodeLines reads JSON Lines from src and writes the lines to dst as Gemini
+// text.
+func DecodeLines(dst io.Writer, src io.Reader) error {
+	d := NewLineDecoder(src)
+	w := gmitxt.NewWriter(dst)
+
+	for {
+		line, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		w.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
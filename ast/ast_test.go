@@ -0,0 +1,126 @@
+package ast_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/ast"
+)
+
+var errTest = errors.New("test error")
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errTest }
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errTest }
+
+func TestEncodeLines(t *testing.T) {
+	text := "# A <title>\n=> /about About\nSome text\n"
+	expected := "" +
+		`{"num":1,"type":"Head1","text":"A <title>","offset":0}` + "\n" +
+		`{"num":2,"type":"Link","text":"About","url":"/about","offset":12}` +
+		"\n" +
+		`{"num":3,"type":"Text","text":"Some text","offset":28}` + "\n"
+
+	var buf bytes.Buffer
+	if err := ast.EncodeLines(&buf, strings.NewReader(text)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected JSON lines:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	if err := ast.EncodeLines(&buf, errReader{}); !errors.Is(err, errTest) {
+		t.Errorf("Expected reading error, got: %v", err)
+	}
+
+	err := ast.EncodeLines(errWriter{}, strings.NewReader(text))
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected writing error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ast.EncodeLinesContext(ctx, &buf, strings.NewReader(text))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+func TestLineDecoder(t *testing.T) {
+	d := ast.NewLineDecoder(strings.NewReader(
+		`{"num":1,"type":"Link","text":"About","url":"/about","offset":0}` +
+			"\n" + `{"text":"plain"}` + "\n"))
+
+	line, err := d.Decode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if line.Type != gmitxt.Link || string(line.URL) != "/about" ||
+		string(line.Text) != "About" || line.Num != 1 {
+		t.Errorf("Expected link line, got: %+v", line)
+	}
+
+	line, err = d.Decode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if line.Type != gmitxt.Text || string(line.Text) != "plain" ||
+		line.URL != nil {
+		t.Errorf("Expected text line, got: %+v", line)
+	}
+
+	if _, err := d.Decode(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF, got: %v", err)
+	}
+
+	for _, src := range []string{
+		`{"type":"Head4"}`,
+		`{"text":"x","extra":true}`,
+		`{`,
+	} {
+		d := ast.NewLineDecoder(strings.NewReader(src))
+		if _, err := d.Decode(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("Expected error for %s, got: %v", src, err)
+		}
+	}
+}
+
+func TestDecodeLines(t *testing.T) {
+	text := "# Title\n\n=> /about About\n* item\n> quote\n```alt\n  x\n```\n"
+
+	var src, dst bytes.Buffer
+	if err := ast.EncodeLines(&src, strings.NewReader(text)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := ast.DecodeLines(&dst, &src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if dst.String() != text {
+		t.Errorf("Expected round trip:\n%s\ngot:\n%s", text, dst.String())
+	}
+
+	err := ast.DecodeLines(&dst, strings.NewReader(`{"type":1}`))
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected decoding error, got: %v", err)
+	}
+
+	err = ast.DecodeLines(errWriter{}, strings.NewReader(`{"text":"x"}`))
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected writing error, got: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package ast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Types of blocks.
+const (
+	BlockHeading = "heading"
+	BlockText    = "text"
+	BlockLink    = "link"
+	BlockList    = "list"
+	BlockQuote   = "quote"
+	BlockPre     = "pre"
+)
+
+// ErrInvalidBlock is returned when a block of a Document has an unknown type,
+// or a heading has a level other than 1, 2 or 3.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// Document is Gemini text as blocks, with its title and table of contents.
+type Document struct {
+	// Title is the text of the first level 1 heading.
+	Title string `json:"title,omitempty"`
+	// TOC is the table of contents, with the headings of the text in order.
+	TOC []Heading `json:"toc"`
+	// Blocks are the blocks of the text.
+	Blocks []Block `json:"blocks"`
+}
+
+// Heading is an entry of the table of contents of a Document.
+type Heading struct {
+	// Level is the level of the heading, from 1 to 3.
+	Level int `json:"level"`
+	// Text is the text of the heading.
+	Text string `json:"text"`
+	// Line is the line number of the heading.
+	Line uint32 `json:"line"`
+}
+
+// Block is a block of Gemini text, which is a heading, text or link line, or
+// consecutive list items, quote lines or preformatted lines.
+type Block struct {
+	// Type is the type of the block, such as BlockHeading.
+	Type string `json:"type"`
+	// Line is the line number of the first line of the block.
+	Line uint32 `json:"line,omitempty"`
+	// Level is the level of a heading, from 1 to 3.
+	Level int `json:"level,omitempty"`
+	// Text is the text of a heading, text or link, or the alt text of
+	// preformatted text.
+	Text string `json:"text,omitempty"`
+	// URL is the URL of a link.
+	URL string `json:"url,omitempty"`
+	// Lines are the list items, quote lines or preformatted lines of the
+	// block.
+	Lines []string `json:"lines,omitempty"`
+}
+
+// Parse reads Gemini text from r and returns it as a Document.
+func Parse(r io.Reader) (*Document, error) {
+	return ParseContext(context.Background(), r)
+}
+
+// ParseContext is like Parse, but stops reading when the context is done, and
+// returns the error of the context.
+func ParseContext(ctx context.Context, r io.Reader) (*Document, error) {
+	s := gmitxt.NewScanner(r)
+	doc := &Document{TOC: []Heading{}, Blocks: []Block{}}
+
+	for s.ScanContext(ctx) {
+		doc.add(s.Line())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	return doc, nil
+}
+
+// add adds the line to the blocks of the document.
+func (d *Document) add(line gmitxt.Line) {
+	text := string(line.Text)
+	b := Block{Line: line.Num, Text: text}
+
+	switch line.Type {
+	case gmitxt.Head1, gmitxt.Head2, gmitxt.Head3:
+		b.Type, b.Level = BlockHeading, int(line.Type-gmitxt.Head1)+1
+		d.TOC = append(d.TOC, Heading{b.Level, text, line.Num})
+
+		if d.Title == "" && line.Type == gmitxt.Head1 {
+			d.Title = text
+		}
+	case gmitxt.Text:
+		b.Type = BlockText
+	case gmitxt.Link:
+		b.Type, b.URL = BlockLink, string(line.URL)
+	case gmitxt.List:
+		d.group(BlockList, line.Num, text)
+
+		return
+	case gmitxt.Quote:
+		d.group(BlockQuote, line.Num, text)
+
+		return
+	case gmitxt.PreStart:
+		b.Type = BlockPre
+	case gmitxt.PreBody:
+		last := &d.Blocks[len(d.Blocks)-1]
+		last.Lines = append(last.Lines, text)
+
+		return
+	case gmitxt.PreEnd:
+		return
+	}
+
+	d.Blocks = append(d.Blocks, b)
+}
+
+// group adds the text to the last block if it has the type, or to a new block
+// of the type otherwise.
+func (d *Document) group(typ string, num uint32, text string) {
+	if n := len(d.Blocks); n != 0 && d.Blocks[n-1].Type == typ {
+		d.Blocks[n-1].Lines = append(d.Blocks[n-1].Lines, text)
+
+		return
+	}
+
+	d.Blocks = append(d.Blocks, Block{
+		Type: typ, Line: num, Lines: []string{text},
+	})
+}
+
+// Lines returns the blocks of the document as lines of Gemini text.  The lines
+// are numbered in order, and their offsets are 0.  Preformatted text is always
+// closed.  It returns ErrInvalidBlock for a block of an unknown type.
+func (d *Document) Lines() ([]gmitxt.Line, error) {
+	var lines []gmitxt.Line
+
+	add := func(typ gmitxt.LineType, text, url string) {
+		line := gmitxt.Line{
+			Num:  uint32(len(lines) + 1),
+			Type: typ,
+			Text: []byte(text),
+		}
+
+		if url != "" {
+			line.URL = []byte(url)
+		}
+
+		lines = append(lines, line)
+	}
+
+	for i, b := range d.Blocks {
+		switch b.Type {
+		case BlockHeading:
+			if b.Level < 1 || b.Level > 3 {
+				return nil, fmt.Errorf("%w: block %d: heading level %d",
+					ErrInvalidBlock, i+1, b.Level)
+			}
+
+			add(gmitxt.Head1+gmitxt.LineType(b.Level-1), b.Text, "")
+		case BlockText:
+			add(gmitxt.Text, b.Text, "")
+		case BlockLink:
+			add(gmitxt.Link, b.Text, b.URL)
+		case BlockList, BlockQuote:
+			typ := gmitxt.List
+			if b.Type == BlockQuote {
+				typ = gmitxt.Quote
+			}
+
+			for _, text := range b.Lines {
+				add(typ, text, "")
+			}
+		case BlockPre:
+			add(gmitxt.PreStart, b.Text, "")
+
+			for _, text := range b.Lines {
+				add(gmitxt.PreBody, text, "")
+			}
+
+			add(gmitxt.PreEnd, "", "")
+		default:
+			return nil, fmt.Errorf("%w: block %d: type %q",
+				ErrInvalidBlock, i+1, b.Type)
+		}
+	}
+
+	return lines, nil
+}
+
+// EncodeDocument reads Gemini text from src and writes it to dst as a JSON
+// Document.
+func EncodeDocument(dst io.Writer, src io.Reader) error {
+	return EncodeDocumentContext(context.Background(), dst, src)
+}
+
+// EncodeDocumentContext is like EncodeDocument, but stops reading when the
+// context is done, and returns the error of the context.
+func EncodeDocumentContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+) error {
+	doc, err := ParseContext(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(dst)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("problem writing JSON: %w", err)
+	}
+
+	return nil
+}
+
+// DecodeDocument reads a JSON Document from src and writes it to dst as
+// Gemini text.
+func DecodeDocument(dst io.Writer, src io.Reader) error {
+	var doc Document
+
+	dec := json.NewDecoder(src)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("problem decoding document: %w", err)
+	}
+
+	lines, err := doc.Lines()
+	if err != nil {
+		return err
+	}
+
+	w := gmitxt.NewWriter(dst)
+
+	for _, line := range lines {
+		w.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
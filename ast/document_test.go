@@ -0,0 +1,170 @@
+package ast_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/ast"
+)
+
+func TestParse(t *testing.T) {
+	text := "## Intro\n" +
+		"# Title\n" +
+		"Some text\n" +
+		"* one\n" +
+		"* two\n" +
+		"> a\n" +
+		"> b\n" +
+		"=> /about About\n" +
+		"```go\n" +
+		"x := 1\n" +
+		"\n" +
+		"```\n" +
+		"### End\n" +
+		"```\n"
+
+	expected := &ast.Document{
+		Title: "Title",
+		TOC: []ast.Heading{
+			{Level: 2, Text: "Intro", Line: 1},
+			{Level: 1, Text: "Title", Line: 2},
+			{Level: 3, Text: "End", Line: 13},
+		},
+		Blocks: []ast.Block{
+			{Type: ast.BlockHeading, Line: 1, Level: 2, Text: "Intro"},
+			{Type: ast.BlockHeading, Line: 2, Level: 1, Text: "Title"},
+			{Type: ast.BlockText, Line: 3, Text: "Some text"},
+			{Type: ast.BlockList, Line: 4, Lines: []string{"one", "two"}},
+			{Type: ast.BlockQuote, Line: 6, Lines: []string{" a", " b"}},
+			{Type: ast.BlockLink, Line: 8, Text: "About", URL: "/about"},
+			{Type: ast.BlockPre, Line: 9, Text: "go",
+				Lines: []string{"x := 1", ""}},
+			{Type: ast.BlockHeading, Line: 13, Level: 3, Text: "End"},
+			{Type: ast.BlockPre, Line: 14},
+		},
+	}
+
+	doc, err := ast.Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected document:\n%+v\ngot:\n%+v", expected, doc)
+	}
+
+	if _, err := ast.Parse(errReader{}); !errors.Is(err, errTest) {
+		t.Errorf("Expected reading error, got: %v", err)
+	}
+}
+
+func TestDocumentJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := ast.EncodeDocument(&buf, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "{\n  \"toc\": [],\n  \"blocks\": []\n}\n"; buf.String() !=
+		expected {
+		t.Errorf("Expected empty document:\n%s\ngot:\n%s", expected,
+			buf.String())
+	}
+
+	if err := ast.EncodeDocument(&buf, errReader{}); !errors.Is(err,
+		errTest) {
+		t.Errorf("Expected reading error, got: %v", err)
+	}
+
+	err = ast.EncodeDocument(errWriter{}, strings.NewReader("# x\n"))
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected writing error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ast.EncodeDocumentContext(ctx, &buf, strings.NewReader("# x\n"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+func TestDecodeDocument(t *testing.T) {
+	text := "# Title\n" +
+		"\n" +
+		"=> /about About\n" +
+		"* one\n" +
+		"* two\n" +
+		"> quote\n" +
+		"```alt\n" +
+		"  x\n" +
+		"```\n" +
+		"### End\n"
+
+	var src, dst bytes.Buffer
+	if err := ast.EncodeDocument(&src, strings.NewReader(text)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := ast.DecodeDocument(&dst, &src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if dst.String() != text {
+		t.Errorf("Expected round trip:\n%s\ngot:\n%s", text, dst.String())
+	}
+
+	t.Log("checking edited documents")
+
+	doc := ast.Document{Blocks: []ast.Block{
+		{Type: ast.BlockHeading, Level: 2, Text: "Added"},
+		{Type: ast.BlockPre},
+	}}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dst.Reset()
+
+	if err := ast.DecodeDocument(&dst, bytes.NewReader(data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "## Added\n```\n```\n"; dst.String() != expected {
+		t.Errorf("Expected text:\n%s\ngot:\n%s", expected, dst.String())
+	}
+
+	t.Log("checking with errors")
+
+	for _, src := range []string{
+		`{"blocks":[{"type":"heading","level":4}]}`,
+		`{"blocks":[{"type":"table"}]}`,
+	} {
+		err := ast.DecodeDocument(&dst, strings.NewReader(src))
+		if !errors.Is(err, ast.ErrInvalidBlock) {
+			t.Errorf("Expected ErrInvalidBlock for %s, got: %v", src, err)
+		}
+	}
+
+	for _, src := range []string{`{"extra":1}`, `[`} {
+		err := ast.DecodeDocument(&dst, strings.NewReader(src))
+		if err == nil || !strings.Contains(err.Error(), "decoding") {
+			t.Errorf("Expected decoding error for %s, got: %v", src, err)
+		}
+	}
+
+	err = ast.DecodeDocument(errWriter{},
+		strings.NewReader(`{"blocks":[{"type":"text"}]}`))
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected writing error, got: %v", err)
+	}
+}
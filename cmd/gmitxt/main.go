@@ -0,0 +1,19 @@
+// Command gmitxt is a command-line tool for working with Gemini text.
+//
+// Usage:
+//
+//     gmitxt <command> [arguments]
+//
+// Run "gmitxt help" for the list of commands, and "gmitxt <command> -h" for
+// more information about a command.
+package main
+
+import (
+	"os"
+
+	"git.sr.ht/~kiba/gmitxt/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,94 @@
+package gmitxt
+
+import "strconv"
+
+// Diagnostic describes a line of Gemini text that does not strictly conform to
+// the text/gemini specification, or that clients may render differently.
+// Diagnostics are reported by a Scanner in strict mode.
+type Diagnostic struct {
+	// Num is the line number the diagnostic was reported for.
+	Num uint32
+	// Col is the column of the byte in the line the diagnostic was reported
+	// for, starting at 1.  It is the byte offset in the line plus one.  Col is
+	// 0 when the diagnostic is for the whole line.
+	Col int
+	// Code identifies the kind of problem that was found.
+	Code DiagnosticCode
+	// Message is a human readable description of the problem.
+	Message string
+}
+
+// String returns the line number, column and message of the diagnostic.  For
+// example, "line 36: text after a closing ``` is ignored" or "line 3 col 5:
+// invalid UTF-8 sequence".
+func (d Diagnostic) String() string {
+	if d.Col == 0 {
+		return "line " + strconv.FormatUint(uint64(d.Num), 10) + ": " +
+			d.Message
+	}
+
+	return "line " + strconv.FormatUint(uint64(d.Num), 10) +
+		" col " + strconv.Itoa(d.Col) + ": " + d.Message
+}
+
+// DiagnosticCode identifies the kind of problem reported by a Diagnostic.
+type DiagnosticCode uint8
+
+const (
+	// DiagListNoSpace is reported for a Text line that starts with * but is
+	// not followed by a space.  The specification treats it as text, but some
+	// clients render it as a list item.
+	DiagListNoSpace DiagnosticCode = iota + 1
+	// DiagPreEndText is reported for a PreEnd line with text after the ```.
+	// The specification requires clients to ignore this text.
+	DiagPreEndText
+	// DiagPreUnclosed is reported when the text ends inside preformatted text
+	// without a PreEnd line.  It is reported for the PreStart line that
+	// started the preformatted text.
+	DiagPreUnclosed
+	// DiagLinkNoURL is reported for a Link line that has no URL.
+	DiagLinkNoURL
+	// DiagHeadingTooDeep is reported for a heading line that starts with more
+	// than three #.  It is scanned as Head3 with the extra # in its text.
+	DiagHeadingTooDeep
+	// DiagBareCR is reported for a line that contains a carriage return that
+	// is not part of a CRLF line ending.  The specification does not allow a
+	// plain CR as a line break.
+	DiagBareCR
+	// DiagInvalidUTF8 is reported for each invalid UTF-8 sequence in a line
+	// when UTF-8 validation is enabled.
+	DiagInvalidUTF8
+)
+
+// String returns the string representation of the diagnostic code.  For
+// example, for DiagPreEndText it will return the string "DiagPreEndText".
+func (code DiagnosticCode) String() string {
+	switch code {
+	case DiagListNoSpace:
+		return "DiagListNoSpace"
+	case DiagPreEndText:
+		return "DiagPreEndText"
+	case DiagPreUnclosed:
+		return "DiagPreUnclosed"
+	case DiagLinkNoURL:
+		return "DiagLinkNoURL"
+	case DiagHeadingTooDeep:
+		return "DiagHeadingTooDeep"
+	case DiagBareCR:
+		return "DiagBareCR"
+	case DiagInvalidUTF8:
+		return "DiagInvalidUTF8"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+const (
+	msgListNoSpace    = "* without a space is text, but may render as a list"
+	msgPreEndText     = "text after a closing ``` is ignored"
+	msgPreUnclosed    = "preformatted text is not closed with ```"
+	msgLinkNoURL      = "link has no URL"
+	msgHeadingTooDeep = "heading has more than three #"
+	msgBareCR         = "carriage return without a line feed"
+	msgInvalidUTF8    = "invalid UTF-8 sequence"
+)
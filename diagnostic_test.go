@@ -0,0 +1,52 @@
+package gmitxt_test
+
+import (
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+func TestDiagnosticString(t *testing.T) {
+	d := gmitxt.Diagnostic{
+		Num:     36,
+		Code:    gmitxt.DiagPreEndText,
+		Message: "text after a closing ``` is ignored",
+	}
+
+	expected := "line 36: text after a closing ``` is ignored"
+	if d.String() != expected {
+		t.Errorf("Expected `%s` for diagnostic, got: `%s`", expected, d)
+	}
+
+	d = gmitxt.Diagnostic{
+		Num:     3,
+		Col:     5,
+		Code:    gmitxt.DiagInvalidUTF8,
+		Message: "invalid UTF-8 sequence",
+	}
+
+	expected = "line 3 col 5: invalid UTF-8 sequence"
+	if d.String() != expected {
+		t.Errorf("Expected `%s` for diagnostic, got: `%s`", expected, d)
+	}
+}
+
+func TestDiagnosticCodeString(t *testing.T) {
+	codes := map[gmitxt.DiagnosticCode]string{
+		0:                         "UNKNOWN",
+		gmitxt.DiagListNoSpace:    "DiagListNoSpace",
+		gmitxt.DiagPreEndText:     "DiagPreEndText",
+		gmitxt.DiagPreUnclosed:    "DiagPreUnclosed",
+		gmitxt.DiagLinkNoURL:      "DiagLinkNoURL",
+		gmitxt.DiagHeadingTooDeep: "DiagHeadingTooDeep",
+		gmitxt.DiagBareCR:         "DiagBareCR",
+		gmitxt.DiagInvalidUTF8:    "DiagInvalidUTF8",
+	}
+
+	for code, expected := range codes {
+		if code.String() != expected {
+			t.Errorf("Expected `%s` for diagnostic code %d, got: `%s`",
+				expected, code, code)
+		}
+	}
+}
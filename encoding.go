@@ -0,0 +1,204 @@
+package gmitxt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedCharset is returned when text is in a charset that cannot be
+// decoded to UTF-8.
+var ErrUnsupportedCharset = errors.New("unsupported charset")
+
+// NewDecoder returns a reader that decodes text from r in the given charset to
+// UTF-8, so it can be read by a Scanner.  The charset names are not case
+// sensitive.  Only the charsets below are supported as they can be decoded
+// using the Go standard library alone:
+//
+//	utf-8, us-ascii               returns r as it is
+//	iso-8859-1, latin1            decodes Latin-1 text
+//	utf-16                        decodes UTF-16 text detected by its BOM,
+//	                              defaulting to big-endian
+//	utf-16be, utf-16le            decodes UTF-16 text with the byte order
+//	""                            decodes UTF-16 text if it starts with a
+//	                              UTF-16 BOM, otherwise returns UTF-8 text
+//
+// A UTF-16 BOM is decoded to a UTF-8 BOM, which is then stripped by the
+// Scanner.  Any other charset returns an ErrUnsupportedCharset error.
+func NewDecoder(r io.Reader, charset string) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return r, nil
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1":
+		return &decoder{r: r, decode: decodeLatin1}, nil
+	case "utf-16", "utf16":
+		return &decoder{r: r, sniff: decodeUTF16BE}, nil
+	case "utf-16be":
+		return &decoder{r: r, decode: decodeUTF16BE}, nil
+	case "utf-16le":
+		return &decoder{r: r, decode: decodeUTF16LE}, nil
+	case "":
+		return &decoder{r: r, sniff: decodeUTF8}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCharset, charset)
+	}
+}
+
+// MetaCharset returns the charset parameter of the MIME type in the meta of a
+// Gemini response header, such as "text/gemini; charset=iso-8859-1".  If the
+// meta has no charset, it returns "utf-8" as the specification says it should
+// be assumed.
+func MetaCharset(meta string) string {
+	_, params, err := mime.ParseMediaType(meta)
+	if err != nil || params["charset"] == "" {
+		return "utf-8"
+	}
+
+	return strings.ToLower(params["charset"])
+}
+
+// decodeFunc decodes bytes from src to UTF-8 and appends them to dst.  It
+// returns the extended dst and the number of bytes of src that were decoded.
+// Incomplete sequences at the end of src are left to be decoded with more
+// bytes, unless atEOF is true.
+type decodeFunc func(dst, src []byte, atEOF bool) ([]byte, int)
+
+// decoder is a reader that decodes bytes read from an underlying reader to
+// UTF-8 using a decodeFunc.
+type decoder struct {
+	r      io.Reader
+	decode decodeFunc // decodes bytes read from r
+	sniff  decodeFunc // decodes bytes read from r if there is no UTF-16 BOM
+	buf    [4096]byte // bytes read from r
+	n      int        // number of bytes in buf not decoded yet
+	dst    []byte     // decoded bytes
+	out    []byte     // decoded bytes not read yet
+	err    error      // error from reading r
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		n, err := d.r.Read(d.buf[d.n:])
+		d.n += n
+		d.err = err
+
+		if d.decode == nil {
+			if d.n < 2 && d.err == nil {
+				continue
+			}
+
+			d.detect()
+		}
+
+		var used int
+		d.dst, used = d.decode(d.dst[:0], d.buf[:d.n], d.err != nil)
+		d.n = copy(d.buf[:], d.buf[used:d.n])
+		d.out = d.dst
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+
+	return n, nil
+}
+
+// detect sets the decodeFunc from the UTF-16 BOM at the start of the bytes
+// read.  The sniff decodeFunc is used if there is no UTF-16 BOM.
+func (d *decoder) detect() {
+	switch {
+	case d.n >= 2 && d.buf[0] == 0xFE && d.buf[1] == 0xFF:
+		d.decode = decodeUTF16BE
+	case d.n >= 2 && d.buf[0] == 0xFF && d.buf[1] == 0xFE:
+		d.decode = decodeUTF16LE
+	default:
+		d.decode = d.sniff
+	}
+}
+
+// decodeUTF8 copies UTF-8 bytes as they are.
+func decodeUTF8(dst, src []byte, _ bool) ([]byte, int) {
+	return append(dst, src...), len(src)
+}
+
+// decodeLatin1 decodes ISO-8859-1 bytes, where each byte is a Unicode code
+// point.
+func decodeLatin1(dst, src []byte, _ bool) ([]byte, int) {
+	var r [utf8.UTFMax]byte
+
+	for _, b := range src {
+		if b < utf8.RuneSelf {
+			dst = append(dst, b)
+
+			continue
+		}
+
+		n := utf8.EncodeRune(r[:], rune(b))
+		dst = append(dst, r[:n]...)
+	}
+
+	return dst, len(src)
+}
+
+func decodeUTF16BE(dst, src []byte, atEOF bool) ([]byte, int) {
+	return decodeUTF16(dst, src, atEOF, binary.BigEndian)
+}
+
+func decodeUTF16LE(dst, src []byte, atEOF bool) ([]byte, int) {
+	return decodeUTF16(dst, src, atEOF, binary.LittleEndian)
+}
+
+// decodeUTF16 decodes UTF-16 bytes in the given byte order.  Invalid surrogate
+// pairs and a trailing odd byte are decoded as the Unicode replacement
+// character.
+func decodeUTF16(
+	dst, src []byte,
+	atEOF bool,
+	order binary.ByteOrder,
+) ([]byte, int) {
+	var (
+		b [utf8.UTFMax]byte
+		i int
+	)
+
+	for ; i+1 < len(src); i += 2 {
+		r := rune(order.Uint16(src[i:]))
+
+		if utf16.IsSurrogate(r) {
+			if i+3 >= len(src) && !atEOF {
+				break // wait for the rest of the surrogate pair
+			}
+
+			if i+3 < len(src) {
+				pair := utf16.DecodeRune(r, rune(order.Uint16(src[i+2:])))
+				if pair != utf8.RuneError {
+					r = pair
+					i += 2
+				}
+			}
+
+			if r < 0x10000 {
+				r = utf8.RuneError // unpaired surrogate
+			}
+		}
+
+		n := utf8.EncodeRune(b[:], r)
+		dst = append(dst, b[:n]...)
+	}
+
+	if atEOF && i < len(src) {
+		n := utf8.EncodeRune(b[:], utf8.RuneError)
+		dst = append(dst, b[:n]...)
+		i = len(src)
+	}
+
+	return dst, i
+}
@@ -0,0 +1,101 @@
+package gmitxt_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+func TestNewDecoder(t *testing.T) {
+	tests := []struct {
+		charset  string
+		input    string
+		expected string
+	}{
+		{"utf-8", "# Caf\xC3\xA9", "# Caf\xC3\xA9"},
+		{"US-ASCII", "# Cafe", "# Cafe"},
+		{"ISO-8859-1", "# Caf\xE9 \xBFs\xED?", "# Café ¿sí?"},
+		{"latin1", "\xFF", "ÿ"},
+		{"utf-16", "\xFE\xFF\x00#\x00 \x00C\x00\xE9", "\xEF\xBB\xBF# Cé"},
+		{"utf-16", "\xFF\xFE#\x00 \x00C\x00\xE9\x00", "\xEF\xBB\xBF# Cé"},
+		{"utf-16", "\x00#\x00 \x00C\x00\xE9", "# Cé"},
+		{"UTF-16BE", "\x00#\xD8\x3D\xDE\x00", "#😀"},
+		{"UTF-16LE", "#\x00\x3D\xD8\x00\xDE", "#😀"},
+		{"utf-16le", "#\x00\x3D\xD8#\x00", "#�#"},
+		{"utf-16le", "#\x00\x3D\xD8", "#�"},
+		{"utf-16le", "#\x00\x00\xDE", "#�"},
+		{"utf-16le", "#\x00#", "#�"},
+		{"", "\xFF\xFE#\x00\n\x00", "\xEF\xBB\xBF#\n"},
+		{"", "\xFE\xFF\x00#\x00\n", "\xEF\xBB\xBF#\n"},
+		{"", "# Caf\xC3\xA9", "# Caf\xC3\xA9"},
+		{"", "#", "#"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		r, err := gmitxt.NewDecoder(
+			iotest.OneByteReader(strings.NewReader(test.input)), test.charset)
+		if err != nil {
+			t.Errorf("Charset `%s`: unexpected error: %v", test.charset, err)
+
+			continue
+		}
+
+		output, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("Charset `%s`: unexpected error: %v", test.charset, err)
+		}
+
+		if string(output) != test.expected {
+			t.Errorf("Charset `%s`: expected %x to decode to %x, got: %x",
+				test.charset, test.input, test.expected, output)
+		}
+	}
+
+	t.Log("decoding with a read error")
+
+	r, err := gmitxt.NewDecoder(
+		iotest.TimeoutReader(strings.NewReader("\xE9\xE9")), "latin1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output, err := ioutil.ReadAll(r)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("Expected error `%v`, got: %v", iotest.ErrTimeout, err)
+	}
+
+	if string(output) != "éé" {
+		t.Errorf("Expected output before the error `éé`, got: `%s`", output)
+	}
+
+	t.Log("decoding an unsupported charset")
+
+	_, err = gmitxt.NewDecoder(strings.NewReader(""), "shift_jis")
+	if !errors.Is(err, gmitxt.ErrUnsupportedCharset) {
+		t.Errorf("Expected error `%v`, got: %v",
+			gmitxt.ErrUnsupportedCharset, err)
+	}
+}
+
+func TestMetaCharset(t *testing.T) {
+	tests := map[string]string{
+		"text/gemini":                          "utf-8",
+		"":                                     "utf-8",
+		"text/gemini; charset=ISO-8859-1":      "iso-8859-1",
+		"text/gemini; lang=en; charset=utf-16": "utf-16",
+		"text/gemini; charset=":                "utf-8",
+		"text/gemini; charset":                 "utf-8",
+	}
+
+	for meta, expected := range tests {
+		if charset := gmitxt.MetaCharset(meta); charset != expected {
+			t.Errorf("Meta `%s`: expected charset `%s`, got: `%s`",
+				meta, expected, charset)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Package epub writes Gemini text documents as an EPUB 3 e-book, so long-form
+// capsule content can be read on e-readers.
+//
+// Each document is a chapter, rendered as XHTML by the html package.  The
+// table of contents is built from the headings of all the chapters, and the
+// local images they link to are included in the book and shown in place.
+// Links to other chapters are rewritten to link to them in the book.
+//
+//     err := epub.Write(f, []epub.Chapter{{Name: "1.gmi", Text: text}},
+//         epub.Options{Author: "Kiba"})
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/html"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+// MediaType is the media type of an EPUB file, which is the content of its
+// first entry, named mimetype.
+const MediaType = "application/epub+zip"
+
+// root is the directory of the content of the book in the container.
+const root = "OEBPS/"
+
+// ErrNoChapters is returned when a book is written without chapters.
+var ErrNoChapters = errors.New("no chapters")
+
+// imageTypes are the media types of the images by their extension.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+}
+
+// Chapter is a Gemini text document of a book.
+type Chapter struct {
+	// Name is the file name of the document.  The local images and the links
+	// to other chapters in the text are resolved against it.
+	Name string
+	// Text is the Gemini text of the document.
+	Text []byte
+}
+
+// Options are the options of a book.
+type Options struct {
+	// Title is the title of the book.  If it is empty, it is the first level
+	// 1 heading of the chapters, or the title of the first chapter.
+	Title string
+	// Author is the author of the book, if any.
+	Author string
+	// Lang is the language of the book, such as "en".  If it is empty, it is
+	// the language of the first chapter from its name or its text, or "und"
+	// for an undetermined language.
+	Lang string
+	// ID is the unique identifier of the book, such as its ISBN.  If it is
+	// empty, it is a UUID URN from the hash of the chapters.
+	ID string
+	// Modified is the time the book was last modified.  If it is zero, it is
+	// the current time.
+	Modified time.Time
+	// ReadFile reads the named image files.  If it is nil, ioutil.ReadFile is
+	// used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// heading is an entry of the table of contents.
+type heading struct {
+	level int
+	text  string
+	href  string
+}
+
+// image is an image included in the book.
+type image struct {
+	href string // name in the book
+	typ  string // media type
+	data []byte
+}
+
+// book is a book being written.
+type book struct {
+	opts     Options
+	chapters []Chapter
+	files    map[string]string // names of chapter files in the book by source
+	images   []image
+	imageIDs map[string]int // indexes of the images by their source
+	toc      []heading
+	err      error // first error reading an image
+}
+
+// Write writes the chapters to dst as an EPUB 3 book with the options.  It
+// returns ErrNoChapters without chapters, and an error if a linked image
+// cannot be read.
+func Write(dst io.Writer, chapters []Chapter, opts Options) error {
+	if len(chapters) == 0 {
+		return ErrNoChapters
+	}
+
+	b := &book{
+		opts:     opts,
+		chapters: chapters,
+		files:    map[string]string{},
+		imageIDs: map[string]int{},
+	}
+
+	if b.opts.ReadFile == nil {
+		b.opts.ReadFile = ioutil.ReadFile
+	}
+
+	if b.opts.Modified.IsZero() {
+		b.opts.Modified = time.Now()
+	}
+
+	b.metadata()
+
+	for i, ch := range chapters {
+		b.files[filepath.Clean(ch.Name)] = chapterFile(i)
+	}
+
+	z := zip.NewWriter(dst)
+
+	if err := b.write(z); err != nil {
+		return err
+	}
+
+	if err := z.Close(); err != nil {
+		return fmt.Errorf("problem writing EPUB: %w", err)
+	}
+
+	return nil
+}
+
+// chapterFile returns the name in the book of the chapter at the index.
+func chapterFile(i int) string {
+	return fmt.Sprintf("ch%03d.xhtml", i+1)
+}
+
+// metadata sets the title, language and identifier of the book that are not
+// in the options from the chapters.
+func (b *book) metadata() {
+	first := chapterMeta(b.chapters[0])
+
+	if b.opts.Title == "" {
+		b.opts.Title = firstHead1(b.chapters)
+	}
+
+	if b.opts.Title == "" {
+		b.opts.Title = first.Title
+	}
+
+	if b.opts.Lang == "" {
+		b.opts.Lang = first.Lang
+	}
+
+	if b.opts.Lang == "" {
+		b.opts.Lang = "und"
+	}
+
+	if b.opts.ID == "" {
+		h := sha256.New()
+
+		for _, ch := range b.chapters {
+			fmt.Fprintf(h, "%s\n%d\n", ch.Name, len(ch.Text))
+			h.Write(ch.Text) // nolint: errcheck // never fails
+		}
+
+		b.opts.ID = uuidURN(h.Sum(nil))
+	}
+}
+
+// chapterMeta returns the metadata of the chapter, with the base name of the
+// chapter without its extension as its title if it has no heading.
+func chapterMeta(ch Chapter) gmitxt.Meta {
+	meta := gmitxt.ExtractMeta(namedReader{bytes.NewReader(ch.Text), ch.Name})
+	if meta.Title == "" {
+		base := filepath.Base(ch.Name)
+		meta.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	return meta
+}
+
+// namedReader is a reader of the text of a chapter, whose date and language
+// are taken from its name by gmitxt.ExtractMeta.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+// Name returns the name of the chapter.
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// firstHead1 returns the text of the first level 1 heading of the chapters
+// that is not empty, if any.
+func firstHead1(chapters []Chapter) string {
+	for _, ch := range chapters {
+		s := gmitxt.NewScanner(bytes.NewReader(ch.Text))
+
+		for s.Scan() {
+			line := s.Line()
+			if text := strings.TrimSpace(string(line.Text)); line.Type ==
+				gmitxt.Head1 && text != "" {
+				return text
+			}
+		}
+	}
+
+	return ""
+}
+
+// uuidURN returns a UUID URN made from the hash, as a name-based UUID is.
+func uuidURN(sum []byte) string {
+	var u [16]byte
+
+	copy(u[:], sum)
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x",
+		u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// write writes the files of the book to the zip archive, with the mimetype
+// first and uncompressed, as readers find the type of the file by it.
+func (b *book) write(z *zip.Writer) error {
+	if err := b.create(z, "mimetype", zip.Store,
+		[]byte(MediaType)); err != nil {
+		return err
+	}
+
+	if err := b.create(z, "META-INF/container.xml", zip.Deflate,
+		[]byte(container)); err != nil {
+		return err
+	}
+
+	for i, ch := range b.chapters {
+		data, err := b.chapter(ch)
+		if err != nil {
+			return err
+		}
+
+		if err := b.create(z, root+chapterFile(i), zip.Deflate,
+			data); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.images {
+		// Images are already compressed.
+		if err := b.create(z, root+img.href, zip.Store, img.data); err != nil {
+			return err
+		}
+	}
+
+	if err := b.create(z, root+"nav.xhtml", zip.Deflate, b.nav()); err != nil {
+		return err
+	}
+
+	return b.create(z, root+"content.opf", zip.Deflate, b.pkg())
+}
+
+// create writes the named file with the data to the zip archive with the
+// compression method.
+func (b *book) create(z *zip.Writer, name string, method uint16,
+	data []byte) error {
+	w, err := z.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: b.opts.Modified,
+	})
+	if err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// chapter returns the XHTML document of the chapter.  Its headings are added
+// to the table of contents, and the local images it links to are added to the
+// book.
+func (b *book) chapter(ch Chapter) ([]byte, error) {
+	file := b.files[filepath.Clean(ch.Name)]
+	meta := chapterMeta(ch)
+
+	var buf bytes.Buffer
+
+	w := html.NewWriter(&buf, html.Options{
+		Document: true,
+		XHTML:    true,
+		Title:    meta.Title,
+		Lang:     b.opts.Lang,
+		Images:   true,
+		RewriteURL: func(link string) string {
+			return b.rewrite(ch.Name, link)
+		},
+	})
+
+	var slugs links.Slugs
+
+	s := gmitxt.NewScanner(bytes.NewReader(ch.Text))
+	headings := len(b.toc)
+
+	for s.Scan() {
+		line := s.Line()
+		w.Write(line) // nolint: errcheck // checked by Error
+
+		if level := headingLevel(line.Type); level != 0 {
+			b.addHeading(&slugs, file, level, string(line.Text))
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", ch.Name, err)
+	}
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("problem rendering %s: %w", ch.Name, err)
+	}
+
+	if len(b.toc) == headings {
+		b.toc = append(b.toc, heading{1, meta.Title, file})
+	}
+
+	return buf.Bytes(), nil
+}
+
+// headingLevel returns the level of a heading line, or 0 for other lines.
+func headingLevel(typ gmitxt.LineType) int {
+	switch typ {
+	case gmitxt.Head1:
+		return 1
+	case gmitxt.Head2:
+		return 2
+	case gmitxt.Head3:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// addHeading adds the heading of the chapter file to the table of contents,
+// linked to by the id the html package gives it, which is the next of the
+// slugs of the chapter.  Empty headings are not written, so they are not
+// added.
+func (b *book) addHeading(slugs *links.Slugs, file string, level int,
+	text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	href := file
+
+	if id := slugs.Next(text); id != "" {
+		href += "#" + id
+	}
+
+	b.toc = append(b.toc, heading{level, text, href})
+}
+
+// rewrite returns the URL of a link of the named chapter in the book.  Links
+// to other chapters link to their file, and local images are added to the
+// book.  Other links are returned as they are.
+func (b *book) rewrite(name, link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return link
+	}
+
+	src := filepath.Join(filepath.Dir(name), filepath.FromSlash(u.Path))
+
+	if file, ok := b.files[src]; ok {
+		return (&url.URL{Path: file, Fragment: u.Fragment}).String()
+	}
+
+	typ, ok := imageTypes[strings.ToLower(path.Ext(u.Path))]
+	if !ok {
+		return link
+	}
+
+	i, ok := b.imageIDs[src]
+	if !ok {
+		data, err := b.opts.ReadFile(src)
+		if err != nil {
+			if b.err == nil {
+				b.err = fmt.Errorf("problem reading image of %s: %w", name,
+					err)
+			}
+
+			return link
+		}
+
+		i = len(b.images)
+		b.imageIDs[src] = i
+		b.images = append(b.images, image{
+			href: fmt.Sprintf("images/img%03d%s", i+1,
+				strings.ToLower(path.Ext(u.Path))),
+			typ:  typ,
+			data: data,
+		})
+	}
+
+	return b.images[i].href
+}
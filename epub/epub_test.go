@@ -0,0 +1,262 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/epub"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestWrite(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"images/cat.png": "png",
+	})
+
+	chapters := []epub.Chapter{
+		{Name: filepath.Join(dir, "intro.gmi"), Text: []byte(
+			"## Before\n# My <Book>\n=> images/cat.png A cat\n" +
+				"=> images/cat.png Same cat\n=> part2.gmi#more Next\n" +
+				"=> https://example.org/dog.png Dog\n=> notes.txt Notes\n" +
+				"### Deep\n## Middle\n## Middle\n")},
+		{Name: filepath.Join(dir, "part2.gmi"), Text: []byte(
+			"# Part 2\n#\n## More\n")},
+		{Name: filepath.Join(dir, "2021-03-17-notes.fr.gmi"), Text: []byte(
+			"No heading\n=> ./intro.gmi Back\n")},
+	}
+
+	var buf bytes.Buffer
+
+	modified := time.Date(2021, 3, 17, 12, 0, 0, 0, time.UTC)
+	if err := epub.Write(&buf, chapters, epub.Options{
+		Author:   "Kiba & Co",
+		Modified: modified,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := readBook(t, buf.Bytes())
+
+	expected := []string{
+		"mimetype", "META-INF/container.xml", "OEBPS/ch001.xhtml",
+		"OEBPS/ch002.xhtml", "OEBPS/ch003.xhtml", "OEBPS/images/img001.png",
+		"OEBPS/nav.xhtml", "OEBPS/content.opf",
+	}
+	if names := strings.Join(files.names, " "); names !=
+		strings.Join(expected, " ") {
+		t.Errorf("Expected files %v, got: %v", expected, files.names)
+	}
+
+	if files.data["OEBPS/images/img001.png"] != "png" {
+		t.Error("Expected the image in the book")
+	}
+
+	for name, want := range map[string][]string{
+		"META-INF/container.xml": {`full-path="OEBPS/content.opf"`},
+		"OEBPS/content.opf": {
+			`<dc:identifier id="id">urn:uuid:`,
+			"<dc:title>My &lt;Book&gt;</dc:title>",
+			"<dc:creator>Kiba &amp; Co</dc:creator>",
+			"<dc:language>und</dc:language>",
+			`<meta property="dcterms:modified">2021-03-17T12:00:00Z</meta>`,
+			`<item id="img001" href="images/img001.png" ` +
+				`media-type="image/png"/>`,
+			"<spine>\n<itemref idref=\"ch001\"/>\n<itemref idref=\"ch002\"/>\n" +
+				"<itemref idref=\"ch003\"/>\n</spine>",
+		},
+		"OEBPS/ch001.xhtml": {
+			`<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="und"`,
+			"<title>My &lt;Book&gt;</title>",
+			`<p><img src="images/img001.png" alt="A cat" /></p>`,
+			`<p><img src="images/img001.png" alt="Same cat" /></p>`,
+			`<p><a href="ch002.xhtml#more">Next</a></p>`,
+			`<p><a href="https://example.org/dog.png">Dog</a></p>`,
+			`<p><a href="notes.txt">Notes</a></p>`,
+		},
+		"OEBPS/ch003.xhtml": {
+			"<title>No heading</title>",
+			`<p><a href="ch001.xhtml">Back</a></p>`,
+		},
+		"OEBPS/nav.xhtml": {
+			`<nav epub:type="toc" id="toc">`,
+			"<ol>\n" +
+				"<li><a href=\"ch001.xhtml#before\">Before</a></li>\n" +
+				"<li><a href=\"ch001.xhtml#my-book\">My &lt;Book&gt;</a>" +
+				"<ol>\n" +
+				"<li><a href=\"ch001.xhtml#deep\">Deep</a></li>\n" +
+				"</ol>\n<ol>\n" +
+				"<li><a href=\"ch001.xhtml#middle\">Middle</a></li>\n" +
+				"<li><a href=\"ch001.xhtml#middle-1\">Middle</a></li>\n" +
+				"</ol>\n</li>\n" +
+				"<li><a href=\"ch002.xhtml#part-2\">Part 2</a><ol>\n" +
+				"<li><a href=\"ch002.xhtml#more\">More</a></li>\n" +
+				"</ol>\n</li>\n" +
+				"<li><a href=\"ch003.xhtml\">No heading</a></li>\n" +
+				"</ol>\n</nav>",
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(files.data[name], w) {
+				t.Errorf("Expected %q in %s, got:\n%s", w, name,
+					files.data[name])
+			}
+		}
+	}
+
+	t.Log("checking the metadata of the options")
+
+	buf.Reset()
+
+	if err := epub.Write(&buf, chapters[2:], epub.Options{
+		Title: "Notes",
+		ID:    "isbn:123",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files = readBook(t, buf.Bytes())
+
+	for _, w := range []string{
+		"<dc:identifier id=\"id\">isbn:123</dc:identifier>\n" +
+			"<dc:title>Notes</dc:title>\n<dc:language>fr</dc:language>",
+		`<meta property="dcterms:modified">` +
+			time.Now().UTC().Format("2006-"),
+	} {
+		if !strings.Contains(files.data["OEBPS/content.opf"], w) {
+			t.Errorf("Expected %q in the package, got:\n%s", w,
+				files.data["OEBPS/content.opf"])
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	if err := epub.Write(ioutil.Discard, nil,
+		epub.Options{}); !errors.Is(err, epub.ErrNoChapters) {
+		t.Errorf("Expected ErrNoChapters, got: %v", err)
+	}
+
+	chapters := []epub.Chapter{{Name: "a.gmi", Text: []byte(
+		"=> missing.png\n=> other.png\n")}}
+
+	err := epub.Write(ioutil.Discard, chapters, epub.Options{})
+	if !os.IsNotExist(errors.Unwrap(err)) ||
+		!strings.Contains(err.Error(), "problem reading image of a.gmi") {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+
+	err = epub.Write(errWriter{}, []epub.Chapter{{Name: "a.gmi"}},
+		epub.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+
+	chapters = []epub.Chapter{{Name: "a.gmi", Text: []byte(
+		"=> %zz\n=> big.png\n")}}
+
+	err = epub.Write(errWriter{}, chapters, epub.Options{
+		ReadFile: func(string) ([]byte, error) {
+			// Random data is not compressed, so it fills the buffer.
+			data := make([]byte, 1<<16)
+			rand.Read(data) // nolint: errcheck, gosec // test data
+
+			return data, nil
+		},
+	})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+
+	chapters = []epub.Chapter{{Name: "a.gmi", Text: []byte(
+		strings.Repeat("a", 1<<20))}}
+
+	err = epub.Write(ioutil.Discard, chapters, epub.Options{})
+	if err == nil || !strings.Contains(err.Error(), "problem reading a.gmi") {
+		t.Errorf("Expected reading error, got: %v", err)
+	}
+}
+
+// book holds the files of an EPUB book.
+type book struct {
+	names []string
+	data  map[string]string
+}
+
+// readBook returns the files of the EPUB book, checking the mimetype is first
+// and uncompressed, and the XML files are well-formed.
+func readBook(t *testing.T, data []byte) book {
+	t.Helper()
+
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("could not read book: %v", err)
+	}
+
+	b := book{data: map[string]string{}}
+
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("could not open %s: %v", f.Name, err)
+		}
+
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+
+		if err != nil {
+			t.Fatalf("could not read %s: %v", f.Name, err)
+		}
+
+		b.names = append(b.names, f.Name)
+		b.data[f.Name] = string(data)
+
+		ext := filepath.Ext(f.Name)
+		if ext == ".xml" || ext == ".xhtml" || ext == ".opf" {
+			checkXML(t, f.Name, data)
+		}
+	}
+
+	if len(z.File) == 0 || z.File[0].Name != "mimetype" ||
+		z.File[0].Method != zip.Store ||
+		b.data["mimetype"] != epub.MediaType {
+		t.Error("Expected the mimetype first and uncompressed")
+	}
+
+	return b
+}
+
+// checkXML checks the named file is well-formed XML.
+func checkXML(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		_, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			t.Errorf("Expected %s to be well-formed: %v", name, err)
+
+			return
+		}
+	}
+}
+
+var errTest = errors.New("test error")
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTest
+}
@@ -0,0 +1,128 @@
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/html"
+)
+
+// container is the container file of the book, which gives the package
+// document.
+const container = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" ` +
+	`xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="` + root + `content.opf" ` +
+	`media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`
+
+// pkg returns the package document of the book, with its metadata, the
+// manifest of its files and the spine of its chapters.
+func (b *book) pkg() []byte {
+	var buf bytes.Buffer
+
+	lang := html.Escape(b.opts.Lang)
+
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" `+
+		`unique-identifier="id" xml:lang="%s">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">%s</dc:identifier>
+<dc:title>%s</dc:title>
+`, lang, html.Escape(b.opts.ID), html.Escape(b.opts.Title))
+
+	if b.opts.Author != "" {
+		fmt.Fprintf(&buf, "<dc:creator>%s</dc:creator>\n",
+			html.Escape(b.opts.Author))
+	}
+
+	fmt.Fprintf(&buf, `<dc:language>%s</dc:language>
+<meta property="dcterms:modified">%s</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" `+
+		`properties="nav"/>
+`, lang, b.opts.Modified.UTC().Format(time.RFC3339))
+
+	for i := range b.chapters {
+		fmt.Fprintf(&buf, "<item id=\"ch%03d\" href=\"%s\" "+
+			"media-type=\"application/xhtml+xml\"/>\n", i+1, chapterFile(i))
+	}
+
+	for i, img := range b.images {
+		fmt.Fprintf(&buf, "<item id=\"img%03d\" href=\"%s\" "+
+			"media-type=\"%s\"/>\n", i+1, img.href, img.typ)
+	}
+
+	buf.WriteString("</manifest>\n<spine>\n")
+
+	for i := range b.chapters {
+		fmt.Fprintf(&buf, "<itemref idref=\"ch%03d\"/>\n", i+1)
+	}
+
+	buf.WriteString("</spine>\n</package>\n")
+
+	return buf.Bytes()
+}
+
+// nav returns the navigation document of the book, with its table of
+// contents as nested lists of the headings of the chapters.
+func (b *book) nav() []byte {
+	var buf bytes.Buffer
+
+	lang := html.Escape(b.opts.Lang)
+	title := html.Escape(b.opts.Title)
+
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" `+
+		`xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">
+<head>
+<meta charset="utf-8" />
+<title>%s</title>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>%s</h1>
+`, lang, lang, title, title)
+
+	writeTOC(&buf, b.toc)
+
+	buf.WriteString("</nav>\n</body>\n</html>\n")
+
+	return buf.Bytes()
+}
+
+// writeTOC writes the headings as nested ordered lists, with the headings of
+// a higher level in the list item of the heading before them.  There is a
+// single outer list, as the navigation document needs, so a heading of a
+// lower level than the first heading is put in the outer list.
+func writeTOC(buf *bytes.Buffer, toc []heading) {
+	var levels []int // levels of the open lists
+
+	for _, h := range toc {
+		for len(levels) > 1 && h.level < levels[len(levels)-1] {
+			buf.WriteString("</li>\n</ol>\n")
+			levels = levels[:len(levels)-1]
+		}
+
+		switch top := len(levels) - 1; {
+		case top < 0 || h.level > levels[top]:
+			buf.WriteString("<ol>\n")
+			levels = append(levels, h.level)
+		default:
+			buf.WriteString("</li>\n")
+			levels[top] = h.level
+		}
+
+		fmt.Fprintf(buf, "<li><a href=\"%s\">%s</a>", html.Escape(h.href),
+			html.Escape(h.text))
+	}
+
+	buf.WriteString(strings.Repeat("</li>\n</ol>\n", len(levels)))
+}
@@ -40,3 +40,16 @@ func ExampleScanner() {
 	// line 2: Text: This is a line of text.
 	// line 3: Link: url gemini://gemini.circumlunar.space/: Gemini
 }
+
+// Using ExtractMeta to get the title, summary and word count of a page.
+func ExampleExtractMeta() {
+	meta := gmitxt.ExtractMeta(strings.NewReader(geminiText))
+
+	fmt.Println(meta.Title)
+	fmt.Println(meta.Summary)
+	fmt.Println(meta.Words)
+
+	// Output: Example Gemini
+	// This is a line of text.
+	// 9
+}
@@ -0,0 +1,67 @@
+package gmitxt
+
+import (
+	"fmt"
+	"io"
+)
+
+// FormatOptions are the options used by Format.
+type FormatOptions struct {
+	// CollapseBlank collapses each run of blank text lines into a single blank
+	// line.
+	CollapseBlank bool
+}
+
+// Format reads Gemini text from src and writes it to dst in its canonical form.
+// It is similar to what gofmt does for Go source code:
+//
+//     * Headings have a single space after the #, such as "# Heading".
+//     * Links have a single space around the URL, such as "=> url text".
+//     * Trailing whitespace is stripped outside of preformatted text.
+//     * Text after the ``` that ends preformatted text is dropped.
+//     * Lines end with a LF (\n UNIX format), including the last line.
+//
+// Lines that are too long to fit in the Scanner's buffer are split while they
+// are scanned and joined back when they are written, without stripping their
+// trailing whitespace.
+func Format(dst io.Writer, src io.Reader, opts FormatOptions) error {
+	s := NewScanner(src)
+	s.LongLines(LongLineSplit)
+
+	w := NewWriter(dst)
+	blank := false
+
+	for s.Scan() {
+		line := s.Line()
+
+		if line.Flags == 0 && line.Type != PreBody {
+			line.Text = trimRightSpace(line.Text)
+		}
+
+		if line.Type == Text && len(line.Text) == 0 && line.Flags == 0 {
+			if blank && opts.CollapseBlank {
+				continue
+			}
+
+			blank = true
+		} else {
+			blank = false
+		}
+
+		if err := w.Write(line); err != nil {
+			return fmt.Errorf("problem writing line %d: %w", line.Num, err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem scanning text: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
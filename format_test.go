@@ -0,0 +1,142 @@
+package gmitxt_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+const exampleFmt = "testdata/example_fmt.gmi"
+
+func TestFormat(t *testing.T) {
+	f, err := os.Open(example)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", example, err)
+	}
+	defer f.Close()
+
+	expected, err := ioutil.ReadFile(exampleFmt)
+	if err != nil {
+		t.Fatalf("could not read file %s: %v", exampleFmt, err)
+	}
+
+	t.Logf("formatting: %s", example)
+
+	var buf bytes.Buffer
+	if err := gmitxt.Format(&buf, f, gmitxt.FormatOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected %s to be formatted as %s, got:\n%s",
+			example, exampleFmt, buf.Bytes())
+	}
+
+	t.Logf("formatting: %s", exampleFmt)
+
+	buf.Reset()
+
+	err = gmitxt.Format(&buf, bytes.NewReader(expected), gmitxt.FormatOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected %s to be formatted as it is, got:\n%s",
+			exampleFmt, buf.Bytes())
+	}
+}
+
+func TestFormatEmptyTokens(t *testing.T) {
+	input := "=>\n=>   \n*  \n* \n#\t\n>  \n"
+	expected := "=>\n=>\n* \n* \n#\n>\n"
+
+	var buf bytes.Buffer
+
+	err := gmitxt.Format(&buf, strings.NewReader(input), gmitxt.FormatOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, buf.String())
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	input := "Text\r\n\n\n \n```\n\n\n```\n#  Heading\t\n\n"
+	tests := []struct {
+		opts     gmitxt.FormatOptions
+		expected string
+	}{
+		{
+			gmitxt.FormatOptions{},
+			"Text\n\n\n\n```\n\n\n```\n# Heading\n\n",
+		},
+		{
+			gmitxt.FormatOptions{CollapseBlank: true},
+			"Text\n\n```\n\n\n```\n# Heading\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		err := gmitxt.Format(&buf, strings.NewReader(input), test.opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if buf.String() != test.expected {
+			t.Errorf("Options %+v: expected %q, got: %q",
+				test.opts, test.expected, buf.String())
+		}
+	}
+}
+
+func TestFormatLongLines(t *testing.T) {
+	long := "=>\t" + strings.Repeat("x", 100000) + " long  "
+	input := long + "\n# End"
+
+	var buf bytes.Buffer
+
+	err := gmitxt.Format(&buf, strings.NewReader(input), gmitxt.FormatOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "=> " + long[3:] + "\n# End\n"
+	if buf.String() != expected {
+		t.Errorf("Expected long line to be kept, got %d bytes: %.80q",
+			buf.Len(), buf.String())
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	r := iotest.TimeoutReader(strings.NewReader("# Heading"))
+
+	err := gmitxt.Format(ioutil.Discard, r, gmitxt.FormatOptions{})
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("Expected error `%v`, got: %v", iotest.ErrTimeout, err)
+	}
+
+	input := strings.Repeat("Text\n", 1000)
+
+	err = gmitxt.Format(errWriter{}, strings.NewReader(input),
+		gmitxt.FormatOptions{})
+	if !errors.Is(err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+
+	err = gmitxt.Format(errWriter{}, strings.NewReader("Text"),
+		gmitxt.FormatOptions{})
+	if !errors.Is(err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+}
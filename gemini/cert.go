@@ -0,0 +1,126 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NewCertificate returns a new self-signed certificate for the hosts, which
+// are host names or IP addresses, that is valid for the duration.  The
+// certificate and its ECDSA private key are returned in PEM format.
+func NewCertificate(
+	hosts []string,
+	validFor time.Duration,
+) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem generating key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	if len(hosts) != 0 {
+		tmpl.Subject = pkix.Name{CommonName: hosts[0]}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey,
+		key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem creating certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem encoding key: %w", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyDER,
+	})
+
+	return certPEM, keyPEM, nil
+}
+
+// LoadCertificate loads the certificate and its private key from the PEM
+// files.  If neither file exists, a self-signed certificate for the hosts that
+// is valid for the duration is created with NewCertificate and written to the
+// files first, so a server has a certificate from its first run.
+func LoadCertificate(
+	certFile, keyFile string,
+	hosts []string,
+	validFor time.Duration,
+) (tls.Certificate, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		certPEM, keyPEM, err := NewCertificate(hosts, validFor)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		if err := writePEM(keyFile, keyPEM, 0o600); err != nil {
+			return tls.Certificate{}, err
+		}
+
+		if err := writePEM(certFile, certPEM, 0o644); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return cert, fmt.Errorf("problem loading certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// writePEM writes the PEM data to the named file with the permissions,
+// creating its directory if needed.
+func writePEM(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	if err := ioutil.WriteFile(name, data, perm); err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	return nil
+}
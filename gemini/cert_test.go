@@ -0,0 +1,107 @@
+package gemini_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestNewCertificate(t *testing.T) {
+	certPEM, keyPEM, err := gemini.NewCertificate(
+		[]string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.Subject.CommonName != "localhost" {
+		t.Errorf("Expected common name localhost, got: %q",
+			c.Subject.CommonName)
+	}
+
+	if len(c.DNSNames) != 1 || c.DNSNames[0] != "localhost" {
+		t.Errorf("Expected DNS name localhost, got: %v", c.DNSNames)
+	}
+
+	if len(c.IPAddresses) != 1 ||
+		!c.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Expected IP address 127.0.0.1, got: %v", c.IPAddresses)
+	}
+
+	if c.NotAfter.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("Expected certificate valid for an hour, got: %v",
+			c.NotAfter)
+	}
+}
+
+func TestLoadCertificate(t *testing.T) {
+	dir := testutil.TempDir(t, nil)
+	certFile := filepath.Join(dir, "gmitxt", "cert.pem")
+	keyFile := filepath.Join(dir, "gmitxt", "key.pem")
+
+	cert, err := gemini.LoadCertificate(certFile, keyFile,
+		[]string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected key mode 0600, got: %v", info.Mode())
+	}
+
+	t.Log("checking the certificate is loaded again")
+
+	again, err := gemini.LoadCertificate(certFile, keyFile, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(again.Certificate[0]) != string(cert.Certificate[0]) {
+		t.Error("Expected the same certificate to be loaded")
+	}
+
+	t.Log("checking a missing key is not created")
+
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := gemini.LoadCertificate(certFile, keyFile, nil,
+		time.Hour); err == nil {
+		t.Error("Expected an error loading a certificate without a key")
+	}
+
+	t.Log("checking an unwritable directory")
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := gemini.LoadCertificate(filepath.Join(file, "cert.pem"),
+		filepath.Join(file, "key.pem"), nil, time.Hour); err == nil {
+		t.Error("Expected an error writing under a file")
+	}
+}
@@ -0,0 +1,350 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+var (
+	// ErrTooManyRedirects is returned when a request is redirected more
+	// times than the client follows.
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrNotGemini is returned when a response body is not Gemini text.
+	ErrNotGemini = errors.New("response is not Gemini text")
+	// ErrUnsupportedScheme is returned when a request URL does not use the
+	// gemini scheme.
+	ErrUnsupportedScheme = errors.New("unsupported scheme")
+)
+
+// DefaultMaxRedirects is the most redirects a Client follows when it has no
+// MaxRedirects.
+const DefaultMaxRedirects = 5
+
+// Response is a response received by a client.
+type Response struct {
+	// Status is the status code of the response.
+	Status int
+	// Meta is the meta of the response header, such as the MIME type of the
+	// body or the error message.
+	Meta string
+	// Body is the body of the response.  It is empty unless the response is
+	// successful, and it must be closed.
+	Body io.ReadCloser
+	// URL is the URL of the request, which is the last one when redirects
+	// were followed.
+	URL *url.URL
+	// TLS is the state of the TLS connection, with the certificates of the
+	// server.
+	TLS *tls.ConnectionState
+}
+
+// MediaType returns the MIME type of a successful response and its
+// parameters, such as "text/gemini" and its charset and lang.  A meta that is
+// empty or cannot be parsed is taken as text/gemini, as the specification
+// says.
+func (r *Response) MediaType() (string, map[string]string) {
+	typ, params, err := mime.ParseMediaType(r.Meta)
+	if err != nil {
+		return GeminiType, map[string]string{}
+	}
+
+	return typ, params
+}
+
+// Charset returns the charset of a successful response, which is "utf-8" if
+// it has none.
+func (r *Response) Charset() string {
+	return gmitxt.MetaCharset(r.Meta)
+}
+
+// Lang returns the lang parameter of a successful response, which is the
+// language of its Gemini text, such as "en" or "en,fr".  It is empty if the
+// response has none.
+func (r *Response) Lang() string {
+	_, params := r.MediaType()
+
+	return params["lang"]
+}
+
+// Scanner returns a Scanner of the body of a successful response with Gemini
+// text, decoded from its charset to UTF-8.  It returns ErrNotGemini for other
+// responses.
+func (r *Response) Scanner() (*gmitxt.Scanner, error) {
+	if typ, _ := r.MediaType(); r.Status/10 != StatusSuccess/10 ||
+		typ != GeminiType {
+		return nil, fmt.Errorf("%w: %02d %s", ErrNotGemini, r.Status, r.Meta)
+	}
+
+	body, err := gmitxt.NewDecoder(r.Body, r.Charset())
+	if err != nil {
+		return nil, fmt.Errorf("problem decoding response: %w", err)
+	}
+
+	return gmitxt.NewScanner(body), nil
+}
+
+// memoryHosts is the store of trusted certificates of the clients without
+// KnownHosts.
+var memoryHosts = &KnownHosts{hosts: map[string]knownHost{}}
+
+// Client sends Gemini requests over TLS.
+type Client struct {
+	// KnownHosts checks the certificates of servers.  If it is nil, the
+	// certificates are checked by a store kept in memory, which is shared by
+	// the clients without KnownHosts.
+	KnownHosts *KnownHosts
+	// Certificates are the client certificates sent to servers that request
+	// one.
+	Certificates []tls.Certificate
+	// MaxRedirects is the most redirects followed for a request.  If it is
+	// zero, DefaultMaxRedirects is used, and if it is negative, redirects
+	// are not followed.
+	MaxRedirects int
+	// Timeout is the most time to connect to a server and receive the
+	// response header.  If it is zero, DefaultTimeout is used.
+	Timeout time.Duration
+	// Control is called with the resolved address of a server before
+	// connecting to it, as the Control of a net.Dialer is.  The connection
+	// is refused if it returns an error, such as for a private address.
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// Get sends a request for the URL.  See Do for details.
+func (c *Client) Get(rawurl string) (*Response, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing URL: %w", err)
+	}
+
+	return c.Do(u)
+}
+
+// Do sends a request for the URL and returns the response.  Redirects to
+// other gemini URLs are followed up to the MaxRedirects of the client, after
+// which ErrTooManyRedirects is returned.  A redirect to another scheme is
+// returned as the response.
+func (c *Client) Do(u *url.URL) (*Response, error) {
+	return c.DoContext(context.Background(), u)
+}
+
+// DoContext is like Do, but the connection is closed when the context is
+// done, which stops the request and the reading of the body of the response.
+func (c *Client) DoContext(ctx context.Context, u *url.URL) (*Response,
+	error) {
+	max := c.MaxRedirects
+	if max == 0 {
+		max = DefaultMaxRedirects
+	}
+
+	for n := 0; ; n++ {
+		res, err := c.do(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.Status/10 != StatusRedirect/10 {
+			return res, nil
+		}
+
+		next, err := u.Parse(res.Meta)
+		if err != nil || next.Scheme != "gemini" || max < 0 {
+			return res, nil // nolint: nilerr // the redirect is returned
+		}
+
+		res.Body.Close()
+
+		if n == max {
+			return nil, fmt.Errorf("%w: %s", ErrTooManyRedirects, next)
+		}
+
+		u = next
+	}
+}
+
+// do sends a request for the URL without following redirects.
+func (c *Client) do(ctx context.Context, u *url.URL) (*Response, error) {
+	if u.Scheme != "gemini" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	req := u.String()
+	if len(req) > MaxRequestLength {
+		return nil, ErrRequestTooLong
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1965")
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	d := &net.Dialer{Timeout: timeout, Control: c.Control}
+
+	raw, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("problem connecting to %s: %w", host, err)
+	}
+
+	stop := closeOnDone(ctx, raw)
+	conn := tls.Client(raw, c.tlsConfig(u.Hostname(), host))
+
+	// The error is returned by the handshake after the deadline.
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := conn.Handshake(); err != nil {
+		stop()
+		conn.Close()
+
+		return nil, fmt.Errorf("problem connecting to %s: %w", host,
+			contextErr(ctx, err))
+	}
+
+	res, err := readResponse(conn, req, timeout, stop)
+	if err != nil {
+		stop()
+		conn.Close()
+
+		return nil, fmt.Errorf("problem requesting %s: %w", req,
+			contextErr(ctx, err))
+	}
+
+	res.URL = u
+
+	return res, nil
+}
+
+// closeOnDone closes the connection when the context is done, until the
+// returned function is called.
+func closeOnDone(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// contextErr returns the error of the context if it is done, as it is the
+// cause of the error of a closed connection, or err otherwise.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+// tlsConfig returns the TLS configuration to connect to the host, which
+// includes the port, with the server name.
+func (c *Client) tlsConfig(name, host string) *tls.Config {
+	return &tls.Config{
+		ServerName:   name,
+		Certificates: c.Certificates,
+		MinVersion:   tls.VersionTLS12,
+		// Servers commonly use self-signed certificates, so they are checked
+		// by the known hosts instead.
+		InsecureSkipVerify:    true, // nolint: gosec // checked by known hosts
+		VerifyPeerCertificate: c.verify(host),
+	}
+}
+
+// verify returns a function that checks the certificate of the host, which
+// includes the port, with the known hosts of the client.
+func (c *Client) verify(
+	host string,
+) func([][]byte, [][]*x509.Certificate) error {
+	return func(raw [][]byte, _ [][]*x509.Certificate) error {
+		if len(raw) == 0 {
+			return fmt.Errorf("%w: no certificate", ErrCertificateMismatch)
+		}
+
+		cert, err := x509.ParseCertificate(raw[0])
+		if err != nil {
+			return fmt.Errorf("problem parsing certificate: %w", err)
+		}
+
+		k := c.KnownHosts
+		if k == nil {
+			k = memoryHosts
+		}
+
+		return k.Check(host, cert)
+	}
+}
+
+// readResponse sends the request on the connection and reads the response
+// header within the timeout.  The function stop is called when the body is
+// closed.
+func readResponse(conn *tls.Conn, req string, timeout time.Duration,
+	stop func()) (*Response, error) {
+	// The error is returned by the reads and writes after the deadline.
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return nil, fmt.Errorf("problem sending request: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+
+	status, meta, err := ReadResponseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body can take longer than the timeout to read.
+	_ = conn.SetDeadline(time.Time{})
+
+	state := conn.ConnectionState()
+	res := &Response{Status: status, Meta: meta, TLS: &state}
+
+	if status/10 == StatusSuccess/10 {
+		res.Body = &body{r, conn, stop}
+	} else {
+		stop()
+		conn.Close()
+		res.Body = ioutil.NopCloser(strings.NewReader(""))
+	}
+
+	return res, nil
+}
+
+// body is the body of a response read from a connection, which is closed
+// with the body.
+type body struct {
+	io.Reader
+	conn io.Closer
+	stop func() // stops closing the connection when the context is done
+}
+
+// Close closes the connection of the body.
+func (b *body) Close() error {
+	b.stop()
+
+	return b.conn.Close() // nolint: wrapcheck // error of the connection
+}
@@ -0,0 +1,499 @@
+package gemini_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestClient(t *testing.T) {
+	addr := serve(t, gemini.HandlerFunc(
+		func(w gemini.ResponseWriter, r *gemini.Request) {
+			switch r.URL.Path {
+			case "/text":
+				w.WriteHeader(gemini.StatusSuccess,
+					"text/gemini; charset=ISO-8859-1; lang=fr")
+				w.Write([]byte("# Caf\xe9\n=> / Accueil\n")) // nolint: errcheck
+			case "/plain":
+				w.WriteHeader(gemini.StatusSuccess, "text/plain")
+			case "/koi8":
+				w.WriteHeader(gemini.StatusSuccess,
+					"text/gemini; charset=koi8-r")
+			case "/loop":
+				w.WriteHeader(gemini.StatusRedirect, "/loop")
+			case "/moved":
+				w.WriteHeader(gemini.StatusPermanentRedirect, "text")
+			case "/web":
+				w.WriteHeader(gemini.StatusRedirect, "https://example.org/")
+			case "/invalid":
+				w.WriteHeader(99, "Invalid")
+			default:
+				w.WriteHeader(gemini.StatusNotFound, "Not found")
+			}
+		}))
+	base := "gemini://" + addr
+	c := &gemini.Client{}
+
+	t.Log("checking a Gemini text response")
+
+	res, err := c.Get(base + "/text")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.Status != gemini.StatusSuccess || res.TLS == nil {
+		t.Errorf("Expected success over TLS, got: %+v", res)
+	}
+
+	if typ, _ := res.MediaType(); typ != gemini.GeminiType {
+		t.Errorf("Expected %s, got: %s", gemini.GeminiType, typ)
+	}
+
+	if res.Charset() != "iso-8859-1" || res.Lang() != "fr" {
+		t.Errorf("Expected charset iso-8859-1 and lang fr, got: %s %s",
+			res.Charset(), res.Lang())
+	}
+
+	s, err := res.Scanner()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var lines []string
+
+	for s.Scan() {
+		lines = append(lines, string(s.Bytes()))
+	}
+
+	expected := "# Café\n=> / Accueil"
+	if strings.Join(lines, "\n") != expected {
+		t.Errorf("Expected lines %q, got: %q", expected, lines)
+	}
+
+	t.Log("checking redirects")
+
+	res, err = c.Get(base + "/moved")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Status != gemini.StatusSuccess || res.URL.Path != "/text" {
+		t.Errorf("Expected redirect to /text, got: %d %s",
+			res.Status, res.URL)
+	}
+
+	res.Body.Close()
+
+	if _, err := c.Get(base + "/loop"); !errors.Is(err,
+		gemini.ErrTooManyRedirects) {
+		t.Errorf("Expected ErrTooManyRedirects, got: %v", err)
+	}
+
+	nc := &gemini.Client{MaxRedirects: -1}
+	if res, err := nc.Get(base + "/moved"); err != nil ||
+		res.Status != gemini.StatusPermanentRedirect || res.Meta != "text" {
+		t.Errorf("Expected redirect not followed, got: %+v, %v", res, err)
+	}
+
+	if res, err := c.Get(base + "/web"); err != nil ||
+		res.Status != gemini.StatusRedirect {
+		t.Errorf("Expected redirect to the web returned, got: %+v, %v",
+			res, err)
+	}
+
+	t.Log("checking other responses")
+
+	res, err = c.Get(base + "/nope")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b, _ := ioutil.ReadAll(res.Body); res.Status != gemini.StatusNotFound ||
+		res.Meta != "Not found" || len(b) != 0 {
+		t.Errorf("Expected 51 Not found without body, got: %+v, %q", res, b)
+	}
+
+	if _, err := res.Scanner(); !errors.Is(err, gemini.ErrNotGemini) {
+		t.Errorf("Expected ErrNotGemini, got: %v", err)
+	}
+
+	res, err = c.Get(base + "/plain")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := res.Scanner(); !errors.Is(err, gemini.ErrNotGemini) {
+		t.Errorf("Expected ErrNotGemini, got: %v", err)
+	}
+
+	res.Body.Close()
+
+	res, err = c.Get(base + "/koi8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := res.Scanner(); !errors.Is(err,
+		gmitxt.ErrUnsupportedCharset) {
+		t.Errorf("Expected ErrUnsupportedCharset, got: %v", err)
+	}
+
+	res.Body.Close()
+
+	if _, err := c.Get(base + "/invalid"); !errors.Is(err,
+		gemini.ErrInvalidResponse) {
+		t.Errorf("Expected ErrInvalidResponse, got: %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// Nothing listens on the address once the listener is closed.
+	addr := l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		url string
+		err string
+	}{
+		{"%zz", "problem parsing URL"},
+		{"https://example.org/", "unsupported scheme: https"},
+		{"gemini://example.org/" + strings.Repeat("a", 1024),
+			"request is too long"},
+		{"gemini://" + addr + "/", "problem connecting to " + addr},
+	}
+
+	c := &gemini.Client{Timeout: time.Second}
+
+	for _, test := range tests {
+		if _, err := c.Get(test.url); err == nil ||
+			!strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error %q, got: %v", test.err, err)
+		}
+	}
+
+	t.Log("checking a connection refused by Control")
+
+	errRefused := errors.New("refused")
+	c.Control = func(network, address string, _ syscall.RawConn) error {
+		if network != "tcp4" || address != addr {
+			t.Errorf("Expected tcp4 %s, got: %s %s", addr, network, address)
+		}
+
+		return errRefused
+	}
+
+	if _, err := c.Get("gemini://" + addr + "/"); !errors.Is(err,
+		errRefused) {
+		t.Errorf("Expected refused error, got: %v", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	addr := stall(t, "20 text/gemini\r\n# Partial\n")
+	c := &gemini.Client{Timeout: time.Minute}
+
+	t.Log("checking a context done before the response")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u, _ := url.Parse("gemini://" + addr + "/")
+
+	if _, err := c.DoContext(ctx, u); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+
+	t.Log("checking a context done while reading the body")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := c.DoContext(ctx, u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	b := make([]byte, len("# Partial\n"))
+	if _, err := io.ReadFull(res.Body, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := ioutil.ReadAll(res.Body); err == nil {
+		t.Error("Expected an error reading the body after the context is done")
+	}
+
+	t.Log("checking a context done before the response header")
+
+	ctx, cancel = context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+
+	addr = stall(t, "")
+	u, _ = url.Parse("gemini://" + addr + "/")
+
+	if _, err := c.DoContext(ctx, u); !errors.Is(err,
+		context.DeadlineExceeded) {
+		t.Errorf("Expected deadline error, got: %v", err)
+	}
+}
+
+// stall starts a TLS server on a local address, which is returned, that
+// writes the response to requests and then stalls until the test ends.
+func stall(t *testing.T, response string) string {
+	t.Helper()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig(t))
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		close(done)
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				if _, err := gemini.ReadRequest(
+					bufio.NewReader(conn)); err == nil {
+					io.WriteString(conn, response) // nolint: errcheck
+				}
+
+				<-done
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestClientCertificates(t *testing.T) {
+	config := tlsConfig(t)
+	config.ClientAuth = tls.RequestClientCert
+
+	addr := start(t, &gemini.Server{
+		Handler: gemini.HandlerFunc(
+			func(w gemini.ResponseWriter, r *gemini.Request) {
+				if len(r.TLS.PeerCertificates) == 0 {
+					w.WriteHeader(gemini.StatusCertificateRequired,
+						"Certificate required")
+
+					return
+				}
+
+				w.WriteHeader(gemini.StatusSuccess,
+					r.TLS.PeerCertificates[0].Subject.CommonName)
+			}),
+		TLSConfig: config,
+	})
+	url := "gemini://" + addr + "/"
+
+	res, err := (&gemini.Client{}).Get(url)
+	if err != nil || res.Status != gemini.StatusCertificateRequired {
+		t.Errorf("Expected certificate required, got: %+v, %v", res, err)
+	}
+
+	client := tlsConfig(t)
+	c := &gemini.Client{Certificates: client.Certificates}
+
+	res, err = c.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.Status != gemini.StatusSuccess || res.Meta != "localhost" {
+		t.Errorf("Expected the client certificate, got: %+v", res)
+	}
+}
+
+func TestClientKnownHosts(t *testing.T) {
+	addr := serve(t, &gemini.FileServer{Dir: testutil.TempDir(t, nil)})
+	url := "gemini://" + addr + "/"
+	name := filepath.Join(testutil.TempDir(t, nil), "known_hosts")
+
+	hosts, err := gemini.LoadKnownHosts(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := &gemini.Client{KnownHosts: hosts}
+
+	res, err := c.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res.Body.Close()
+
+	fp, expires, ok := hosts.Lookup(addr)
+	if !ok || fp != gemini.Fingerprint(res.TLS.PeerCertificates[0]) {
+		t.Errorf("Expected the certificate to be trusted, got: %q", fp)
+	}
+
+	t.Log("checking the certificate is trusted after loading the file")
+
+	if hosts, err = gemini.LoadKnownHosts(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lfp, lexpires, _ := hosts.Lookup(addr); lfp != fp ||
+		!lexpires.Equal(expires) {
+		t.Errorf("Expected %s %v, got: %s %v", fp, expires, lfp, lexpires)
+	}
+
+	c.KnownHosts = hosts
+
+	if _, err := c.Get(url); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	t.Log("checking a certificate that does not match")
+
+	other := "SHA256:00"
+	writeFile(t, name, fmt.Sprintf("# comment\n\n%s %s %s\n", addr, other,
+		time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+
+	if c.KnownHosts, err = gemini.LoadKnownHosts(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get(url); !errors.Is(err, gemini.ErrCertificateMismatch) {
+		t.Errorf("Expected ErrCertificateMismatch, got: %v", err)
+	}
+
+	t.Log("checking an expired certificate is replaced")
+
+	writeFile(t, name, fmt.Sprintf("%s %s %s\n", addr, other,
+		time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)))
+
+	if c.KnownHosts, err = gemini.LoadKnownHosts(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get(url); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if hosts, err = gemini.LoadKnownHosts(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lfp, _, _ := hosts.Lookup(addr); lfp != fp {
+		t.Errorf("Expected %s, got: %s", fp, lfp)
+	}
+}
+
+func TestClientMemoryHosts(t *testing.T) {
+	var cert atomic.Value
+
+	cert.Store(&tlsConfig(t).Certificates[0])
+
+	addr := start(t, &gemini.Server{
+		Handler: &gemini.FileServer{Dir: testutil.TempDir(t, nil)},
+		TLSConfig: &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate,
+				error) {
+				return cert.Load().(*tls.Certificate), nil
+			},
+		},
+	})
+	url := "gemini://" + addr + "/"
+
+	var c gemini.Client
+
+	res, err := c.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res.Body.Close()
+
+	t.Log("checking another client trusts the same certificate")
+
+	cert.Store(&tlsConfig(t).Certificates[0])
+
+	if _, err := (&gemini.Client{}).Get(url); !errors.Is(err,
+		gemini.ErrCertificateMismatch) {
+		t.Errorf("Expected ErrCertificateMismatch, got: %v", err)
+	}
+}
+
+func TestLoadKnownHosts(t *testing.T) {
+	hosts, err := gemini.LoadKnownHosts("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, ok := hosts.Lookup("example.org:1965"); ok {
+		t.Error("Expected an empty store")
+	}
+
+	dir := testutil.TempDir(t, map[string]string{
+		"fields":      "example.org:1965 SHA256:00\n",
+		"time":        "example.org:1965 SHA256:00 tomorrow\n",
+		"directory/x": "",
+	})
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"fields", "invalid known hosts: " +
+			filepath.Join(dir, "fields") + ":1: expected 3 fields"},
+		{"time", "invalid known hosts: " +
+			filepath.Join(dir, "time") + ":1: invalid time: tomorrow"},
+		{"directory", "problem reading known hosts"},
+	}
+
+	for _, test := range tests {
+		_, err := gemini.LoadKnownHosts(filepath.Join(dir, test.name))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error %q, got: %v", test.err, err)
+		}
+	}
+}
+
+// writeFile writes the text to the named file.
+func writeFile(t *testing.T, name, text string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(name, []byte(text), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", name, err)
+	}
+}
@@ -0,0 +1,184 @@
+package gemini
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+)
+
+// FileServer is a Handler that serves the files in a directory.  A directory
+// is served by its index.gmi file, or by a listing of its files generated as
+// Gemini text.  A request for a directory without a trailing slash is
+// redirected to the path with a slash.  Hidden files and directories, which
+// start with a dot, are not served, as they are not listed.
+type FileServer struct {
+	// Dir is the directory of the files.
+	Dir string
+	// Lang is the language of the Gemini text files, such as "en" or
+	// "en,fr".  It is sent as the lang parameter of the MIME type.
+	Lang string
+}
+
+// ServeGemini serves the file or directory at the path of the request.
+func (fs *FileServer) ServeGemini(w ResponseWriter, r *Request) {
+	p := path.Clean("/" + r.URL.Path)
+	name := filepath.Join(fs.Dir, filepath.FromSlash(p))
+
+	info, err := os.Stat(name)
+	if err != nil || hidden(p) {
+		w.WriteHeader(StatusNotFound, "Not found")
+
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			u := *r.URL
+			u.Path += "/"
+			u.RawPath = ""
+			w.WriteHeader(StatusPermanentRedirect, u.String())
+
+			return
+		}
+
+		if _, err := os.Stat(filepath.Join(name, capsule.Index)); err != nil {
+			fs.serveDir(w, name, p)
+
+			return
+		}
+
+		name = filepath.Join(name, capsule.Index)
+	}
+
+	fs.serveFile(w, name)
+}
+
+// hidden returns whether a name of the clean path p starts with a dot, such
+// as in /.git/config.
+func hidden(p string) bool {
+	for _, n := range strings.Split(p, "/") {
+		if strings.HasPrefix(n, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveFile serves the named file with the MIME type of its extension.
+func (fs *FileServer) serveFile(w ResponseWriter, name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		w.WriteHeader(StatusNotFound, "Not found")
+
+		return
+	}
+	defer f.Close()
+
+	w.WriteHeader(StatusSuccess, fs.mimeType(name))
+
+	// The client gets a partial body if the connection fails.
+	_, _ = io.Copy(w, bufio.NewReader(f))
+}
+
+// serveDir serves a listing of the files in the named directory with the path
+// p.
+func (fs *FileServer) serveDir(w ResponseWriter, name, p string) {
+	f, err := os.Open(name)
+	if err != nil {
+		w.WriteHeader(StatusNotFound, "Not found")
+
+		return
+	}
+
+	infos, err := f.Readdir(-1)
+	f.Close()
+
+	if err != nil {
+		w.WriteHeader(StatusTemporaryFailure, "Directory cannot be read")
+
+		return
+	}
+
+	w.WriteHeader(StatusSuccess, fs.mimeType(capsule.Index))
+
+	// The client gets a partial body if the connection fails.
+	_ = Listing(w, p, infos)
+}
+
+// mimeType returns the MIME type of the named file by its extension.
+func (fs *FileServer) mimeType(name string) string {
+	switch ext := filepath.Ext(name); ext {
+	case capsule.Ext, ".gemini":
+		if fs.Lang != "" {
+			return GeminiType + "; lang=" + fs.Lang
+		}
+
+		return GeminiType
+	default:
+		if typ := mime.TypeByExtension(ext); typ != "" {
+			return typ
+		}
+
+		return "application/octet-stream"
+	}
+}
+
+// Listing writes a listing of the files of the directory with the path p as
+// Gemini text, with a heading of the path and a link to each file.  Links to
+// directories end with a slash.  Hidden files, which start with a dot, are not
+// listed.
+func Listing(w io.Writer, p string, infos []os.FileInfo) error {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	lines := []gmitxt.Line{
+		{Type: gmitxt.Head1, Text: []byte("Index of " + p)},
+		{Type: gmitxt.Text},
+	}
+
+	if p != "/" {
+		lines = append(lines, gmitxt.Line{
+			Type: gmitxt.Link, URL: []byte("../"), Text: []byte("../"),
+		})
+	}
+
+	for _, info := range infos {
+		n := info.Name()
+		if strings.HasPrefix(n, ".") {
+			continue
+		}
+
+		if info.IsDir() {
+			n += "/"
+		}
+
+		// The name is escaped as a relative path, so a name with a colon is
+		// not taken for a scheme.
+		u := (&url.URL{Path: "./" + n}).String()
+
+		lines = append(lines, gmitxt.Line{
+			Type: gmitxt.Link, URL: []byte(u), Text: []byte(n),
+		})
+	}
+
+	gw := gmitxt.NewWriter(w)
+
+	for _, line := range lines {
+		gw.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	gw.Flush()
+
+	return gw.Error() // nolint: wrapcheck // error from the writer
+}
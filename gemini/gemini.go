@@ -0,0 +1,158 @@
+// Package gemini implements a server and a client of the Gemini protocol.
+//
+// A Gemini request is a single line with an absolute URL, and a response is a
+// header line with a two-digit status code and a meta string, followed by the
+// body for successful responses.  Both run over TLS, where servers commonly
+// use self-signed certificates.
+//
+//     srv := &gemini.Server{
+//         Addr:      "localhost:1965",
+//         Handler:   &gemini.FileServer{Dir: "capsule"},
+//         TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+//     }
+//     err := srv.ListenAndServe()
+//
+// A client trusts the certificate a server first presents and checks it on
+// later requests, which is known as TOFU (trust on first use).
+//
+//     hosts, err := gemini.LoadKnownHosts("known_hosts")
+//     client := &gemini.Client{KnownHosts: hosts}
+//     res, err := client.Get("gemini://example.org/")
+//     defer res.Body.Close()
+//     s, err := res.Scanner()
+//
+// See the specification for details:
+//
+//     https://gemini.circumlunar.space/docs/specification.html
+package gemini
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Status codes of the Gemini protocol.
+const (
+	StatusInput               = 10
+	StatusSensitiveInput      = 11
+	StatusSuccess             = 20
+	StatusRedirect            = 30
+	StatusPermanentRedirect   = 31
+	StatusTemporaryFailure    = 40
+	StatusServerUnavailable   = 41
+	StatusCGIError            = 42
+	StatusProxyError          = 43
+	StatusSlowDown            = 44
+	StatusPermanentFailure    = 50
+	StatusNotFound            = 51
+	StatusGone                = 52
+	StatusProxyRequestRefused = 53
+	StatusBadRequest          = 59
+	StatusCertificateRequired = 60
+	StatusCertificateNotAuth  = 61
+	StatusCertificateNotValid = 62
+)
+
+// MaxRequestLength is the most bytes of the URL in a request, not including
+// the CRLF that ends it.
+const MaxRequestLength = 1024
+
+// GeminiType is the MIME type of Gemini text.
+const GeminiType = "text/gemini"
+
+var (
+	// ErrRequestTooLong is returned when a request is longer than the
+	// MaxRequestLength.
+	ErrRequestTooLong = errors.New("request is too long")
+	// ErrInvalidRequest is returned when a request is not an absolute URL
+	// ended by a CRLF.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrInvalidResponse is returned when a response header is not a
+	// two-digit status code and a meta ended by a CRLF.
+	ErrInvalidResponse = errors.New("invalid response")
+)
+
+// MaxMetaLength is the most bytes of the meta in a response header.
+const MaxMetaLength = 1024
+
+// ReadRequest reads a request line and returns its URL.  The URL must be
+// absolute and the line must end with a CRLF.
+func ReadRequest(r *bufio.Reader) (*url.URL, error) {
+	var line []byte
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("problem reading request: %w", err)
+		}
+
+		if b == '\n' {
+			break
+		}
+
+		// The CR of the CRLF is also counted.
+		if len(line) > MaxRequestLength {
+			return nil, ErrRequestTooLong
+		}
+
+		line = append(line, b)
+	}
+
+	if len(line) == 0 || line[len(line)-1] != '\r' {
+		return nil, ErrInvalidRequest
+	}
+
+	u, err := url.Parse(string(line[:len(line)-1]))
+	if err != nil || !u.IsAbs() || u.Host == "" || u.User != nil {
+		return nil, ErrInvalidRequest
+	}
+
+	return u, nil
+}
+
+// ReadResponseHeader reads a response header and returns its status code and
+// meta.  The status code must be two digits from 10 to 69, followed by a
+// space and the meta, and the line must end with a CRLF.  The space may be
+// left out when the meta is empty.
+func ReadResponseHeader(r *bufio.Reader) (int, string, error) {
+	var line []byte
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, "", fmt.Errorf("problem reading response: %w", err)
+		}
+
+		if b == '\n' {
+			break
+		}
+
+		// The status code, the space and the CR are also counted.
+		if len(line) > MaxMetaLength+3 {
+			return 0, "", ErrInvalidResponse
+		}
+
+		line = append(line, b)
+	}
+
+	if len(line) < 3 || line[len(line)-1] != '\r' {
+		return 0, "", ErrInvalidResponse
+	}
+
+	line = line[:len(line)-1]
+
+	if line[0] < '1' || line[0] > '6' || line[1] < '0' || line[1] > '9' ||
+		len(line) > 2 && line[2] != ' ' {
+		return 0, "", ErrInvalidResponse
+	}
+
+	status := int(line[0]-'0')*10 + int(line[1]-'0')
+
+	if len(line) <= 3 {
+		return status, "", nil
+	}
+
+	return status, string(line[3:]), nil
+}
@@ -0,0 +1,89 @@
+package gemini_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+)
+
+func TestReadRequest(t *testing.T) {
+	long := "gemini://example.org/" + strings.Repeat("a", 1003)
+
+	tests := []struct {
+		input string
+		url   string
+		err   error
+	}{
+		{"gemini://example.org/\r\n", "gemini://example.org/", nil},
+		{
+			"gemini://example.org:1965/a%20b?q\r\nrest",
+			"gemini://example.org:1965/a%20b?q", nil,
+		},
+		{"https://example.org/\r\n", "https://example.org/", nil},
+		{long + "\r\n", long, nil},
+		{long + "a\r\n", "", gemini.ErrRequestTooLong},
+		{"gemini://example.org/\n", "", gemini.ErrInvalidRequest},
+		{"\r\n", "", gemini.ErrInvalidRequest},
+		{"/path\r\n", "", gemini.ErrInvalidRequest},
+		{"gemini:///path\r\n", "", gemini.ErrInvalidRequest},
+		{"gemini://user@example.org/\r\n", "", gemini.ErrInvalidRequest},
+		{"gemini://example.org/%zz\r\n", "", gemini.ErrInvalidRequest},
+		{"gemini://example.org/", "", io.EOF},
+	}
+
+	for _, test := range tests {
+		u, err := gemini.ReadRequest(bufio.NewReader(
+			strings.NewReader(test.input)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("Expected error `%v` for %q, got: %v",
+				test.err, test.input, err)
+		}
+
+		if err == nil && u.String() != test.url {
+			t.Errorf("Expected URL %q, got: %q", test.url, u)
+		}
+	}
+}
+
+func TestReadResponseHeader(t *testing.T) {
+	long := strings.Repeat("a", gemini.MaxMetaLength)
+
+	tests := []struct {
+		input  string
+		status int
+		meta   string
+		err    error
+	}{
+		{"20 text/gemini\r\n# Body", 20, "text/gemini", nil},
+		{"51 Not found\r\n", 51, "Not found", nil},
+		{"20\r\n", 20, "", nil},
+		{"20 \r\n", 20, "", nil},
+		{"10 " + long + "\r\n", 10, long, nil},
+		{"10 " + long + "a\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"20 text/gemini\n", 0, "", gemini.ErrInvalidResponse},
+		{"2\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"70 Nope\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"0a Nope\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"2a Nope\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"20text/gemini\r\n", 0, "", gemini.ErrInvalidResponse},
+		{"20 text/gemini", 0, "", io.EOF},
+	}
+
+	for _, test := range tests {
+		status, meta, err := gemini.ReadResponseHeader(bufio.NewReader(
+			strings.NewReader(test.input)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("Expected error `%v` for %q, got: %v",
+				test.err, test.input, err)
+		}
+
+		if status != test.status || meta != test.meta {
+			t.Errorf("Expected %d %q for %q, got: %d %q",
+				test.status, test.meta, test.input, status, meta)
+		}
+	}
+}
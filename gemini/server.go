@@ -0,0 +1,252 @@
+package gemini
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by the Serve and ListenAndServe methods of a
+// Server after it is closed.
+var ErrServerClosed = errors.New("gemini: server closed")
+
+// DefaultTimeout is the time a Server waits for a request when it has no
+// Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Request is a request received by a server.
+type Request struct {
+	// URL is the URL of the request.
+	URL *url.URL
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+	// TLS is the state of the TLS connection, with the certificates of the
+	// client if it sent any.
+	TLS *tls.ConnectionState
+}
+
+// ResponseWriter writes the response to a request.
+type ResponseWriter interface {
+	// WriteHeader writes the response header with the status code and meta,
+	// such as the MIME type of the body or the error message.  Only the
+	// first call writes the header.
+	WriteHeader(status int, meta string)
+	// Write writes the body of the response.  If the header was not
+	// written, it is written with StatusSuccess and GeminiType first.
+	Write(b []byte) (int, error)
+}
+
+// Handler responds to a request.
+type Handler interface {
+	ServeGemini(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc is a function that is used as a Handler.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeGemini calls f(w, r).
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// Server serves Gemini requests over TLS.
+type Server struct {
+	// Addr is the TCP address to listen on.  If it is empty, ":1965" is
+	// used.
+	Addr string
+	// Handler responds to requests.
+	Handler Handler
+	// TLSConfig is the TLS configuration, which needs a certificate.
+	TLSConfig *tls.Config
+	// Timeout is the most time to read a request and write its response.
+	// If it is zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ListenAndServe listens on the TCP address of the server and serves the
+// requests it receives.  It always returns an error, which is ErrServerClosed
+// after the server is closed.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":1965"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("problem listening: %w", err)
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and serves their requests over
+// TLS.  It always returns an error, which is ErrServerClosed after the server
+// is closed.  The listener is closed when Serve returns.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		l.Close()
+
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+
+	tl := tls.NewListener(l, s.TLSConfig)
+
+	for {
+		conn, err := tl.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			return fmt.Errorf("problem accepting connection: %w", err)
+		}
+
+		s.wg.Add(1)
+
+		go s.serve(conn)
+	}
+}
+
+// Close closes the listeners of the server and waits for the requests being
+// served to end.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+
+	var err error
+
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	return err
+}
+
+// track adds the listener to the server, unless the server was closed.
+func (s *Server) track(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]bool{}
+	}
+
+	s.listeners[l] = true
+
+	return true
+}
+
+// untrack closes the listener and removes it from the server.
+func (s *Server) untrack(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l.Close()
+	delete(s.listeners, l)
+}
+
+// isClosed returns whether the server was closed.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// serve serves the request of a connection.
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	// The error is returned by the reads and writes after the deadline.
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	w := &response{w: bufio.NewWriter(conn)}
+	defer w.w.Flush()
+
+	u, err := ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		w.WriteHeader(StatusBadRequest, "Bad request")
+
+		return
+	}
+
+	req := &Request{URL: u, RemoteAddr: conn.RemoteAddr().String()}
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		req.TLS = &state
+	}
+
+	if u.Scheme != "gemini" {
+		w.WriteHeader(StatusProxyRequestRefused, "Proxy request refused")
+
+		return
+	}
+
+	s.Handler.ServeGemini(w, req)
+}
+
+// response is the ResponseWriter of a connection.
+type response struct {
+	w      *bufio.Writer
+	header bool // whether the header was written
+	body   bool // whether a body can be written
+}
+
+func (w *response) WriteHeader(status int, meta string) {
+	if w.header {
+		return
+	}
+
+	w.header = true
+	w.body = status/10 == StatusSuccess/10
+
+	// A meta with a line break would end the header early.
+	meta = strings.NewReplacer("\r", "", "\n", "").Replace(meta)
+
+	fmt.Fprintf(w.w, "%02d %s\r\n", status, meta)
+}
+
+func (w *response) Write(b []byte) (int, error) {
+	if !w.header {
+		w.WriteHeader(StatusSuccess, GeminiType)
+	}
+
+	if !w.body {
+		return 0, errNoBody
+	}
+
+	return w.w.Write(b) // nolint: wrapcheck // error of the connection
+}
+
+// errNoBody is returned when a body is written for a response that is not
+// successful.
+var errNoBody = errors.New("gemini: response status does not allow a body")
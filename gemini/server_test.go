@@ -0,0 +1,281 @@
+package gemini_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestServer(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi":      "# Home\n",
+		"image.png":      "png",
+		"blog/a b.gmi":   "# A B\n",
+		"blog/.d.gmi":    "# Draft\n",
+		"blog/old/x.gmi": "",
+		"docs/index.gmi": "# Docs\n",
+	})
+	addr := serve(t, &gemini.FileServer{Dir: dir, Lang: "en"})
+
+	tests := []struct {
+		request  string
+		response string
+	}{
+		{"gemini://localhost/", "20 text/gemini; lang=en\r\n# Home\n"},
+		{"gemini://localhost/image.png", "20 image/png\r\npng"},
+		{"gemini://localhost/docs/", "20 text/gemini; lang=en\r\n# Docs\n"},
+		{"gemini://localhost/docs", "31 gemini://localhost/docs/\r\n"},
+		{"gemini://localhost/blog/", "20 text/gemini; lang=en\r\n" +
+			"# Index of /blog\n\n=> ../ ../\n=> ./a%20b.gmi a b.gmi\n" +
+			"=> ./old/ old/\n"},
+		{"gemini://localhost/nope.gmi", "51 Not found\r\n"},
+		{"gemini://localhost/../index.gmi",
+			"20 text/gemini; lang=en\r\n# Home\n"},
+		{"https://localhost/", "53 Proxy request refused\r\n"},
+		{"/index.gmi", "59 Bad request\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Logf("checking %s", test.request)
+
+		res := request(t, addr, test.request+"\r\n")
+		if res != test.response {
+			t.Errorf("Expected response %q, got: %q", test.response, res)
+		}
+	}
+
+	t.Log("checking a listing of the root")
+
+	if err := os.Remove(filepath.Join(dir, "index.gmi")); err != nil {
+		t.Fatalf("could not remove index.gmi: %v", err)
+	}
+
+	expected := "20 text/gemini; lang=en\r\n# Index of /\n\n" +
+		"=> ./blog/ blog/\n=> ./docs/ docs/\n=> ./image.png image.png\n"
+	if res := request(t, addr, "gemini://localhost/\r\n"); res != expected {
+		t.Errorf("Expected response %q, got: %q", expected, res)
+	}
+}
+
+func TestServerHidden(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		".env":                     "SECRET=1\n",
+		".git/config":              "[core]\n",
+		".well-known/security.txt": "Contact: kiba\n",
+		"blog/.draft.gmi":          "# Draft\n",
+	})
+	addr := serve(t, &gemini.FileServer{Dir: dir})
+
+	for _, p := range []string{
+		"/.env", "/.git/config", "/.git/", "/.well-known/security.txt",
+		"/blog/.draft.gmi", "/blog/../.env",
+	} {
+		t.Logf("checking %s", p)
+
+		expected := "51 Not found\r\n"
+		if res := request(t, addr, "gemini://localhost"+p+"\r\n"); res !=
+			expected {
+			t.Errorf("Expected response %q, got: %q", expected, res)
+		}
+	}
+}
+
+func TestServerResponse(t *testing.T) {
+	errs := make(chan error, 1)
+	addr := serve(t, gemini.HandlerFunc(
+		func(w gemini.ResponseWriter, r *gemini.Request) {
+			if r.TLS == nil || r.RemoteAddr == "" {
+				t.Errorf("Expected TLS state and remote address, got: %+v", r)
+			}
+
+			switch r.URL.Path {
+			case "/body":
+				_, err := w.Write([]byte("# Body\n"))
+				errs <- err
+			case "/fail":
+				w.WriteHeader(gemini.StatusTemporaryFailure, "Oops\r\nbody")
+				w.WriteHeader(gemini.StatusSuccess, gemini.GeminiType)
+				_, err := w.Write([]byte("# Body\n"))
+				errs <- err
+			}
+		}))
+
+	expected := "20 text/gemini\r\n# Body\n"
+	if res := request(t, addr, "gemini://localhost/body\r\n"); res != expected {
+		t.Errorf("Expected response %q, got: %q", expected, res)
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected = "40 Oopsbody\r\n"
+	if res := request(t, addr, "gemini://localhost/fail\r\n"); res != expected {
+		t.Errorf("Expected response %q, got: %q", expected, res)
+	}
+
+	if err := <-errs; err == nil {
+		t.Error("Expected an error writing the body of a failure")
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	srv := &gemini.Server{
+		Handler:   &gemini.FileServer{Dir: "."},
+		TLSConfig: tlsConfig(t),
+		Timeout:   50 * time.Millisecond,
+	}
+	addr := start(t, srv)
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	// The server closes the connection when the request is not sent in
+	// time, so the read ends before the deadline of the client.
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := ioutil.ReadAll(conn)
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		t.Errorf("Expected the server to close the connection, got: %v", err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv := &gemini.Server{
+		Addr:      "127.0.0.1:0",
+		Handler:   &gemini.FileServer{Dir: "."},
+		TLSConfig: tlsConfig(t),
+	}
+	errs := make(chan error, 1)
+
+	go func() { errs <- srv.ListenAndServe() }()
+
+	// The server may be closed before it listens, so Close is repeated until
+	// ListenAndServe returns.
+	for done := false; !done; {
+		if err := srv.Close(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, gemini.ErrServerClosed) {
+				t.Errorf("Expected ErrServerClosed, got: %v", err)
+			}
+
+			done = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := srv.Serve(l); !errors.Is(err, gemini.ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got: %v", err)
+	}
+
+	srv = &gemini.Server{Addr: "256.0.0.1:0"}
+	if err := srv.ListenAndServe(); err == nil {
+		t.Error("Expected an error listening on an invalid address")
+	}
+}
+
+// serve starts a server with the handler on a local address, which is
+// returned.  The server is closed when the test ends.
+func serve(t *testing.T, h gemini.Handler) string {
+	t.Helper()
+
+	return start(t, &gemini.Server{Handler: h, TLSConfig: tlsConfig(t)})
+}
+
+// start starts the server on a local address, which is returned.  The server
+// is closed when the test ends.
+func start(t *testing.T, srv *gemini.Server) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	errs := make(chan error, 1)
+
+	go func() { errs <- srv.Serve(l) }()
+
+	t.Cleanup(func() {
+		srv.Close()
+
+		if err := <-errs; !errors.Is(err, gemini.ErrServerClosed) {
+			t.Errorf("Expected ErrServerClosed, got: %v", err)
+		}
+	})
+
+	return l.Addr().String()
+}
+
+// tlsConfig returns a TLS configuration with a new certificate.
+func tlsConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	certPEM, keyPEM, err := gemini.NewCertificate([]string{"localhost"},
+		time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not load certificate: %v", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
+// dial connects to the server at the address.
+func dial(t *testing.T, addr string) *tls.Conn {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true, // nolint: gosec // self-signed
+	})
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+
+	return conn
+}
+
+// request sends the request to the server at the address and returns the
+// response.
+func request(t *testing.T, addr, req string) string {
+	t.Helper()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("could not send request: %v", err)
+	}
+
+	res, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("could not read response: %v", err)
+	}
+
+	return string(res)
+}
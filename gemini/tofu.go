@@ -0,0 +1,172 @@
+package gemini
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCertificateMismatch is returned when a server presents a
+	// certificate that does not match the one trusted for its host, which
+	// has not expired.
+	ErrCertificateMismatch = errors.New("certificate does not match")
+	// ErrInvalidKnownHosts is returned when a known hosts file cannot be
+	// parsed.
+	ErrInvalidKnownHosts = errors.New("invalid known hosts")
+)
+
+// KnownHosts is a store of the certificates trusted for hosts, so the
+// certificate a server first presents is trusted and checked on later
+// requests.  A certificate is trusted by its fingerprint until it expires,
+// when a new certificate is trusted in its place.
+//
+// The store is kept in a file with a line for each host, its fingerprint and
+// the time its certificate expires:
+//
+//     example.org:1965 SHA256:1f3b...9c0e 2026-01-02T15:04:05Z
+//
+// Lines starting with a # are comments.
+type KnownHosts struct {
+	mu    sync.Mutex
+	file  string
+	hosts map[string]knownHost
+}
+
+// knownHost is the certificate trusted for a host.
+type knownHost struct {
+	fingerprint string
+	expires     time.Time
+}
+
+// LoadKnownHosts loads the store of trusted certificates from the named file.
+// If the file does not exist, the store is empty.  Certificates trusted by
+// the store are added to the file, whose directory is created if needed.  If
+// the name is empty, the store is kept in memory only.
+func LoadKnownHosts(name string) (*KnownHosts, error) {
+	k := &KnownHosts{file: name, hosts: map[string]knownHost{}}
+
+	if name == "" {
+		return k, nil
+	}
+
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return k, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("problem reading known hosts: %w", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+
+	for num := 1; s.Scan(); num++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: %s:%d: expected 3 fields",
+				ErrInvalidKnownHosts, name, num)
+		}
+
+		expires, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: invalid time: %s",
+				ErrInvalidKnownHosts, name, num, fields[2])
+		}
+
+		// A later line for a host replaces the earlier one.
+		k.hosts[fields[0]] = knownHost{fields[1], expires}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("problem reading known hosts: %w", err)
+	}
+
+	return k, nil
+}
+
+// Lookup returns the fingerprint of the certificate trusted for the host,
+// which includes the port, and the time the certificate expires.
+func (k *KnownHosts) Lookup(host string) (string, time.Time, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	h, ok := k.hosts[host]
+
+	return h.fingerprint, h.expires, ok
+}
+
+// Check checks the certificate presented by the host, which includes the
+// port.  If no certificate is trusted for the host, or the trusted one has
+// expired, the certificate is trusted and added to the store.  Otherwise it
+// returns ErrCertificateMismatch if the certificate does not match the
+// trusted one.
+func (k *KnownHosts) Check(host string, cert *x509.Certificate) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	fp := Fingerprint(cert)
+
+	h, ok := k.hosts[host]
+	if ok && h.fingerprint == fp {
+		return nil
+	}
+
+	if ok && time.Now().Before(h.expires) {
+		return fmt.Errorf("%w: %s presented %s, expected %s",
+			ErrCertificateMismatch, host, fp, h.fingerprint)
+	}
+
+	h = knownHost{fp, cert.NotAfter.UTC().Truncate(time.Second)}
+	k.hosts[host] = h
+
+	if k.file == "" {
+		return nil
+	}
+
+	return k.append(host, h)
+}
+
+// append appends the line of the host to the file of the store.
+func (k *KnownHosts) append(host string, h knownHost) error {
+	if err := os.MkdirAll(filepath.Dir(k.file), 0o700); err != nil {
+		return fmt.Errorf("problem writing known hosts: %w", err)
+	}
+
+	f, err := os.OpenFile(k.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("problem writing known hosts: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "%s %s %s\n", host, h.fingerprint,
+		h.expires.Format(time.RFC3339))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("problem writing known hosts: %w", err)
+	}
+
+	return nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate, as
+// "SHA256:" followed by the hex digest.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
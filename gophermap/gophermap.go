@@ -0,0 +1,297 @@
+// Package gophermap converts Gemini text to a gophermap, the menu format of
+// the Gopher protocol, and imports gophermaps back to Gemini text.
+//
+// A gophermap has a line for each item, with its type, display string,
+// selector, host and port separated by tabs:
+//
+//     1Blog	/blog/	example.org	70
+//
+// Lines of text, headings, lists and quotes become info lines (type i)
+// wrapped to a width, and preformatted text becomes info lines as it is.
+// Links become items of the type of their target, such as 1 for gopher
+// directories, 0 for text files, g or I for images, and h with a URL:
+// selector for the web and Gemini.
+package gophermap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// DefaultWidth is the width info lines are wrapped to when the Options have
+// no Width.
+const DefaultWidth = 70
+
+// Item types of the Gopher protocol.
+const (
+	TypeText      = '0'
+	TypeDirectory = '1'
+	TypeError     = '3'
+	TypeBinary    = '9'
+	TypeGIF       = 'g'
+	TypeImage     = 'I'
+	TypeHTML      = 'h'
+	TypeInfo      = 'i'
+)
+
+// urlPrefix starts the selector of an item with a URL of another protocol.
+const urlPrefix = "URL:"
+
+// infoFields are the selector, host and port of info lines, which are not
+// used by clients.
+const infoFields = "\tfake\t(NULL)\t0"
+
+// Options are the options of a Writer.
+type Options struct {
+	// Host and Port are the host and port of the items on the server of the
+	// gophermap, which are written for links without a host.  If Host is
+	// empty, they are left out, so the server fills them in.
+	Host string
+	Port int
+	// Width is the width in characters that info lines are wrapped to.  If it
+	// is zero, DefaultWidth is used.
+	Width int
+}
+
+// Writer writes lines of Gemini text as a gophermap.
+//
+// As returned by NewWriter, a Writer writes lines with a buffer.  The client
+// should call the Flush method to guarantee all data has been forwarded to
+// the underlying io.Writer.  Any errors that occurred should be checked by
+// calling the Error method.
+type Writer struct {
+	w    *bufio.Writer
+	opts Options
+}
+
+// NewWriter returns a new Writer that writes to w with the options.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	if opts.Width == 0 {
+		opts.Width = DefaultWidth
+	}
+
+	return &Writer{w: bufio.NewWriter(w), opts: opts}
+}
+
+// Write writes a single line of Gemini text as gophermap lines.  The lines
+// that start and end preformatted text are not written.  If there was an
+// error, it is returned and can also be retrieved by the Error method.
+func (w *Writer) Write(line gmitxt.Line) error {
+	switch line.Type {
+	case gmitxt.Head1:
+		w.writeWrapped("# ", "# ", string(line.Text))
+	case gmitxt.Head2:
+		w.writeWrapped("## ", "## ", string(line.Text))
+	case gmitxt.Head3:
+		w.writeWrapped("### ", "### ", string(line.Text))
+	case gmitxt.Text:
+		w.writeWrapped("", "", string(line.Text))
+	case gmitxt.List:
+		w.writeWrapped("* ", "  ", string(line.Text))
+	case gmitxt.Quote:
+		w.writeWrapped("> ", "> ", string(line.Text))
+	case gmitxt.Link:
+		w.writeLink(string(line.URL), string(line.Text))
+	case gmitxt.PreBody:
+		w.writeInfo(expandTabs(string(line.Text)))
+	case gmitxt.PreStart, gmitxt.PreEnd:
+	}
+
+	return w.Error()
+}
+
+// writeInfo writes an info line with the text.
+func (w *Writer) writeInfo(text string) {
+	// The errors are checked by Error.
+	fmt.Fprintf(w.w, "%c%s%s\n", TypeInfo, text, infoFields)
+}
+
+// writeWrapped writes the text as info lines wrapped to the width.  The first
+// line starts with the prefix and the others with the indent.  Words longer
+// than the width are not broken.
+func (w *Writer) writeWrapped(prefix, indent, text string) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		w.writeInfo(strings.TrimRight(prefix, " "))
+
+		return
+	}
+
+	line := prefix + words[0]
+
+	for _, word := range words[1:] {
+		if utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) >
+			w.opts.Width {
+			w.writeInfo(line)
+			line = indent + word
+
+			continue
+		}
+
+		line += " " + word
+	}
+
+	w.writeInfo(line)
+}
+
+// writeLink writes the item of a link.  The display string is the URL when
+// the link has no text.
+func (w *Writer) writeLink(link, text string) {
+	display := strings.Join(strings.Fields(text), " ")
+	if display == "" {
+		display = link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		w.writeItem(TypeHTML, display, urlPrefix+link, "", 0)
+
+		return
+	}
+
+	switch {
+	case u.Scheme == "gopher":
+		typ, selector := byte(TypeDirectory), u.Path
+		if len(selector) > 1 {
+			typ, selector = selector[1], selector[2:]
+		}
+
+		port, _ := strconv.Atoi(u.Port())
+		if port == 0 {
+			port = 70
+		}
+
+		w.writeItem(typ, display, selector, u.Hostname(), port)
+	case u.Scheme != "" || u.Host != "":
+		w.writeItem(TypeHTML, display, urlPrefix+link, "", 0)
+	default:
+		w.writeItem(localType(u.Path), display, link, "", 0)
+	}
+}
+
+// writeItem writes the line of an item.  An item without a host is on the
+// server of the gophermap.
+func (w *Writer) writeItem(typ byte, display, selector, host string,
+	port int) {
+	if host == "" {
+		host, port = w.opts.Host, w.opts.Port
+	}
+
+	// The errors are checked by Error.
+	fmt.Fprintf(w.w, "%c%s\t%s", typ, display, noTabs(selector))
+
+	if host != "" {
+		fmt.Fprintf(w.w, "\t%s\t%d", host, port)
+	}
+
+	w.w.WriteByte('\n') // nolint: errcheck // checked by Error
+}
+
+// localType returns the item type of a file on the server of the gophermap
+// by the path of its link.
+func localType(p string) byte {
+	if p == "" || strings.HasSuffix(p, "/") {
+		return TypeDirectory
+	}
+
+	switch strings.ToLower(path.Ext(p)) {
+	case "", ".txt", ".gmi", ".gemini", ".md":
+		return TypeText
+	case ".gif":
+		return TypeGIF
+	case ".png", ".jpg", ".jpeg", ".webp", ".svg", ".bmp":
+		return TypeImage
+	case ".html", ".htm":
+		return TypeHTML
+	default:
+		return TypeBinary
+	}
+}
+
+// noTabs replaces the tabs in the selector, which separate the fields of a
+// line, with their escape.
+func noTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", "%09")
+}
+
+// expandTabs expands the tabs in the text to spaces with tab stops every 8
+// characters, as tabs separate the fields of a line.
+func expandTabs(text string) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+
+	var b strings.Builder
+
+	col := 0
+
+	for _, r := range text {
+		if r != '\t' {
+			b.WriteRune(r)
+			col++
+
+			continue
+		}
+
+		n := 8 - col%8
+		b.WriteString(strings.Repeat(" ", n))
+		col += n
+	}
+
+	return b.String()
+}
+
+// Flush writes any buffered data to the underlying io.Writer.  To check if an
+// error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.w.Flush() // nolint: errcheck // checked by Error
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+
+	return err // nolint: wrapcheck // error from the underlying io.Writer
+}
+
+// Render reads Gemini text from src and writes it to dst as a gophermap.
+func Render(dst io.Writer, src io.Reader, opts Options) error {
+	return RenderContext(context.Background(), dst, src, opts)
+}
+
+// RenderContext is like Render, but stops reading when the context is done,
+// and returns the error of the context.
+func RenderContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+	opts Options,
+) error {
+	s := gmitxt.NewScanner(src)
+	w := NewWriter(dst, opts)
+
+	for s.ScanContext(ctx) {
+		w.Write(s.Line()) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing gophermap: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package gophermap_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/gophermap"
+)
+
+func TestRender(t *testing.T) {
+	text := "# A heading\n" +
+		"\n" +
+		"Some text that is long enough to be wrapped to the next line.\n" +
+		"* A list item that is also long enough to wrap.\n" +
+		"> A quote that wraps.\n" +
+		"## Links\n" +
+		"=> /blog/ Blog\n" +
+		"=> notes.txt\n" +
+		"=> cat.gif A\tcat\n" +
+		"=> dog.PNG Dog\n" +
+		"=> app.tar.gz App\n" +
+		"=> page.html Page\n" +
+		"=> gopher://example.org/0/about.txt About\n" +
+		"=> gopher://example.org:7070 Hole\n" +
+		"=> gemini://example.org/ Capsule\n" +
+		"=> https://example.org/ Site\n" +
+		"=> %zz Bad\n" +
+		"```alt\n" +
+		"a\tb  \n" +
+		"  plain\n" +
+		"```\n" +
+		"### End\n"
+
+	tests := []struct {
+		opts     gophermap.Options
+		expected string
+	}{
+		{gophermap.Options{Width: 30}, "" +
+			"i# A heading\tfake\t(NULL)\t0\n" +
+			"i\tfake\t(NULL)\t0\n" +
+			"iSome text that is long enough\tfake\t(NULL)\t0\n" +
+			"ito be wrapped to the next\tfake\t(NULL)\t0\n" +
+			"iline.\tfake\t(NULL)\t0\n" +
+			"i* A list item that is also\tfake\t(NULL)\t0\n" +
+			"i  long enough to wrap.\tfake\t(NULL)\t0\n" +
+			"i> A quote that wraps.\tfake\t(NULL)\t0\n" +
+			"i## Links\tfake\t(NULL)\t0\n" +
+			"1Blog\t/blog/\n" +
+			"0notes.txt\tnotes.txt\n" +
+			"gA cat\tcat.gif\n" +
+			"IDog\tdog.PNG\n" +
+			"9App\tapp.tar.gz\n" +
+			"hPage\tpage.html\n" +
+			"0About\t/about.txt\texample.org\t70\n" +
+			"1Hole\t\texample.org\t7070\n" +
+			"hCapsule\tURL:gemini://example.org/\n" +
+			"hSite\tURL:https://example.org/\n" +
+			"hBad\tURL:%zz\n" +
+			"ia       b  \tfake\t(NULL)\t0\n" +
+			"i  plain\tfake\t(NULL)\t0\n" +
+			"i### End\tfake\t(NULL)\t0\n"},
+		{gophermap.Options{Host: "localhost", Port: 7070}, "" +
+			"i# A heading\tfake\t(NULL)\t0\n" +
+			"i\tfake\t(NULL)\t0\n" +
+			"iSome text that is long enough to be wrapped to the next " +
+			"line.\tfake\t(NULL)\t0\n" +
+			"i* A list item that is also long enough to wrap.\t" +
+			"fake\t(NULL)\t0\n" +
+			"i> A quote that wraps.\tfake\t(NULL)\t0\n" +
+			"i## Links\tfake\t(NULL)\t0\n" +
+			"1Blog\t/blog/\tlocalhost\t7070\n" +
+			"0notes.txt\tnotes.txt\tlocalhost\t7070\n" +
+			"gA cat\tcat.gif\tlocalhost\t7070\n" +
+			"IDog\tdog.PNG\tlocalhost\t7070\n" +
+			"9App\tapp.tar.gz\tlocalhost\t7070\n" +
+			"hPage\tpage.html\tlocalhost\t7070\n" +
+			"0About\t/about.txt\texample.org\t70\n" +
+			"1Hole\t\texample.org\t7070\n" +
+			"hCapsule\tURL:gemini://example.org/\tlocalhost\t7070\n" +
+			"hSite\tURL:https://example.org/\tlocalhost\t7070\n" +
+			"hBad\tURL:%zz\tlocalhost\t7070\n" +
+			"ia       b  \tfake\t(NULL)\t0\n" +
+			"i  plain\tfake\t(NULL)\t0\n" +
+			"i### End\tfake\t(NULL)\t0\n"},
+	}
+
+	for _, test := range tests {
+		var b strings.Builder
+
+		err := gophermap.Render(&b, strings.NewReader(text), test.opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if b.String() != test.expected {
+			t.Errorf("Expected gophermap:\n%s\ngot:\n%s",
+				test.expected, b.String())
+		}
+	}
+}
+
+func TestWriterLongWord(t *testing.T) {
+	var b strings.Builder
+
+	w := gophermap.NewWriter(&b, gophermap.Options{Width: 10})
+	w.Write(gmitxt.Line{ // nolint: errcheck // checked by Flush
+		Type: gmitxt.Text, Text: []byte("a verylongword b"),
+	})
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "ia\tfake\t(NULL)\t0\niverylongword\tfake\t(NULL)\t0\n" +
+		"ib\tfake\t(NULL)\t0\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, b.String())
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	err := gophermap.Render(&strings.Builder{}, errReader{},
+		gophermap.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+
+	err = gophermap.Render(errWriter{}, strings.NewReader("text\n"),
+		gophermap.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := gophermap.RenderContext(ctx, &strings.Builder{},
+		strings.NewReader("# Title\n"), gophermap.Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+var errTest = errors.New("test error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errTest
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTest
+}
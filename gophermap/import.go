@@ -0,0 +1,114 @@
+package gophermap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Import reads a gophermap from src and writes it to dst as Gemini text.
+//
+// Info and error lines become text lines, and the other items become links
+// with their display string as the text.  An item with a URL: selector links
+// to the URL, an item with a host links to its gopher URL, and an item
+// without a host links to its selector on the same server.  Lines without a
+// tab, which servers show as info lines, become text lines as they are.  Text
+// lines that start like another type of line, such as "# " or "```", are
+// indented with a space so they stay text lines.  A line with a single dot
+// ends the gophermap.
+func Import(dst io.Writer, src io.Reader) error {
+	s := bufio.NewScanner(src)
+	w := gmitxt.NewWriter(dst)
+
+	for s.Scan() {
+		text := strings.TrimSuffix(s.Text(), "\r")
+		if text == "." {
+			break
+		}
+
+		w.Write(importLine(text)) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading gophermap: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
+
+// importLine returns the line of Gemini text of a gophermap line.
+func importLine(text string) gmitxt.Line {
+	if !strings.Contains(text, "\t") {
+		return textLine(text)
+	}
+
+	fields := strings.Split(text, "\t")
+	if fields[0] == "" {
+		return gmitxt.Line{Type: gmitxt.Text}
+	}
+
+	typ, display, selector := fields[0][0], fields[0][1:], fields[1]
+
+	var host, port string
+	if len(fields) >= 4 {
+		host, port = fields[2], fields[3]
+	}
+
+	var link string
+
+	switch {
+	case typ == TypeInfo || typ == TypeError:
+		return textLine(display)
+	case strings.HasPrefix(selector, urlPrefix):
+		link = strings.TrimPrefix(selector, urlPrefix)
+	case host != "":
+		if port != "" && port != "70" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		link = (&url.URL{
+			Scheme: "gopher",
+			Host:   host,
+			Path:   "/" + string(typ) + selector,
+		}).String()
+	default:
+		// The selector is escaped, so spaces do not end the URL.
+		link = (&url.URL{Path: selector}).String()
+	}
+
+	if link == "" {
+		link = "/"
+	}
+
+	return gmitxt.Line{
+		Type: gmitxt.Link, URL: []byte(link), Text: []byte(display),
+	}
+}
+
+// tokens are the starts of the lines of Gemini text that are not text lines.
+var tokens = []string{"#", "=>", "```", "* ", ">"}
+
+// textLine returns a text line with the text, indented with a space if it
+// starts with a token of another type of line.
+func textLine(text string) gmitxt.Line {
+	for _, token := range tokens {
+		if strings.HasPrefix(text, token) {
+			text = " " + text
+
+			break
+		}
+	}
+
+	return gmitxt.Line{Type: gmitxt.Text, Text: []byte(text)}
+}
@@ -0,0 +1,92 @@
+package gophermap_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/gophermap"
+)
+
+func TestImport(t *testing.T) {
+	gophermapText := "Welcome to my hole\r\n" +
+		"iSome info\tfake\t(NULL)\t0\r\n" +
+		"3Oops\t\terror.host\t1\r\n" +
+		"1Blog\t/blog/\texample.org\t70\r\n" +
+		"0About me\t/about me.txt\texample.org\t7070\r\n" +
+		"hSite\tURL:https://example.org/\texample.org\t70\r\n" +
+		"1Local\t/local/\n" +
+		"1Root\t\n" +
+		"\tstray\n" +
+		"i```\tfake\t(NULL)\t0\r\n" +
+		"# Not a heading\n" +
+		"i=> not a link\tfake\t(NULL)\t0\n" +
+		"* not a list\n" +
+		"i> not a quote\tfake\t(NULL)\t0\n" +
+		"*bold*\n" +
+		"\n" +
+		".\r\n" +
+		"iAfter the end\tfake\t(NULL)\t0\r\n"
+
+	expected := "Welcome to my hole\n" +
+		"Some info\n" +
+		"Oops\n" +
+		"=> gopher://example.org/1/blog/ Blog\n" +
+		"=> gopher://example.org:7070/0/about%20me.txt About me\n" +
+		"=> https://example.org/ Site\n" +
+		"=> /local/ Local\n" +
+		"=> / Root\n" +
+		"\n" +
+		" ```\n" +
+		" # Not a heading\n" +
+		" => not a link\n" +
+		" * not a list\n" +
+		" > not a quote\n" +
+		"*bold*\n" +
+		"\n"
+
+	var b strings.Builder
+
+	err := gophermap.Import(&b, strings.NewReader(gophermapText))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.String() != expected {
+		t.Errorf("Expected text:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	text := "# Title\n=> /blog/ Blog\n=> https://example.org/ Site\n"
+
+	var gm, b strings.Builder
+
+	if err := gophermap.Render(&gm, strings.NewReader(text),
+		gophermap.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := gophermap.Import(&b, strings.NewReader(gm.String())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Info lines with the tokens of headings are indented, so they stay
+	// text lines.
+	expected := " # Title\n=> /blog/ Blog\n=> https://example.org/ Site\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, b.String())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	if err := gophermap.Import(&strings.Builder{}, errReader{}); !errors.Is(
+		err, errTest) {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+
+	err := gophermap.Import(errWriter{}, strings.NewReader("text\n"))
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+// Package html renders Gemini text as HTML, to be served on the web or
+// included in a page.
+//
+// Headings become h1, h2 and h3 elements with the slug of their text as their
+// id, numbered as links.Slugs does, so links with a fragment work as they do
+// in a capsule.  Text lines and links become paragraphs, consecutive list
+// items become a ul element and consecutive quote lines become a blockquote
+// element.  Preformatted text becomes a pre element, with its alt text as its
+// label.  The text is escaped everywhere, and links with a scheme that could
+// run scripts, such as javascript: URLs, are written as text.
+package html
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+// Options are the options of a Writer.
+type Options struct {
+	// Document writes a whole HTML document, with a head with the title,
+	// language and stylesheet of the options.  Otherwise only the elements
+	// of the lines are written, to be included in a page.
+	Document bool
+	// XHTML writes the document as XHTML, with void elements closed, as is
+	// needed by EPUB.
+	XHTML bool
+	// Title is the title of the document.
+	Title string
+	// Lang is the language of the document, such as "en".
+	Lang string
+	// Stylesheet is the URL of the stylesheet of the document, if any.
+	Stylesheet string
+	// Head is HTML added at the end of the head of the document as it is,
+	// such as a script.
+	Head string
+	// Images writes links to local images, whose URL is relative and ends
+	// with an image extension such as ".png", as img elements with the text
+	// of the link as their alternative text.  Images on other servers stay
+	// links, so they are not loaded without the reader following them.
+	Images bool
+	// RewriteURL returns the URL of a link to write, such as the URL of an
+	// HTML file for a link to a .gmi file.  If it is nil, URLs are written as
+	// they are.
+	RewriteURL func(url string) string
+}
+
+// Writer writes lines of Gemini text as HTML.
+//
+// As returned by NewWriter, a Writer writes lines with a buffer.  The client
+// should call the Flush method to end an open list, quote or document, and to
+// guarantee all data has been forwarded to the underlying io.Writer.  Any
+// errors that occurred should be checked by calling the Error method.
+type Writer struct {
+	w     *bufio.Writer
+	opts  Options
+	elem  string      // element of the open list, quote or pre text
+	slugs links.Slugs // slugs of the headings already written
+	end   bool        // whether the end of the document was written
+}
+
+// NewWriter returns a new Writer that writes to w with the options.  With the
+// Document option, the start of the document is written first.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	hw := &Writer{w: bufio.NewWriter(w), opts: opts}
+
+	if opts.Document {
+		hw.start()
+	}
+
+	return hw
+}
+
+// start writes the start of the document, up to the start of its body.
+func (w *Writer) start() {
+	if w.opts.XHTML {
+		w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+			"<!DOCTYPE html>\n" +
+			"<html xmlns=\"http://www.w3.org/1999/xhtml\"")
+
+		if w.opts.Lang != "" {
+			w.printf(" xml:lang=\"%s\"", Escape(w.opts.Lang))
+		}
+	} else {
+		w.printf("<!DOCTYPE html>\n<html")
+	}
+
+	if w.opts.Lang != "" {
+		w.printf(" lang=\"%s\"", Escape(w.opts.Lang))
+	}
+
+	w.printf(">\n<head>\n<meta charset=\"utf-8\"%s>\n", w.void())
+
+	if !w.opts.XHTML {
+		w.printf("<meta name=\"viewport\" " +
+			"content=\"width=device-width, initial-scale=1\">\n")
+	}
+
+	w.printf("<title>%s</title>\n", Escape(w.opts.Title))
+
+	if w.opts.Stylesheet != "" {
+		w.printf("<link rel=\"stylesheet\" href=\"%s\"%s>\n",
+			Escape(w.opts.Stylesheet), w.void())
+	}
+
+	if w.opts.Head != "" {
+		w.printf("%s\n", strings.TrimSuffix(w.opts.Head, "\n"))
+	}
+
+	w.printf("</head>\n<body>\n")
+}
+
+// void returns the end of the start tag of a void element, which is closed
+// in XHTML.
+func (w *Writer) void() string {
+	if w.opts.XHTML {
+		return " /"
+	}
+
+	return ""
+}
+
+// Write writes a single line of Gemini text as HTML.  Consecutive list items
+// and quote lines are written in a single element, which is ended by the next
+// line of another type.  Whitespace around the text of lines is trimmed
+// outside of preformatted text.  If there was an error, it is returned and can
+// also be retrieved by the Error method.
+func (w *Writer) Write(line gmitxt.Line) error {
+	text := string(line.Text)
+	if line.Type != gmitxt.PreBody {
+		text = strings.TrimSpace(text)
+	}
+
+	switch line.Type {
+	case gmitxt.Head1:
+		w.heading("h1", text)
+	case gmitxt.Head2:
+		w.heading("h2", text)
+	case gmitxt.Head3:
+		w.heading("h3", text)
+	case gmitxt.Text:
+		w.close()
+
+		if text != "" {
+			w.printf("<p>%s</p>\n", Escape(text))
+		}
+	case gmitxt.Link:
+		w.close()
+		w.link(string(line.URL), text)
+	case gmitxt.List:
+		w.open("ul")
+		w.printf("<li>%s</li>\n", Escape(text))
+	case gmitxt.Quote:
+		w.open("blockquote")
+
+		if text != "" {
+			w.printf("<p>%s</p>\n", Escape(text))
+		}
+	case gmitxt.PreStart:
+		w.close()
+		w.elem = "pre"
+
+		if text != "" {
+			w.printf("<pre aria-label=\"%s\">", Escape(text))
+		} else {
+			w.printf("<pre>")
+		}
+	case gmitxt.PreBody:
+		w.printf("%s\n", Escape(text))
+	case gmitxt.PreEnd:
+		w.close()
+	}
+
+	return w.Error()
+}
+
+// heading writes the heading element with the text, with the slug of the
+// text as its id.  Headings with the same slug are numbered as by
+// links.Slugs, so the second "Notes" heading has the id "notes-1".  Empty
+// headings are not written.
+func (w *Writer) heading(elem, text string) {
+	w.close()
+
+	if text == "" {
+		return
+	}
+
+	id := w.slugs.Next(text)
+	if id == "" {
+		w.printf("<%s>%s</%s>\n", elem, Escape(text), elem)
+
+		return
+	}
+
+	w.printf("<%s id=\"%s\">%s</%s>\n", elem, Escape(id), Escape(text), elem)
+}
+
+// link writes the link as a paragraph, or as an image with the Images option.
+// Links with an unsafe URL are written as text.
+func (w *Writer) link(rawurl, text string) {
+	if w.opts.RewriteURL != nil {
+		rawurl = w.opts.RewriteURL(rawurl)
+	}
+
+	if text == "" {
+		text = rawurl
+	}
+
+	if !SafeURL(rawurl) {
+		w.printf("<p>%s</p>\n", Escape(text))
+
+		return
+	}
+
+	if w.opts.Images && IsImage(rawurl) && isLocal(rawurl) {
+		w.printf("<p><img src=\"%s\" alt=\"%s\"%s></p>\n", Escape(rawurl),
+			Escape(text), w.void())
+
+		return
+	}
+
+	w.printf("<p><a href=\"%s\">%s</a></p>\n", Escape(rawurl), Escape(text))
+}
+
+// open opens the list or quote element, unless it is already open.
+func (w *Writer) open(elem string) {
+	if w.elem == elem {
+		return
+	}
+
+	w.close()
+	w.elem = elem
+	w.printf("<%s>\n", elem)
+}
+
+// close closes the open element, if any.
+func (w *Writer) close() {
+	if w.elem == "" {
+		return
+	}
+
+	w.printf("</%s>\n", w.elem)
+	w.elem = ""
+}
+
+// printf writes the formatted text.  The errors are checked by Error.
+func (w *Writer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(w.w, format, args...)
+}
+
+// escaper escapes the special characters of HTML.
+var escaper = strings.NewReplacer(
+	`&`, "&amp;",
+	`<`, "&lt;",
+	`>`, "&gt;",
+	`"`, "&#34;",
+	`'`, "&#39;",
+)
+
+// Escape escapes the special characters of HTML in the text, which are
+// & < > " and ', so it can be written in an element or an attribute value.
+func Escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// safeSchemes are the schemes of the URLs of links written as links.
+var safeSchemes = map[string]bool{
+	"gemini": true, "gopher": true, "http": true, "https": true,
+	"mailto": true, "finger": true, "spartan": true, "ftp": true,
+	"irc": true, "ircs": true, "xmpp": true, "news": true, "tel": true,
+}
+
+// SafeURL returns whether the URL can be written as a link, which is when it
+// is relative or has a scheme that cannot run scripts, such as gemini or
+// https.
+func SafeURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "" || safeSchemes[strings.ToLower(u.Scheme)]
+}
+
+// isLocal returns whether the URL is relative, without a scheme or host.
+func isLocal(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+// imageExts are the extensions of the URLs of images.
+var imageExts = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// IsImage returns whether the URL is the URL of an image, by the extension of
+// its path.
+func IsImage(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+
+	p := strings.ToLower(u.Path)
+
+	for _, ext := range imageExts {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Flush ends an open list or quote and writes any buffered data to the
+// underlying io.Writer.  Preformatted text that is not closed is ended too.
+// With the Document option, the first Flush ends the document, so it must be
+// called after the last line.  To check if an error occurred during the
+// Flush, call Error.
+func (w *Writer) Flush() {
+	w.close()
+
+	if w.opts.Document && !w.end {
+		w.end = true
+		w.printf("</body>\n</html>\n")
+	}
+
+	w.w.Flush() // nolint: errcheck // checked by Error
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+
+	return err // nolint: wrapcheck // error from the underlying io.Writer
+}
+
+// Render reads Gemini text from src and writes it to dst as HTML.
+func Render(dst io.Writer, src io.Reader, opts Options) error {
+	return RenderContext(context.Background(), dst, src, opts)
+}
+
+// RenderContext is like Render, but stops reading when the context is done,
+// and returns the error of the context.
+func RenderContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+	opts Options,
+) error {
+	s := gmitxt.NewScanner(src)
+	w := NewWriter(dst, opts)
+
+	for s.ScanContext(ctx) {
+		w.Write(s.Line()) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing HTML: %w", err)
+	}
+
+	return nil
+}
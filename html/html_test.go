@@ -0,0 +1,222 @@
+package html_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/html"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		input  string
+		golden string
+		opts   html.Options
+	}{
+		{"../testdata/example.gmi", "example.html", html.Options{}},
+		{"testdata/escape.gmi", "escape.html", html.Options{Images: true}},
+		{"testdata/escape.gmi", "escape.xhtml", html.Options{
+			Document: true, XHTML: true, Title: `A "title"`, Lang: "en",
+			Stylesheet: "style.css?a&b", Images: true,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Logf("rendering %s as %s", test.input, test.golden)
+
+		f, err := os.Open(test.input)
+		if err != nil {
+			t.Fatalf("could not open %s: %v", test.input, err)
+		}
+
+		golden := filepath.Join("testdata", test.golden)
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("could not read file %s: %v", golden, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = html.Render(&buf, f, test.opts)
+		f.Close()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("Expected %s to be rendered as %s, got:\n%s",
+				test.input, golden, buf.Bytes())
+		}
+	}
+}
+
+func TestRenderDocument(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := html.Render(&buf, strings.NewReader("=> page.gmi Page\n"),
+		html.Options{
+			Document:   true,
+			Title:      "Home",
+			Head:       "<script src=\"/reload.js\"></script>\n",
+			RewriteURL: func(u string) string { return "/" + u },
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "<!DOCTYPE html>\n" +
+		"<html>\n" +
+		"<head>\n" +
+		"<meta charset=\"utf-8\">\n" +
+		"<meta name=\"viewport\" " +
+		"content=\"width=device-width, initial-scale=1\">\n" +
+		"<title>Home</title>\n" +
+		"<script src=\"/reload.js\"></script>\n" +
+		"</head>\n" +
+		"<body>\n" +
+		"<p><a href=\"/page.gmi\">Page</a></p>\n" +
+		"</body>\n" +
+		"</html>\n"
+	if buf.String() != expected {
+		t.Errorf("Expected document:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRenderHeadingIDs(t *testing.T) {
+	const page = "# Intro\n## Intro\n### Intro 1\n"
+
+	var buf bytes.Buffer
+
+	if err := html.Render(&buf, strings.NewReader(page),
+		html.Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "<h1 id=\"intro\">Intro</h1>\n" +
+		"<h2 id=\"intro-1\">Intro</h2>\n" +
+		"<h3 id=\"intro-1-1\">Intro 1</h3>\n"
+	if buf.String() != expected {
+		t.Errorf("Expected headings:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	t.Log("checking the ids are the fragments accepted by the link checker")
+
+	dir := testutil.TempDir(t, map[string]string{
+		"page.gmi":  page,
+		"index.gmi": "=> page.gmi#intro-1\n=> page.gmi#intro-1-1\n",
+	})
+
+	var c links.Checker
+
+	problems, err := c.Check(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Errorf("Expected no broken links, got: %v", problems)
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := html.NewWriter(&buf, html.Options{Document: true})
+	w.Flush()
+	w.Flush()
+
+	if strings.Count(buf.String(), "</html>") != 1 {
+		t.Errorf("Expected the document to be ended once, got:\n%s",
+			buf.String())
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	for url, expected := range map[string]bool{
+		"page.gmi":                true,
+		"//example.org/":          true,
+		"gemini://example.org/":   true,
+		"HTTPS://example.org/":    true,
+		"mailto:kiba@example.org": true,
+		"javascript:alert(1)":     false,
+		"JavaScript:alert(1)":     false,
+		"data:text/html,<b>x</b>": false,
+		"vbscript:msgbox":         false,
+		"%zz":                     false,
+	} {
+		if actual := html.SafeURL(url); actual != expected {
+			t.Errorf("Expected SafeURL(%q) to be %t", url, expected)
+		}
+	}
+}
+
+func TestIsImage(t *testing.T) {
+	for url, expected := range map[string]bool{
+		"cat.png":                         true,
+		"https://example.org/a/CAT.JPG?x": true,
+		"photo.jpeg#top":                  true,
+		"cat.png.gmi":                     false,
+		"%zz.png":                         false,
+	} {
+		if actual := html.IsImage(url); actual != expected {
+			t.Errorf("Expected IsImage(%q) to be %t", url, expected)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	expected := "&amp;&lt;&gt;&#34;&#39; text"
+	if actual := html.Escape(`&<>"' text`); actual != expected {
+		t.Errorf("Expected %q, got: %q", expected, actual)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	err := html.Render(&strings.Builder{}, errReader{}, html.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+
+	err = html.Render(errWriter{}, strings.NewReader("text\n"),
+		html.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := html.RenderContext(ctx, &strings.Builder{},
+		strings.NewReader("# Title\n"), html.Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+var errTest = errors.New("test error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errTest
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTest
+}
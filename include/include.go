@@ -0,0 +1,228 @@
+// Package include expands include links in Gemini text, to assemble pages
+// from shared snippets such as navigation, footers and disclaimers when a
+// capsule is built.  An include link is a link with a URL that starts with
+// the include prefix, followed by the path of the file to include:
+//
+//     ## Contact
+//     => include:footer.gmi
+//
+// The link is replaced by the lines of the file.  Its headings are moved
+// below the heading before the include link, so a level 1 heading of the
+// footer becomes a level 3 heading under "## Contact".  Headings cannot be
+// deeper than level 3.  Preformatted text that is not closed at the end of
+// an included file is closed, so it does not run into the lines after the
+// include link.  Included files can include other files, but not a file that
+// is already being included.
+package include
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// ErrCycle is returned when a file includes itself, directly or through other
+// included files.
+var ErrCycle = errors.New("include cycle")
+
+// DefaultPrefix is the prefix of the URL of include links when the Options
+// have no Prefix.
+const DefaultPrefix = "include:"
+
+// Options are the options of an Expander.
+type Options struct {
+	// Prefix is the prefix of the URL of include links.  If it is empty,
+	// DefaultPrefix is used.
+	Prefix string
+	// ReadFile reads an included file.  If it is nil, ioutil.ReadFile is
+	// used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// Line is a line of Gemini text with the file it is from.
+type Line struct {
+	gmitxt.Line
+	// File is the name of the file of the line.  Num is the number of the
+	// line in this file.
+	File string
+}
+
+// Pos returns the position of the line as "file:line", for messages.
+func (l Line) Pos() string {
+	return l.File + ":" + strconv.FormatUint(uint64(l.Num), 10)
+}
+
+// frame is a file being scanned.
+type frame struct {
+	name  string
+	s     *gmitxt.Scanner
+	num   uint32 // number of the last line scanned
+	shift int    // number of levels the headings are moved down
+	level int    // level of the last heading, after it was moved
+}
+
+// Expander scans Gemini text and expands its include links.  It is used like
+// a Scanner: each call to Scan scans the next line, which is returned by Line.
+// Files are read when their include link is scanned, and paths are relative to
+// the directory of the file with the include link.
+type Expander struct {
+	opts  Options
+	stack []*frame
+	line  Line
+	err   error
+}
+
+// NewExpander returns a new Expander that scans the Gemini text of the named
+// file from r.
+func NewExpander(name string, r io.Reader, opts Options) *Expander {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+
+	if opts.ReadFile == nil {
+		opts.ReadFile = ioutil.ReadFile
+	}
+
+	return &Expander{
+		opts:  opts,
+		stack: []*frame{{name: filepath.Clean(name), s: gmitxt.NewScanner(r)}},
+	}
+}
+
+// Scan scans the next line, expanding include links, which is then available
+// through the Line method.  It returns false when the scan stops, either by
+// reaching the end of the text or an error.  After Scan returns false, the Err
+// method will return any error that occurred during scanning.
+func (e *Expander) Scan() bool {
+	for e.err == nil && len(e.stack) != 0 {
+		f := e.stack[len(e.stack)-1]
+
+		if !f.s.Scan() {
+			if err := f.s.Err(); err != nil {
+				e.err = fmt.Errorf("%s:%d: problem reading: %w", f.name,
+					f.num+1, err)
+
+				return false
+			}
+
+			e.stack = e.stack[:len(e.stack)-1]
+
+			continue
+		}
+
+		line := f.s.Line()
+		f.num = line.Num
+
+		if line.Type == gmitxt.Link &&
+			bytes.HasPrefix(line.URL, []byte(e.opts.Prefix)) {
+			e.include(f, line)
+
+			continue
+		}
+
+		if line.Type >= gmitxt.Head1 && line.Type <= gmitxt.Head3 {
+			level := int(line.Type-gmitxt.Head1) + 1 + f.shift
+			if level > 3 {
+				level = 3
+			}
+
+			line.Type = gmitxt.Head1 + gmitxt.LineType(level-1)
+			f.level = level
+		}
+
+		e.line = Line{Line: line, File: f.name}
+
+		return true
+	}
+
+	return false
+}
+
+// include starts scanning the file of the include link of the frame.
+func (e *Expander) include(f *frame, link gmitxt.Line) {
+	path := strings.TrimPrefix(string(link.URL), e.opts.Prefix)
+	name := filepath.Clean(path)
+
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(f.name), name)
+	}
+
+	pos := Line{Line: link, File: f.name}.Pos()
+
+	for i, g := range e.stack {
+		if g.name != name {
+			continue
+		}
+
+		var names []string
+		for _, g := range e.stack[i:] {
+			names = append(names, g.name)
+		}
+
+		e.err = fmt.Errorf("%s: %w: %s -> %s", pos, ErrCycle,
+			strings.Join(names, " -> "), name)
+
+		return
+	}
+
+	data, err := e.opts.ReadFile(name)
+	if err != nil {
+		e.err = fmt.Errorf("%s: problem including %s: %w", pos, path, err)
+
+		return
+	}
+
+	s := gmitxt.NewScanner(bytes.NewReader(data))
+	s.ClosePreformatted(true)
+
+	e.stack = append(e.stack, &frame{
+		name:  name,
+		s:     s,
+		shift: f.level,
+		level: f.level,
+	})
+}
+
+// Line returns the line that was just scanned by the Scan method, with the
+// file it is from.  The underlying data will be overwritten by subsequent
+// calls to Scan.
+func (e *Expander) Line() Line {
+	return e.line
+}
+
+// Err returns the first error that was encountered by the Expander.  The
+// errors of include links have the position of the link, and the errors
+// reading a file have the position of the line that could not be read.
+func (e *Expander) Err() error {
+	return e.err
+}
+
+// Expand reads the Gemini text of the named file from src and writes it to
+// dst with its include links expanded.
+func Expand(dst io.Writer, name string, src io.Reader, opts Options) error {
+	e := NewExpander(name, src, opts)
+	w := gmitxt.NewWriter(dst)
+
+	for e.Scan() {
+		w.Write(e.Line().Line) // nolint: errcheck // checked by Error
+	}
+
+	if err := e.Err(); err != nil {
+		return err
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
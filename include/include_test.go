@@ -0,0 +1,187 @@
+package include_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"git.sr.ht/~kiba/gmitxt/include"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+var errTest = errors.New("test error")
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errTest }
+
+// readFiles returns a ReadFile function that reads the files of the map.
+func readFiles(files map[string]string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		text, ok := files[filepath.ToSlash(name)]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		return []byte(text), nil
+	}
+}
+
+func TestExpander(t *testing.T) {
+	files := map[string]string{
+		"site/footer.gmi":        "# Footer\n=> include:parts/nav.gmi\nBye\n",
+		"site/parts/nav.gmi":     "## Nav\n=> / Home\n",
+		"site/parts/license.gmi": "### License\n",
+	}
+	text := "# Page\n" +
+		"=> include:parts/license.gmi\n" +
+		"## Contact\n" +
+		"=> include:footer.gmi\n" +
+		"=> other:footer.gmi Other\n" +
+		"```\n" +
+		"=> include:footer.gmi\n" +
+		"```\n" +
+		"End\n"
+
+	e := include.NewExpander("site/index.gmi", strings.NewReader(text),
+		include.Options{ReadFile: readFiles(files)})
+
+	var actual []string
+
+	for e.Scan() {
+		line := e.Line()
+		actual = append(actual, line.Pos()+" "+line.Type.String()+" "+
+			string(line.Text))
+	}
+
+	if err := e.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"site/index.gmi:1 Head1 Page",
+		"site/parts/license.gmi:1 Head3 License",
+		"site/index.gmi:3 Head2 Contact",
+		"site/footer.gmi:1 Head3 Footer",
+		"site/parts/nav.gmi:1 Head3 Nav",
+		"site/parts/nav.gmi:2 Link Home",
+		"site/footer.gmi:3 Text Bye",
+		"site/index.gmi:5 Link Other",
+		"site/index.gmi:6 PreStart ",
+		"site/index.gmi:7 PreBody => include:footer.gmi",
+		"site/index.gmi:8 PreEnd ",
+		"site/index.gmi:9 Text End",
+	}
+
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected lines:\n%s\ngot:\n%s",
+			strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestExpanderPrefix(t *testing.T) {
+	files := map[string]string{"/snippets/nav.gmi": "* Home\n"}
+	text := "=> @/snippets/nav.gmi\n=> include:nav.gmi Nav\n"
+
+	var buf bytes.Buffer
+
+	err := include.Expand(&buf, "index.gmi", strings.NewReader(text),
+		include.Options{Prefix: "@", ReadFile: readFiles(files)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "* Home\n=> include:nav.gmi Nav\n"; buf.String() !=
+		expected {
+		t.Errorf("Expected text:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestExpanderPreformatted(t *testing.T) {
+	files := map[string]string{"snip.gmi": "```\ncode"}
+	text := "=> include:snip.gmi\n## After\n"
+
+	var buf bytes.Buffer
+
+	err := include.Expand(&buf, "index.gmi", strings.NewReader(text),
+		include.Options{ReadFile: readFiles(files)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "```\ncode\n```\n## After\n"; buf.String() != expected {
+		t.Errorf("Expected closed preformatted text:\n%s\ngot:\n%s", expected,
+			buf.String())
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{"footer.gmi": "Bye\n"})
+
+	var buf bytes.Buffer
+
+	err := include.Expand(&buf, filepath.Join(dir, "index.gmi"),
+		strings.NewReader("Hi\n=> include:footer.gmi\n"), include.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != "Hi\nBye\n" {
+		t.Errorf("Expected included file, got: %q", buf.String())
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	files := map[string]string{
+		"a.gmi": "=> include:b.gmi\n",
+		"b.gmi": "Text\n\n=> include:a.gmi\n",
+		"c.gmi": "=> include:c.gmi\n",
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"=> include:a.gmi\n", "b.gmi:3: include cycle: " +
+			"a.gmi -> b.gmi -> a.gmi"},
+		{"=> include:c.gmi\n", "c.gmi:1: include cycle: c.gmi -> c.gmi"},
+		{"x\n=> include:index.gmi\n", "index.gmi:2: include cycle: " +
+			"index.gmi -> index.gmi"},
+		{"=> include:d.gmi\n", "index.gmi:1: problem including d.gmi: "},
+	}
+
+	for _, test := range tests {
+		err := include.Expand(ioutil.Discard, "./index.gmi",
+			strings.NewReader(test.text),
+			include.Options{ReadFile: readFiles(files)})
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("Expected error %q, got: %v", test.expected, err)
+		}
+	}
+
+	err := include.Expand(ioutil.Discard, "index.gmi",
+		strings.NewReader("=> include:c.gmi\n"),
+		include.Options{ReadFile: readFiles(files)})
+	if !errors.Is(err, include.ErrCycle) {
+		t.Errorf("Expected ErrCycle, got: %v", err)
+	}
+
+	err = include.Expand(ioutil.Discard, "index.gmi",
+		iotest.TimeoutReader(strings.NewReader("# Heading")),
+		include.Options{})
+	if !errors.Is(err, iotest.ErrTimeout) ||
+		!strings.HasPrefix(err.Error(), "index.gmi:2: problem reading: ") {
+		t.Errorf("Expected error `%v`, got: %v", iotest.ErrTimeout, err)
+	}
+
+	err = include.Expand(errWriter{}, "index.gmi",
+		strings.NewReader("# Heading\n"), include.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected writing error, got: %v", err)
+	}
+}
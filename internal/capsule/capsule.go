@@ -0,0 +1,10 @@
+// Package capsule has the names of the files of a capsule directory, which are
+// shared by the packages that read capsules.
+package capsule
+
+const (
+	// Ext is the file extension of Gemini text files.
+	Ext = ".gmi"
+	// Index is the name of the file served for a directory.
+	Index = "index" + Ext
+)
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"os/signal"
+
+	"git.sr.ht/~kiba/gmitxt/internal/site"
+)
+
+const buildDesc = `Build builds an HTTP site in the directory dst from the capsule directory src.
+Gemini text files are rendered as HTML pages, with their include links expanded
+and their links to .gmi files rewritten to link to their .html pages.  Other
+files are copied.  Each gemlog, which is a directory with posts named by their
+date such as 2021-03-17-release.gmi, gets an Atom feed named atom.xml, and an
+index.html page listing its posts when it has no index.gmi.  With -backlinks,
+pages end with a section with that heading linking to the pages linking to
+them.  Hidden files are not built.
+
+Files are only written when their content changed, and copied files are skipped
+when they have the modification time and size of their source.  Pages are HTML
+documents, or are written with the html/template of -template, whose data has
+the Title, Summary, Date, Words, Lang, Path and Content of the page.
+
+Problems with files are reported with their file and line, and the build exits
+with status 1 after building the other files.
+
+With -watch, the capsule directory is then watched for changed files until the
+build is interrupted.  The files that changed, and the pages and feeds built
+from them, such as the pages that include or link to a changed file and the
+index of its gemlog, are built again.`
+
+// buildCmd holds the flags of the build command.
+type buildCmd struct {
+	template  string
+	css       string
+	url       string
+	backlinks string
+	verbose   bool
+	watch     bool
+}
+
+// runBuild runs the build command.
+func runBuild(e *env, args []string) error {
+	var c buildCmd
+
+	fs := flags(e, "build", "[flags] src dst", buildDesc)
+	fs.StringVar(&c.template, "template", "",
+		"write pages with the html/template in the `file`")
+	fs.StringVar(&c.css, "css", "", "link pages to the stylesheet at the `URL`")
+	fs.StringVar(&c.url, "url", "",
+		"resolve the links of feeds against the `URL` of the site")
+	fs.StringVar(&c.backlinks, "backlinks", "",
+		"end pages with the pages linking to them under the `heading`")
+	fs.BoolVar(&c.verbose, "v", false, "list the files written and removed")
+	fs.BoolVar(&c.watch, "watch", false,
+		"build changed files again until interrupted")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	opts := site.Options{Stylesheet: c.css, URL: c.url, Backlinks: c.backlinks}
+
+	if c.template != "" {
+		tmpl, err := template.ParseFiles(c.template)
+		if err != nil {
+			return fmt.Errorf("problem with -template: %w", err)
+		}
+
+		opts.Template = tmpl
+	}
+
+	b := site.New(fs.Arg(0), fs.Arg(1), opts)
+
+	res, err := b.Build()
+	if err != nil {
+		return err // nolint: wrapcheck // has context
+	}
+
+	err = c.report(e, res)
+	if !c.watch {
+		return err
+	}
+
+	return c.watchBuild(e, b)
+}
+
+// watchBuild builds the files that changed again until interrupted, and
+// reports each build.
+func (c *buildCmd) watchBuild(e *env, b *site.Builder) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	defer signal.Stop(sig)
+
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := b.Watch(ctx, pollInterval, func(res site.Result, err error) {
+		if err != nil {
+			fmt.Fprintf(e.stderr, "gmitxt build: %v\n", err)
+
+			return
+		}
+
+		c.report(e, res) // nolint: errcheck // problems are reported
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err // nolint: wrapcheck // has context
+}
+
+// report writes the problems of the result, and the files written and removed
+// with -v.  It returns errFailed if there were problems.
+func (c *buildCmd) report(e *env, res site.Result) error {
+	if c.verbose {
+		for _, name := range res.Written {
+			fmt.Fprintln(e.stdout, "wrote", name)
+		}
+
+		for _, name := range res.Removed {
+			fmt.Fprintln(e.stdout, "removed", name)
+		}
+	}
+
+	for _, err := range res.Errors {
+		fmt.Fprintln(e.stderr, err)
+	}
+
+	if len(res.Errors) != 0 {
+		return errFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package cli_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestBuild(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"index.gmi":               "# Home\n=> gemlog/ Gemlog\n",
+		"gemlog/2021-03-17-a.gmi": "# A\n=> ../index.gmi Home\n",
+		"style.css":               "body {}",
+		"page.tmpl":               "<main>{{.Content}}</main>",
+	})
+	dst := testutil.TempDir(t, nil)
+
+	code, stdout, _ := run(t, "", "build", "-v", "-css", "/style.css",
+		"-url", "https://example.org/", src, dst)
+	expectCode(t, code, 0)
+
+	for _, name := range []string{
+		"gemlog/2021-03-17-a.html", "gemlog/atom.xml", "index.html",
+		"style.css",
+	} {
+		if !strings.Contains(stdout, "wrote "+filepath.Join(dst,
+			filepath.FromSlash(name))+"\n") {
+			t.Errorf("Expected %s to be written, got:\n%s", name, stdout)
+		}
+	}
+
+	page := readFile(t, dst, "gemlog/2021-03-17-a.html")
+	if !strings.Contains(page, `<link rel="stylesheet" href="/style.css">`) ||
+		!strings.Contains(page, `<a href="../index.html">Home</a>`) {
+		t.Errorf("Expected page with stylesheet, got:\n%s", page)
+	}
+
+	code, stdout, _ = run(t, "", "build", "-v", "-css", "/style.css",
+		"-url", "https://example.org/", src, dst)
+	expectCode(t, code, 0)
+
+	if stdout != "" {
+		t.Errorf("Expected nothing to be written, got:\n%s", stdout)
+	}
+
+	code, _, _ = run(t, "", "build", "-template",
+		filepath.Join(src, "page.tmpl"), src, dst)
+	expectCode(t, code, 0)
+
+	if page = readFile(t, dst, "index.html"); !strings.HasPrefix(page,
+		"<main><h1") {
+		t.Errorf("Expected page from the template, got:\n%s", page)
+	}
+
+	code, _, _ = run(t, "", "build", "-backlinks", "Linked from", src, dst)
+	expectCode(t, code, 0)
+
+	if page = readFile(t, dst, "index.html"); !strings.Contains(page,
+		`<h2 id="linked-from">Linked from</h2>`) ||
+		!strings.Contains(page, `<a href="/gemlog/2021-03-17-a.html">A</a>`) {
+		t.Errorf("Expected page with backlinks, got:\n%s", page)
+	}
+
+	t.Log("checking with errors")
+
+	bad := testutil.TempDir(t, map[string]string{
+		"index.gmi": "# Home\n=> include:nope.gmi\n",
+	})
+
+	code, _, stderr := run(t, "", "build", bad, dst)
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, filepath.Join(bad, "index.gmi")+
+		":2: problem including nope.gmi") {
+		t.Errorf("Expected error with file and line, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "build", "-template",
+		filepath.Join(src, "no.tmpl"), src, dst)
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem with -template") {
+		t.Errorf("Expected template error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "build", filepath.Join(src, "no"), dst)
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem building") {
+		t.Errorf("Expected building error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"build"},
+		{"build", src},
+		{"build", "-x", src, dst},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
+
+func TestBuildWatch(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"index.gmi":  "# Home\n=> include:footer.gmi\n",
+		"footer.gmi": "Bye\n",
+	})
+	dst := filepath.Join(src, "public")
+
+	type result struct {
+		code   int
+		stdout string
+	}
+
+	done := make(chan result)
+
+	go func() {
+		code, stdout, _ := run(t, "", "build", "-v", "-watch", src, dst)
+		done <- result{code, stdout}
+	}()
+
+	// The footer is changed until the page is built again, as changes made
+	// before the capsule is first polled are not found.
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("Expected the page to be built again")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		data, err := ioutil.ReadFile(filepath.Join(dst, "index.html"))
+		if err == nil && strings.Contains(string(data), "See you") {
+			break
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(src, "footer.gmi"),
+			[]byte(fmt.Sprintf("See you %d\n", i)), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot interrupt: %v", err)
+	}
+
+	res := <-done
+	expectCode(t, res.code, 0)
+
+	if strings.Count(res.stdout, "wrote "+filepath.Join(dst,
+		"index.html")) < 2 {
+		t.Errorf("Expected the page to be written again, got:\n%s",
+			res.stdout)
+	}
+}
@@ -0,0 +1,153 @@
+// Package cli implements the gmitxt command-line tool.  Each command is run by
+// Main with the command-line arguments, so commands can be tested without
+// building the tool.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+var (
+	// errUsage is returned by a command when it is used incorrectly.  The
+	// usage of the command has already been written when it is returned.
+	errUsage = errors.New("incorrect usage")
+	// errFailed is returned by a command that failed after it reported why,
+	// such as when problems were found.
+	errFailed = errors.New("failed")
+)
+
+// stdinName is the name of standard input used in messages.
+const stdinName = "<standard input>"
+
+// env is the environment a command runs in.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a gmitxt command.
+type command struct {
+	name    string                            // name used to run the command
+	summary string                            // one line description
+	run     func(e *env, args []string) error // runs with the arguments
+}
+
+// commands returns the gmitxt commands, in the order they are listed in the
+// usage.
+func commands() []command {
+	return []command{
+		{"fmt", "format Gemini text files", runFmt},
+		{"lint", "check Gemini text files for problems", runLint},
+		{"links", "work with the links in Gemini text files", runLinks},
+		{"convert", "convert Gemini text to other formats", runConvert},
+		{"include", "expand the include links of Gemini text", runInclude},
+		{"diff", "compare the content of Gemini text files", runDiff},
+		{"section", "write a section of a Gemini text file", runSection},
+		{"serve", "serve a capsule directory to preview it", runServe},
+		{"build", "build an HTTP site from a capsule directory", runBuild},
+		{"epub", "write Gemini text files as an EPUB e-book", runEpub},
+	}
+}
+
+// Main runs the gmitxt command-line tool with the given arguments, not
+// including the program name.  It returns the exit code: 0 for success, 1 when
+// a command fails, and 2 for incorrect usage.
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		usage(stderr)
+
+		return 2
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+
+		return 0
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		err := cmd.run(e, args[1:])
+
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		case errors.Is(err, errFailed):
+			return 1
+		default:
+			fmt.Fprintf(stderr, "gmitxt %s: %v\n", cmd.name, err)
+
+			return 1
+		}
+	}
+
+	fmt.Fprintf(stderr, "gmitxt: unknown command %q\n", args[0])
+	fmt.Fprintln(stderr, "Run 'gmitxt help' for usage.")
+
+	return 2
+}
+
+// usage writes the usage of the gmitxt tool.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "gmitxt is a tool for working with Gemini text.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "\tgmitxt <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The commands are:")
+	fmt.Fprintln(w)
+
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "\t%-10s %s\n", cmd.name, cmd.summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Use 'gmitxt <command> -h' for more information about a "+
+		"command.")
+}
+
+// flags returns a new flag set for a command that writes errors and usage to
+// stderr.  The usage starts with the given usage line, followed by the
+// description and the defaults of the flags.
+func flags(e *env, name, usage, desc string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: gmitxt %s %s\n\n%s\n", name, usage, desc)
+
+		var hasFlags bool
+
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+
+		if hasFlags {
+			fmt.Fprintln(e.stderr)
+			fmt.Fprintln(e.stderr, "Flags:")
+			fs.PrintDefaults()
+		}
+	}
+
+	return fs
+}
+
+// parse parses the command-line arguments with the flag set.  It returns
+// errUsage if they cannot be parsed.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	return nil
+}
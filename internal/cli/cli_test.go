@@ -0,0 +1,106 @@
+package cli_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/internal/cli"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestUsage(t *testing.T) {
+	code, stdout, stderr := run(t, "")
+	expectCode(t, code, 2)
+
+	if stdout != "" || !strings.Contains(stderr, "gmitxt <command>") {
+		t.Errorf("Expected usage on stderr, got stdout: %q, stderr: %q",
+			stdout, stderr)
+	}
+
+	code, stdout, stderr = run(t, "", "help")
+	expectCode(t, code, 0)
+
+	if stderr != "" || !strings.Contains(stdout, "gmitxt <command>") {
+		t.Errorf("Expected usage on stdout, got stdout: %q, stderr: %q",
+			stdout, stderr)
+	}
+
+	code, _, stderr = run(t, "", "nope")
+	expectCode(t, code, 2)
+
+	if !strings.Contains(stderr, `unknown command "nope"`) {
+		t.Errorf("Expected unknown command on stderr, got: %q", stderr)
+	}
+}
+
+// run runs the gmitxt tool with the arguments and the given standard input.
+// It returns the exit code, standard output and standard error.
+func run(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+
+	code := cli.Main(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func expectCode(t *testing.T, code, expected int) {
+	t.Helper()
+
+	if code != expected {
+		t.Errorf("Expected exit code %d, got: %d", expected, code)
+	}
+}
+
+// readFile returns the contents of the file in the directory.
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatalf("could not read %s: %v", name, err)
+	}
+
+	return string(data)
+}
+
+// serveGemini serves the files over the Gemini protocol on a local address
+// until the test ends, and returns the gemini URL of the capsule.
+func serveGemini(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	certPEM, keyPEM, err := gemini.NewCertificate([]string{"localhost"},
+		time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not load certificate: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	srv := &gemini.Server{
+		Handler:   &gemini.FileServer{Dir: testutil.TempDir(t, files)},
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	go srv.Serve(l) // nolint: errcheck // closed when the test ends
+
+	t.Cleanup(func() { srv.Close() })
+
+	return "gemini://" + l.Addr().String() + "/"
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"git.sr.ht/~kiba/gmitxt/ast"
+	"git.sr.ht/~kiba/gmitxt/gophermap"
+	"git.sr.ht/~kiba/gmitxt/html"
+	"git.sr.ht/~kiba/gmitxt/latex"
+	"git.sr.ht/~kiba/gmitxt/man"
+)
+
+const convertDesc = `Convert converts a file, or standard input without a file, from one format to
+another and writes it to standard output.  The formats are:
+
+	gmi        Gemini text
+	json       JSON Lines, with an object for each line of Gemini text
+	json-doc   a JSON document of blocks, with a title and table of contents
+	gophermap  a gophermap
+	html       HTML elements, only with -to
+	latex      LaTeX, only with -to
+	man        a manual page, only with -to
+
+JSON converted back to Gemini text can be edited by other tools.  A gemini://
+URL can be given instead of a file to convert the Gemini text of the response,
+whose server certificate is trusted on first use with -known-hosts.`
+
+// converter converts between Gemini text and another format.
+type converter func(dst io.Writer, src io.Reader) error
+
+// decoders are the converters to Gemini text from the formats of -from.
+var decoders = map[string]converter{
+	"json":      ast.DecodeLines,
+	"json-doc":  ast.DecodeDocument,
+	"gophermap": gophermap.Import,
+}
+
+// encoders are the converters from Gemini text to the formats of -to.
+var encoders = map[string]converter{
+	"json":     ast.EncodeLines,
+	"json-doc": ast.EncodeDocument,
+	"gophermap": func(dst io.Writer, src io.Reader) error {
+		return gophermap.Render(dst, src, gophermap.Options{})
+	},
+	"html": func(dst io.Writer, src io.Reader) error {
+		return html.Render(dst, src, html.Options{})
+	},
+	"latex": func(dst io.Writer, src io.Reader) error {
+		return latex.Render(dst, src, latex.Options{})
+	},
+	"man": func(dst io.Writer, src io.Reader) error {
+		return man.Render(dst, src, man.Options{})
+	},
+}
+
+// runConvert runs the convert command.
+func runConvert(e *env, args []string) error {
+	var from, to, knownHosts string
+
+	fs := flags(e, "convert", "[flags] [file | url]", convertDesc)
+	fs.StringVar(&from, "from", "gmi", "convert from the `format`")
+	fs.StringVar(&to, "to", "gmi", "convert to the `format`")
+	knownHostsFlag(fs, &knownHosts)
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	decode, okFrom := decoders[from]
+	encode, okTo := encoders[to]
+
+	if fs.NArg() > 1 || (!okFrom && from != "gmi") || (!okTo && to != "gmi") ||
+		(isURL(fs.Arg(0)) && from != "gmi") {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	src := e.stdin
+
+	if isURL(fs.Arg(0)) {
+		var buf bytes.Buffer
+		if err := fetchText(&buf, fs.Arg(0), knownHosts); err != nil {
+			return err
+		}
+
+		src = &buf
+	} else if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("problem reading %s: %w", fs.Arg(0), err)
+		}
+		defer f.Close()
+
+		src = f
+	}
+
+	if decode != nil {
+		var buf bytes.Buffer
+		if err := decode(&buf, src); err != nil {
+			return err // nolint: wrapcheck // has context
+		}
+
+		src = &buf
+	}
+
+	if encode == nil {
+		if _, err := io.Copy(e.stdout, src); err != nil {
+			return fmt.Errorf("problem writing text: %w", err)
+		}
+
+		return nil
+	}
+
+	return encode(e.stdout, src) // nolint: wrapcheck // has context
+}
@@ -0,0 +1,119 @@
+package cli_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestConvert(t *testing.T) {
+	text := "# Title\n=> /about About\n* one\n* two\n```go\nx := 1\n```\n"
+	dir := testutil.TempDir(t, map[string]string{"index.gmi": text})
+
+	code, stdout, _ := run(t, "", "convert", "-to", "json",
+		filepath.Join(dir, "index.gmi"))
+	expectCode(t, code, 0)
+
+	if !strings.HasPrefix(stdout,
+		`{"num":1,"type":"Head1","text":"Title","offset":0}`+"\n"+
+			`{"num":2,"type":"Link","text":"About","url":"/about",`) {
+		t.Errorf("Expected JSON lines, got:\n%s", stdout)
+	}
+
+	code, actual, _ := run(t, stdout, "convert", "-from", "json")
+	expectCode(t, code, 0)
+
+	if actual != text {
+		t.Errorf("Expected round trip:\n%s\ngot:\n%s", text, actual)
+	}
+
+	code, stdout, _ = run(t, text, "convert", "-to", "json-doc")
+	expectCode(t, code, 0)
+
+	if !strings.Contains(stdout, `"title": "Title"`) {
+		t.Errorf("Expected document with title, got:\n%s", stdout)
+	}
+
+	code, actual, _ = run(t, stdout, "convert", "-from", "json-doc")
+	expectCode(t, code, 0)
+
+	if actual != text {
+		t.Errorf("Expected round trip:\n%s\ngot:\n%s", text, actual)
+	}
+
+	code, stdout, _ = run(t, text, "convert", "-to", "man")
+	expectCode(t, code, 0)
+
+	if !strings.HasPrefix(stdout, ".SH \"Title\"\n") {
+		t.Errorf("Expected manual page, got:\n%s", stdout)
+	}
+
+	code, stdout, _ = run(t, text, "convert", "-to", "html")
+	expectCode(t, code, 0)
+
+	if !strings.HasPrefix(stdout, "<h1 id=\"title\">Title</h1>\n") {
+		t.Errorf("Expected HTML, got:\n%s", stdout)
+	}
+
+	code, stdout, _ = run(t, "iHello\tfake\t(NULL)\t0\n", "convert",
+		"-from", "gophermap", "-to", "latex")
+	expectCode(t, code, 0)
+
+	if stdout != "Hello\n\n" {
+		t.Errorf("Expected LaTeX, got: %q", stdout)
+	}
+
+	t.Log("checking a gemini URL")
+
+	url := serveGemini(t, map[string]string{"index.gmi": text})
+	hosts := filepath.Join(dir, "config", "known_hosts")
+
+	code, stdout, _ = run(t, "", "convert", "-known-hosts", hosts, "-to",
+		"man", url)
+	expectCode(t, code, 0)
+
+	if !strings.HasPrefix(stdout, ".SH \"Title\"\n") {
+		t.Errorf("Expected manual page of the response, got:\n%s", stdout)
+	}
+
+	if readFile(t, dir, "config/known_hosts") == "" {
+		t.Error("Expected the certificate to be trusted")
+	}
+
+	t.Log("checking with errors")
+
+	code, _, stderr := run(t, "", "convert", filepath.Join(dir, "no.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem reading") {
+		t.Errorf("Expected reading error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "{", "convert", "-from", "json")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem decoding line 1") {
+		t.Errorf("Expected decoding error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "convert", "-known-hosts", hosts,
+		url+"no.gmi")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "not Gemini text") {
+		t.Errorf("Expected response error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"convert", "-from", "json", url},
+		{"convert", "-x"},
+		{"convert", "-from", "latex"},
+		{"convert", "-from", "html"},
+		{"convert", "a.gmi", "b.gmi"},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
@@ -0,0 +1,387 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/ast"
+	"git.sr.ht/~kiba/gmitxt/internal/diff"
+)
+
+const diffDesc = `Diff compares two Gemini text files by their content instead of their bytes,
+and reports the headings, paragraphs, links, list items, quotes and
+preformatted blocks that were added, removed or changed:
+
+	@@ -3 +3 @@ link changed
+	-=> /old.gmi Old
+	+=> /new.gmi New
+
+Whitespace around tokens and inside lines is ignored, and consecutive text
+lines are compared as a paragraph, so reflowed text is not a change.  With
+-summary, only a summary such as "3 links changed, 1 section added" is written,
+where headings are counted as sections.  It exits with status 1 when the files
+differ.`
+
+// Operations of a change of the diff command.
+const (
+	opAdded   = "added"
+	opRemoved = "removed"
+	opChanged = "changed"
+)
+
+// diffOptions are the flags of the diff command.
+type diffOptions struct {
+	json    bool // write the changes as JSON
+	summary bool // write only the summary
+}
+
+// change is a change between the elements of two files.
+type change struct {
+	Op   string     `json:"op"`
+	Type string     `json:"type"`
+	Old  *ast.Block `json:"old,omitempty"`
+	New  *ast.Block `json:"new,omitempty"`
+}
+
+// runDiff runs the diff command.
+func runDiff(e *env, args []string) error {
+	var o diffOptions
+
+	fs := flags(e, "diff", "[flags] file1 file2", diffDesc)
+	fs.BoolVar(&o.json, "json", false,
+		"write the changes and the summary as JSON")
+	fs.BoolVar(&o.summary, "summary", false, "write only the summary")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	a, err := elementsFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	b, err := elementsFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := compare(a, b)
+
+	if err := o.write(e.stdout, fs.Arg(0), fs.Arg(1), changes); err != nil {
+		return fmt.Errorf("problem writing diff: %w", err)
+	}
+
+	if len(changes) != 0 {
+		return errFailed
+	}
+
+	return nil
+}
+
+// write writes the changes as set by the flags.
+func (o *diffOptions) write(
+	w io.Writer, from, to string, changes []change,
+) error {
+	if o.json {
+		if changes == nil {
+			changes = []change{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(struct { // nolint: wrapcheck // wrapped by caller
+			Changes []change `json:"changes"`
+			Summary string   `json:"summary"`
+		}{changes, summarize(changes)})
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if o.summary {
+		fmt.Fprintln(bw, summarize(changes))
+
+		return bw.Flush() // nolint: wrapcheck // wrapped by caller
+	}
+
+	if len(changes) != 0 {
+		fmt.Fprintf(bw, "--- %s\n+++ %s\n", from, to)
+	}
+
+	for _, c := range changes {
+		writeChange(bw, c)
+	}
+
+	return bw.Flush() // nolint: wrapcheck // wrapped by caller
+}
+
+// writeChange writes the change as a header with the line numbers of the
+// elements, followed by their lines as Gemini text.
+func writeChange(w *bufio.Writer, c change) {
+	w.WriteString("@@") // nolint: errcheck // checked by Flush
+
+	if c.Old != nil {
+		fmt.Fprintf(w, " -%d", c.Old.Line)
+	}
+
+	if c.New != nil {
+		fmt.Fprintf(w, " +%d", c.New.Line)
+	}
+
+	fmt.Fprintf(w, " @@ %s %s\n", noun(c.Type, 1), c.Op)
+
+	if c.Old != nil {
+		for _, line := range render(*c.Old) {
+			fmt.Fprintf(w, "-%s\n", line)
+		}
+	}
+
+	if c.New != nil {
+		for _, line := range render(*c.New) {
+			fmt.Fprintf(w, "+%s\n", line)
+		}
+	}
+}
+
+// elementsFile returns the elements of the named Gemini text file.
+func elementsFile(name string) ([]ast.Block, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	blocks, err := elements(f)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	return blocks, nil
+}
+
+// elements reads Gemini text and returns its elements to compare.  Each
+// heading, link, list item and quote line is an element, consecutive text
+// lines are a paragraph, and preformatted text is a single element.  Blank
+// lines are not elements, and whitespace is normalized outside of
+// preformatted text.
+func elements(r io.Reader) ([]ast.Block, error) {
+	var blocks []ast.Block
+
+	s := gmitxt.NewScanner(r)
+	para := false // whether the last element is an open paragraph
+
+	for s.Scan() {
+		line := s.Line()
+		text := strings.Join(strings.Fields(string(line.Text)), " ")
+		b := ast.Block{Line: line.Num, Text: text}
+		last := len(blocks) - 1
+
+		switch line.Type {
+		case gmitxt.Head1, gmitxt.Head2, gmitxt.Head3:
+			b.Type, b.Level = ast.BlockHeading, int(line.Type-gmitxt.Head1)+1
+		case gmitxt.Text:
+			if text == "" {
+				para = false
+
+				continue
+			}
+
+			if para {
+				blocks[last].Text += " " + text
+
+				continue
+			}
+
+			b.Type = ast.BlockText
+		case gmitxt.Link:
+			b.Type, b.URL = ast.BlockLink, string(line.URL)
+		case gmitxt.List:
+			b.Type, b.Text, b.Lines = ast.BlockList, "", []string{text}
+		case gmitxt.Quote:
+			b.Type, b.Text, b.Lines = ast.BlockQuote, "", []string{text}
+		case gmitxt.PreStart:
+			b.Type = ast.BlockPre
+		case gmitxt.PreBody:
+			blocks[last].Lines = append(blocks[last].Lines,
+				strings.TrimRight(string(line.Text), " \t"))
+
+			continue
+		case gmitxt.PreEnd:
+			continue
+		}
+
+		para = b.Type == ast.BlockText
+		blocks = append(blocks, b)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err // nolint: wrapcheck // wrapped by caller
+	}
+
+	return blocks, nil
+}
+
+// render returns the lines of the element as Gemini text in its canonical
+// form.
+func render(b ast.Block) []string {
+	doc := ast.Document{Blocks: []ast.Block{b}}
+	lines, _ := doc.Lines() // elements are valid
+
+	var buf strings.Builder
+
+	w := gmitxt.NewWriter(&buf)
+
+	for _, line := range lines {
+		w.Write(line) // nolint: errcheck // cannot fail in memory
+	}
+
+	w.Flush()
+
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// compare returns the changes that turn the elements of a into those of b.
+// Within each run of removed and added elements, a removed element is paired
+// with the next added element of the same type as a change.
+func compare(a, b []ast.Block) []change {
+	keyA, keyB := keys(a), keys(b)
+	edits := diff.Diff(len(a), len(b), func(i, j int) bool {
+		return keyA[i] == keyB[j]
+	})
+
+	var changes []change
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == diff.Equal {
+			i++
+
+			continue
+		}
+
+		var removed, added []ast.Block
+
+		for ; i < len(edits) && edits[i].Op != diff.Equal; i++ {
+			if edits[i].Op == diff.Delete {
+				removed = append(removed, a[edits[i].A])
+			} else {
+				added = append(added, b[edits[i].B])
+			}
+		}
+
+		changes = append(changes, pair(removed, added)...)
+	}
+
+	return changes
+}
+
+// keys returns the canonical Gemini text of the elements to compare them.
+func keys(blocks []ast.Block) []string {
+	k := make([]string, len(blocks))
+
+	for i, b := range blocks {
+		k[i] = strings.Join(render(b), "\n")
+	}
+
+	return k
+}
+
+// pair returns the changes of a run of removed and added elements, in the
+// order of the added elements.
+func pair(removed, added []ast.Block) []change {
+	var changes []change
+
+	next := 0 // index of the first added element that is not paired
+
+	for i := range removed {
+		old := &removed[i]
+
+		j := next
+		for j < len(added) && added[j].Type != old.Type {
+			j++
+		}
+
+		if j == len(added) {
+			changes = append(changes, change{opRemoved, old.Type, old, nil})
+
+			continue
+		}
+
+		for ; next < j; next++ {
+			changes = append(changes,
+				change{opAdded, added[next].Type, nil, &added[next]})
+		}
+
+		changes = append(changes, change{opChanged, old.Type, old, &added[j]})
+		next = j + 1
+	}
+
+	for ; next < len(added); next++ {
+		changes = append(changes,
+			change{opAdded, added[next].Type, nil, &added[next]})
+	}
+
+	return changes
+}
+
+// summarize returns a summary of the number of changes of each type, such as
+// "3 links changed, 1 section added".
+func summarize(changes []change) string {
+	var parts []string
+
+	for _, typ := range []string{
+		ast.BlockHeading, ast.BlockText, ast.BlockLink, ast.BlockList,
+		ast.BlockQuote, ast.BlockPre,
+	} {
+		for _, op := range []string{opAdded, opRemoved, opChanged} {
+			n := 0
+
+			for _, c := range changes {
+				if c.Type == typ && c.Op == op {
+					n++
+				}
+			}
+
+			if n != 0 {
+				parts = append(parts,
+					fmt.Sprintf("%d %s %s", n, noun(typ, n), op))
+			}
+		}
+	}
+
+	if parts == nil {
+		return "no changes"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// noun returns the noun for n elements of the type.
+func noun(typ string, n int) string {
+	nouns := map[string][2]string{
+		ast.BlockHeading: {"section", "sections"},
+		ast.BlockText:    {"paragraph", "paragraphs"},
+		ast.BlockLink:    {"link", "links"},
+		ast.BlockList:    {"list item", "list items"},
+		ast.BlockQuote:   {"quote", "quotes"},
+		ast.BlockPre:     {"preformatted block", "preformatted blocks"},
+	}
+
+	if n == 1 {
+		return nouns[typ][0]
+	}
+
+	return nouns[typ][1]
+}
@@ -0,0 +1,150 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestDiff(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"a.gmi": "#Title\n" +
+			"Some text that was\n" +
+			"reflowed.\n" +
+			"\n" +
+			"=> /old.gmi Old\n" +
+			"=>/same.gmi   Same\n" +
+			"* one\n" +
+			"```go\n" +
+			"x := 1\n" +
+			"```\n" +
+			"> gone\n",
+		"b.gmi": "# Title\n" +
+			"Some text that\n" +
+			"was reflowed.\n" +
+			"=> /new.gmi New\n" +
+			"=> /same.gmi Same\n" +
+			"## Added\n" +
+			"* one\n" +
+			"* two\n" +
+			"```go\n" +
+			"x := 2\n" +
+			"```\n",
+		"c.gmi": "# Title\n\nSome text that was reflowed.\n" +
+			"=> /old.gmi Old\n=> /same.gmi Same\n* one\n" +
+			"```go \nx := 1  \n```\n> gone\n",
+	})
+	a := filepath.Join(dir, "a.gmi")
+	b := filepath.Join(dir, "b.gmi")
+
+	code, stdout, _ := run(t, "", "diff", a, b)
+	expectCode(t, code, 1)
+
+	expected := "--- " + a + "\n+++ " + b + "\n" +
+		"@@ -5 +4 @@ link changed\n" +
+		"-=> /old.gmi Old\n" +
+		"+=> /new.gmi New\n" +
+		"@@ +6 @@ section added\n" +
+		"+## Added\n" +
+		"@@ +8 @@ list item added\n" +
+		"+* two\n" +
+		"@@ -8 +9 @@ preformatted block changed\n" +
+		"-```go\n" +
+		"-x := 1\n" +
+		"-```\n" +
+		"+```go\n" +
+		"+x := 2\n" +
+		"+```\n" +
+		"@@ -11 @@ quote removed\n" +
+		"->gone\n"
+	if stdout != expected {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "diff", "-summary", a, b)
+	expectCode(t, code, 1)
+
+	expected = "1 section added, 1 link changed, 1 list item added, " +
+		"1 quote removed, 1 preformatted block changed\n"
+	if stdout != expected {
+		t.Errorf("Expected summary %q, got: %q", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "diff", "-json", a, b)
+	expectCode(t, code, 1)
+
+	var res struct {
+		Changes []struct {
+			Op   string
+			Type string
+			Old  *struct{ Line int }
+			New  *struct {
+				Line int
+				URL  string
+			}
+		}
+		Summary string
+	}
+
+	if err := json.Unmarshal([]byte(stdout), &res); err != nil {
+		t.Fatalf("could not decode JSON output: %v\n%s", err, stdout)
+	}
+
+	if len(res.Changes) != 5 || res.Changes[0].Op != "changed" ||
+		res.Changes[0].Type != "link" || res.Changes[0].Old.Line != 5 ||
+		res.Changes[0].New.URL != "/new.gmi" ||
+		res.Changes[4].New != nil || res.Summary != expected[:len(expected)-1] {
+		t.Errorf("Expected 5 changes, got: %+v", res)
+	}
+
+	t.Log("checking files without changes")
+
+	c := filepath.Join(dir, "c.gmi")
+
+	code, stdout, _ = run(t, "", "diff", a, c)
+	expectCode(t, code, 0)
+
+	if stdout != "" {
+		t.Errorf("Expected no diff, got:\n%s", stdout)
+	}
+
+	code, stdout, _ = run(t, "", "diff", "-summary", a, c)
+	expectCode(t, code, 0)
+
+	if stdout != "no changes\n" {
+		t.Errorf("Expected no changes, got: %q", stdout)
+	}
+
+	code, stdout, _ = run(t, "", "diff", "-json", a, c)
+	expectCode(t, code, 0)
+
+	if !strings.Contains(stdout, `"changes": []`) {
+		t.Errorf("Expected no changes, got:\n%s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	for _, args := range [][]string{
+		{"diff", filepath.Join(dir, "no.gmi"), b},
+		{"diff", a, filepath.Join(dir, "no.gmi")},
+	} {
+		code, _, stderr := run(t, "", args...)
+		expectCode(t, code, 1)
+
+		if !strings.Contains(stderr, "problem reading") {
+			t.Errorf("Expected reading error, got: %q", stderr)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"diff"},
+		{"diff", a},
+		{"diff", "-x", a, b},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
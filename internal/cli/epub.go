@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"git.sr.ht/~kiba/gmitxt/epub"
+)
+
+const epubDesc = `Epub writes Gemini text files as an EPUB 3 e-book, with each file as a chapter
+in the order they are given.  The chapters are rendered as XHTML, the table of
+contents is built from their headings, and the local images they link to are
+included in the book.  Links to the other chapters link to them in the book.
+
+The title of the book is the first level 1 heading of the chapters, and its
+language is the one of the first chapter, unless they are set with -title and
+-lang.`
+
+// epubCmd holds the flags of the epub command.
+type epubCmd struct {
+	out  string
+	opts epub.Options
+}
+
+// runEpub runs the epub command.
+func runEpub(e *env, args []string) error {
+	var c epubCmd
+
+	fs := flags(e, "epub", "-o book.epub [flags] file...", epubDesc)
+	fs.StringVar(&c.out, "o", "", "write the book to the `file`")
+	fs.StringVar(&c.opts.Title, "title", "", "the `title` of the book")
+	fs.StringVar(&c.opts.Author, "author", "", "the `author` of the book")
+	fs.StringVar(&c.opts.Lang, "lang", "",
+		"the `language` of the book, such as en")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if c.out == "" || fs.NArg() == 0 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	chapters := make([]epub.Chapter, 0, fs.NArg())
+
+	for _, name := range fs.Args() {
+		text, err := ioutil.ReadFile(name) // nolint: gosec // chapter
+		if err != nil {
+			return fmt.Errorf("problem reading %s: %w", name, err)
+		}
+
+		chapters = append(chapters, epub.Chapter{Name: name, Text: text})
+	}
+
+	var buf bytes.Buffer
+
+	if err := epub.Write(&buf, chapters, c.opts); err != nil {
+		return err // nolint: wrapcheck // has context
+	}
+
+	err := ioutil.WriteFile(c.out, buf.Bytes(), 0o644) // nolint: gosec // book
+	if err != nil {
+		return fmt.Errorf("problem writing %s: %w", c.out, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli_test
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestEpub(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"1.gmi":   "# One\n=> cat.png Cat\n",
+		"2.gmi":   "# Two\n=> missing.png\n",
+		"cat.png": "png",
+	})
+	out := filepath.Join(dir, "book.epub")
+
+	code, stdout, stderr := run(t, "", "epub", "-o", out, "-title", "Book",
+		"-author", "Kiba", "-lang", "en", filepath.Join(dir, "1.gmi"))
+	expectCode(t, code, 0)
+
+	if stdout != "" || stderr != "" {
+		t.Errorf("Expected no output, got stdout: %q, stderr: %q", stdout,
+			stderr)
+	}
+
+	z, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("could not open book: %v", err)
+	}
+	defer z.Close()
+
+	var names []string
+	for _, f := range z.File {
+		names = append(names, f.Name)
+	}
+
+	expected := "mimetype META-INF/container.xml OEBPS/ch001.xhtml " +
+		"OEBPS/images/img001.png OEBPS/nav.xhtml OEBPS/content.opf"
+	if actual := strings.Join(names, " "); actual != expected {
+		t.Errorf("Expected files %q, got: %q", expected, actual)
+	}
+
+	t.Log("checking errors")
+
+	code, _, stderr = run(t, "", "epub", "-o", out,
+		filepath.Join(dir, "2.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem reading image of") {
+		t.Errorf("Expected image error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "epub", "-o", out,
+		filepath.Join(dir, "3.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem reading") {
+		t.Errorf("Expected reading error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "epub", "-o", filepath.Join(dir, "no",
+		"book.epub"), filepath.Join(dir, "1.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem writing") {
+		t.Errorf("Expected writing error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"epub", filepath.Join(dir, "1.gmi")},
+		{"epub", "-o", out},
+		{"epub", "-x", "-o", out, filepath.Join(dir, "1.gmi")},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+)
+
+// gmiFiles returns the files for the paths given as arguments to a command.  A
+// path to a file is returned as it is.  A path to a directory is walked and
+// the Gemini text files in it are returned in lexical order.
+func gmiFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("problem reading %s: %w", path, err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+
+			continue
+		}
+
+		err = filepath.Walk(path, func(
+			name string, info os.FileInfo, err error,
+		) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && filepath.Ext(name) == capsule.Ext {
+				files = append(files, name)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("problem walking %s: %w", path, err)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// writeFile replaces the contents of the file with the given data.  The data is
+// written to a temporary file in the same directory, which is renamed to the
+// file, so the file is either fully replaced or left as it was.
+func writeFile(name string, data []byte) (err error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("problem creating temporary file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name()) // nolint: errcheck,gosec // best effort
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck,gosec // already failed
+
+		return fmt.Errorf("problem writing %s: %w", tmp.Name(), err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("problem writing %s: %w", tmp.Name(), err)
+	}
+
+	if err = os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return fmt.Errorf("problem setting mode of %s: %w", tmp.Name(), err)
+	}
+
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("problem replacing %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/diff"
+)
+
+var errStdinWrite = errors.New("cannot use -w with standard input")
+
+const fmtDesc = `Fmt formats Gemini text in its canonical form.  Headings and links have
+a single space after their tokens, trailing whitespace is stripped outside of
+preformatted text, text after closing fences is dropped, and each line ends
+with a new line.
+
+Without paths, it formats standard input to standard output.  Paths to
+directories format the .gmi files in them.  By default, the formatted text is
+written to standard output.`
+
+// fmtOptions are the flags of the fmt command.
+type fmtOptions struct {
+	write bool // rewrite files in place
+	list  bool // list files that differ
+	diff  bool // write diffs of files that differ
+	opts  gmitxt.FormatOptions
+}
+
+// runFmt runs the fmt command.
+func runFmt(e *env, args []string) error {
+	var o fmtOptions
+
+	fs := flags(e, "fmt", "[flags] [path ...]", fmtDesc)
+	fs.BoolVar(&o.write, "w", false,
+		"write the result to the file instead of standard output")
+	fs.BoolVar(&o.list, "l", false, "list files whose formatting differs")
+	fs.BoolVar(&o.diff, "d", false, "write diffs instead of the result")
+	fs.BoolVar(&o.opts.CollapseBlank, "collapse", false,
+		"collapse runs of blank lines into a single blank line")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		if o.write {
+			return errStdinWrite
+		}
+
+		src, err := ioutil.ReadAll(e.stdin)
+		if err != nil {
+			return fmt.Errorf("problem reading standard input: %w", err)
+		}
+
+		return o.format(e, stdinName, src)
+	}
+
+	files, err := gmiFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name) // nolint: gosec // file to format
+		if err != nil {
+			return fmt.Errorf("problem reading %s: %w", name, err)
+		}
+
+		if err := o.format(e, name, src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// format formats the Gemini text of the named file and handles the result as
+// set by the flags.
+func (o *fmtOptions) format(e *env, name string, src []byte) error {
+	var buf bytes.Buffer
+
+	if err := gmitxt.Format(&buf, bytes.NewReader(src), o.opts); err != nil {
+		return fmt.Errorf("problem formatting %s: %w", name, err)
+	}
+
+	res := buf.Bytes()
+
+	if !o.write && !o.list && !o.diff {
+		if _, err := e.stdout.Write(res); err != nil {
+			return fmt.Errorf("problem writing %s: %w", name, err)
+		}
+
+		return nil
+	}
+
+	if bytes.Equal(src, res) {
+		return nil
+	}
+
+	if o.list {
+		fmt.Fprintln(e.stdout, name)
+	}
+
+	if o.write {
+		if err := writeFile(name, res); err != nil {
+			return err
+		}
+	}
+
+	if o.diff {
+		err := diff.Unified(e.stdout, name+".orig", name,
+			lines(src), lines(res))
+		if err != nil {
+			return fmt.Errorf("problem writing diff of %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// lines splits text into lines without their new lines.
+func lines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,122 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+const (
+	unformatted = "#Heading \n=>\tfoo.gmi  Foo \n\n\n```alt\n  \n```end\n"
+	formatted   = "# Heading\n=> foo.gmi Foo\n\n\n```alt\n  \n```\n"
+	collapsed   = "# Heading\n=> foo.gmi Foo\n\n```alt\n  \n```\n"
+)
+
+func TestFmt(t *testing.T) {
+	t.Log("formatting standard input")
+
+	code, stdout, stderr := run(t, unformatted, "fmt")
+	expectCode(t, code, 0)
+
+	if stdout != formatted || stderr != "" {
+		t.Errorf("Expected formatted stdout %q, got: %q, stderr: %q",
+			formatted, stdout, stderr)
+	}
+
+	code, stdout, _ = run(t, unformatted, "fmt", "-collapse")
+	expectCode(t, code, 0)
+
+	if stdout != collapsed {
+		t.Errorf("Expected collapsed stdout %q, got: %q", collapsed, stdout)
+	}
+
+	code, _, stderr = run(t, unformatted, "fmt", "-w")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "standard input") {
+		t.Errorf("Expected error for -w with standard input, got: %q",
+			stderr)
+	}
+
+	t.Log("formatting files")
+
+	dir := testutil.TempDir(t, map[string]string{
+		"a.gmi":     unformatted,
+		"b.gmi":     formatted,
+		"sub/c.gmi": unformatted,
+		"sub/d.txt": unformatted,
+	})
+
+	code, stdout, _ = run(t, "", "fmt", filepath.Join(dir, "a.gmi"))
+	expectCode(t, code, 0)
+
+	if stdout != formatted {
+		t.Errorf("Expected formatted stdout %q, got: %q", formatted, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "fmt", "-l", dir)
+	expectCode(t, code, 0)
+
+	expected := filepath.Join(dir, "a.gmi") + "\n" +
+		filepath.Join(dir, "sub", "c.gmi") + "\n"
+	if stdout != expected {
+		t.Errorf("Expected list of files %q, got: %q", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "fmt", "-d", filepath.Join(dir, "a.gmi"))
+	expectCode(t, code, 0)
+
+	for _, line := range []string{
+		"-#Heading ", "+# Heading", "-```end", "+```",
+	} {
+		if !strings.Contains(stdout, "\n"+line+"\n") {
+			t.Errorf("Expected diff to have line %q, got:\n%s", line, stdout)
+		}
+	}
+
+	code, stdout, _ = run(t, "", "fmt", "-w", "-l", dir)
+	expectCode(t, code, 0)
+
+	if stdout != expected {
+		t.Errorf("Expected list of files %q, got: %q", expected, stdout)
+	}
+
+	for _, name := range []string{"a.gmi", "b.gmi", "sub/c.gmi"} {
+		if data := readFile(t, dir, name); data != formatted {
+			t.Errorf("Expected %s to be formatted as %q, got: %q",
+				name, formatted, data)
+		}
+	}
+
+	if data := readFile(t, dir, "sub/d.txt"); data != unformatted {
+		t.Errorf("Expected sub/d.txt to not be formatted, got: %q", data)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "a.gmi"))
+	if err != nil {
+		t.Fatalf("could not stat a.gmi: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode of a.gmi to be kept, got: %v", info.Mode())
+	}
+}
+
+func TestFmtErrors(t *testing.T) {
+	code, _, stderr := run(t, "", "fmt", "-x")
+	expectCode(t, code, 2)
+
+	if !strings.Contains(stderr, "usage: gmitxt fmt") {
+		t.Errorf("Expected usage on stderr, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "fmt", "does-not-exist.gmi")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "does-not-exist.gmi") {
+		t.Errorf("Expected error for missing file, got: %q", stderr)
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"git.sr.ht/~kiba/gmitxt/include"
+)
+
+const includeDesc = `Include expands the include links of a Gemini text file, or of standard input
+without a file, and writes the text to standard output.  An include link is a
+link with a URL that starts with the prefix, such as:
+
+	=> include:footer.gmi
+
+It is replaced by the lines of the file, with its headings moved below the
+heading before the link.  Paths are relative to the directory of the file with
+the link, or to the current directory for standard input.`
+
+// runInclude runs the include command.
+func runInclude(e *env, args []string) error {
+	var opts include.Options
+
+	fs := flags(e, "include", "[flags] [file]", includeDesc)
+	fs.StringVar(&opts.Prefix, "prefix", include.DefaultPrefix,
+		"the URL `prefix` of include links")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	name, src := stdinName, e.stdin
+
+	if fs.NArg() == 1 {
+		name = fs.Arg(0)
+
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("problem reading %s: %w", name, err)
+		}
+		defer f.Close()
+
+		src = f
+	}
+
+	err := include.Expand(e.stdout, name, src, opts)
+
+	return err // nolint: wrapcheck // has the position of the problem
+}
@@ -0,0 +1,58 @@
+package cli_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestInclude(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi":        "# Page\n## Contact\n=> include:parts/footer.gmi\n",
+		"parts/footer.gmi": "# Footer\nBye\n",
+		"loop.gmi":         "=> @loop.gmi\n",
+	})
+
+	code, stdout, _ := run(t, "", "include", filepath.Join(dir, "index.gmi"))
+	expectCode(t, code, 0)
+
+	if expected := "# Page\n## Contact\n### Footer\nBye\n"; stdout !=
+		expected {
+		t.Errorf("Expected expanded text:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "=> @"+filepath.Join(dir, "parts/footer.gmi")+
+		"\n", "include", "-prefix", "@")
+	expectCode(t, code, 0)
+
+	if stdout != "# Footer\nBye\n" {
+		t.Errorf("Expected expanded standard input, got:\n%s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	code, _, stderr := run(t, "", "include", "-prefix", "@",
+		filepath.Join(dir, "loop.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "loop.gmi:1: include cycle") {
+		t.Errorf("Expected cycle error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "include", filepath.Join(dir, "no.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem reading") {
+		t.Errorf("Expected reading error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"include", "-x"},
+		{"include", "a.gmi", "b.gmi"},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
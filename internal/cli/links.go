@@ -0,0 +1,483 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt/linkgraph"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+var (
+	errFormat   = errors.New("unknown format")
+	errInternal = errors.New("cannot use -internal with -external")
+	errDOT      = errors.New("cannot use -dot with -backlinks")
+)
+
+const linksDesc = `Links works with the links in Gemini text files.  The commands are:
+
+	check      check for broken links in capsule directories
+	list       list the links in Gemini text files
+	graph      report orphan pages and dead ends, backlinks or a DOT graph`
+
+const linksCheckDesc = `Check checks the links in the .gmi files of capsule directories and reports
+each broken link as:
+
+	file:line: url: message
+
+A link is broken when its target does not exist, or when its fragment does not
+match a heading of the target.  Links with an absolute path are resolved
+against the capsule directory.  Links to remote resources are not checked.  It
+exits with status 1 when broken links are found.`
+
+// runLinks runs the links command, which runs the command named by the first
+// argument.
+func runLinks(e *env, args []string) error {
+	fs := flags(e, "links", "<command> [arguments]", linksDesc)
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	switch fs.Arg(0) {
+	case "check":
+		return runLinksCheck(e, fs.Args()[1:])
+	case "list":
+		return runLinksList(e, fs.Args()[1:])
+	case "graph":
+		return runLinksGraph(e, fs.Args()[1:])
+	}
+
+	fmt.Fprintf(e.stderr, "gmitxt links: unknown command %q\n", fs.Arg(0))
+	fmt.Fprintln(e.stderr, "Run 'gmitxt links -h' for usage.")
+
+	return errUsage
+}
+
+// runLinksCheck runs the links check command.
+func runLinksCheck(e *env, args []string) error {
+	var asJSON bool
+
+	fs := flags(e, "links check", "[flags] dir ...", linksCheckDesc)
+	fs.BoolVar(&asJSON, "json", false, "report broken links as a JSON array")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	var problems []links.Problem
+
+	for _, dir := range fs.Args() {
+		var c links.Checker
+
+		p, err := c.Check(dir)
+		if err != nil {
+			return err // nolint: wrapcheck // has context
+		}
+
+		problems = append(problems, p...)
+	}
+
+	if asJSON {
+		if problems == nil {
+			problems = []links.Problem{}
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "\t")
+
+		if err := enc.Encode(problems); err != nil {
+			return fmt.Errorf("problem writing broken links: %w", err)
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Fprintln(e.stdout, p)
+		}
+	}
+
+	if len(problems) != 0 {
+		return errFailed
+	}
+
+	return nil
+}
+
+const linksListDesc = `List writes the links in Gemini text files with the file and line they are
+in, their URL as it is in the text, the resolved URL, its scheme and host, and
+the text of the link.  The links are written as tab-separated values by
+default, or as JSON Lines or CSV with -format.  Tab-separated values and CSV
+start with a header of the names of the fields.
+
+Without paths, it lists the links in standard input.  Paths to directories list
+the links in the .gmi files in them.  Links are resolved against the path of
+their file in the directory, or against the -base URL of the directory, such
+as gemini://example.org/.  Links with the same scheme and host as the -base
+URL, or without a scheme and host, are internal.
+
+A gemini:// URL can be given instead of a path to list the links in the Gemini
+text of the response, resolved against its URL unless -base is set.  The
+certificate of the server is trusted on first use with -known-hosts.`
+
+// linksList are the options of the links list command.
+type linksList struct {
+	format   string
+	base     string
+	schemes  string
+	host     string
+	internal bool
+	external bool
+	hosts    string
+
+	baseURL *url.URL
+	write   func(link links.Link) error
+}
+
+// runLinksList runs the links list command.
+func runLinksList(e *env, args []string) error {
+	var o linksList
+
+	fs := flags(e, "links list", "[flags] [path | url ...]", linksListDesc)
+	fs.StringVar(&o.format, "format", "tsv",
+		"write links as `tsv`, jsonl or csv")
+	fs.StringVar(&o.base, "base", "", "resolve links against the `URL`")
+	fs.StringVar(&o.schemes, "scheme", "",
+		"list links with the comma-separated `schemes`, such as gemini,https")
+	fs.StringVar(&o.host, "host", "",
+		"list links with a host that matches the `glob`, such as *.org")
+	fs.BoolVar(&o.internal, "internal", false, "list internal links")
+	fs.BoolVar(&o.external, "external", false, "list external links")
+	knownHostsFlag(fs, &o.hosts)
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	flush, err := o.init(e.stdout)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		it := links.ExtractLinks(e.stdin)
+		it.Source(stdinName, o.baseURL)
+
+		if err := o.list(stdinName, it); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range fs.Args() {
+		list := o.listPath
+		if isURL(p) {
+			list = o.listURL
+		}
+
+		if err := list(p); err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// init checks the options and sets up the writer of the links.  It returns a
+// function to flush the links written.
+func (o *linksList) init(w io.Writer) (func() error, error) {
+	if o.internal && o.external {
+		return nil, errInternal
+	}
+
+	if _, err := path.Match(o.host, ""); err != nil {
+		return nil, fmt.Errorf("problem with -host: %w", err)
+	}
+
+	if o.base != "" {
+		u, err := url.Parse(o.base)
+		if err != nil {
+			return nil, fmt.Errorf("problem with -base: %w", err)
+		}
+
+		o.baseURL = u
+	}
+
+	none := func() error { return nil }
+
+	switch o.format {
+	case "tsv":
+		fmt.Fprintln(w, strings.Join(linkFields, "\t"))
+
+		o.write = func(link links.Link) error {
+			fields := linkRecord(link)
+			for i, f := range fields {
+				fields[i] = tsvReplacer.Replace(f)
+			}
+
+			_, err := fmt.Fprintln(w, strings.Join(fields, "\t"))
+
+			return err // nolint: wrapcheck // wrapped by list
+		}
+
+		return none, nil
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		o.write = func(link links.Link) error {
+			return enc.Encode(link) // nolint: wrapcheck // wrapped by list
+		}
+
+		return none, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		o.write = func(link links.Link) error {
+			return cw.Write(linkRecord(link)) // nolint: wrapcheck // wrapped
+		}
+
+		if err := cw.Write(linkFields); err != nil {
+			return nil, fmt.Errorf("problem writing links: %w", err)
+		}
+
+		return func() error {
+			cw.Flush()
+
+			if err := cw.Error(); err != nil {
+				return fmt.Errorf("problem writing links: %w", err)
+			}
+
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errFormat, o.format)
+}
+
+// tsvReplacer replaces the characters that cannot be in a tab-separated value
+// with spaces.
+var tsvReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// linkFields are the names of the fields of a link written as TSV or CSV.
+var linkFields = []string{
+	"file", "line", "url", "resolved", "scheme", "host", "text",
+}
+
+// linkRecord returns the fields of a link written as TSV or CSV.
+func linkRecord(link links.Link) []string {
+	return []string{
+		link.File,
+		strconv.FormatUint(uint64(link.Line), 10),
+		link.URL,
+		link.Resolved,
+		link.Scheme,
+		link.Host,
+		link.Text,
+	}
+}
+
+// listPath lists the links in the file or the .gmi files in the directory at
+// the path.  Links are resolved against the path of their file relative to
+// the directory, or the directory of the file.
+func (o *linksList) listPath(p string) error {
+	files, err := gmiFiles([]string{p})
+	if err != nil {
+		return err
+	}
+
+	root := p
+	if len(files) == 1 && files[0] == p {
+		root = filepath.Dir(p)
+	}
+
+	base := o.baseURL
+	if base == nil {
+		base = &url.URL{Path: "/"}
+	}
+
+	for _, name := range files {
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return fmt.Errorf("problem with %s: %w", name, err)
+		}
+
+		if err := o.listFile(name,
+			base.ResolveReference(&url.URL{Path: filepath.ToSlash(rel)}),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listFile lists the links in the named file, resolved against the URL.
+func (o *linksList) listFile(name string, base *url.URL) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("problem reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	it := links.ExtractLinks(f)
+	it.Source(name, base)
+
+	return o.list(name, it)
+}
+
+// listURL lists the links in the Gemini text at the gemini URL, resolved
+// against the URL of the response or the -base URL.
+func (o *linksList) listURL(rawurl string) error {
+	s, res, err := fetch(rawurl, o.hosts)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	base := o.baseURL
+	if base == nil {
+		base = res.URL
+	}
+
+	it := links.ScanLinks(s)
+	it.Source(rawurl, base)
+
+	return o.list(rawurl, it)
+}
+
+// list writes the links of the iterator over the named file that match the
+// filters.
+func (o *linksList) list(name string, it *links.Iter) error {
+	for it.Next() {
+		link := it.Link()
+		if !o.match(link) {
+			continue
+		}
+
+		if err := o.write(link); err != nil {
+			return fmt.Errorf("problem writing links: %w", err)
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// match returns whether the link matches the filters.
+func (o *linksList) match(link links.Link) bool {
+	if o.internal && !link.Internal || o.external && link.Internal {
+		return false
+	}
+
+	if o.schemes != "" && !matchScheme(o.schemes, link.Scheme) {
+		return false
+	}
+
+	if o.host != "" {
+		// The pattern was checked, so there is no error.
+		ok, _ := path.Match(o.host, strings.ToLower(link.Host))
+
+		return ok
+	}
+
+	return true
+}
+
+// matchScheme returns whether the scheme is in the comma-separated list of
+// schemes.
+func matchScheme(schemes, scheme string) bool {
+	for _, s := range strings.Split(schemes, ",") {
+		if strings.EqualFold(strings.TrimSpace(s), scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const linksGraphDesc = `Graph builds the graph of the internal links between the pages of a capsule
+directory.  Pages are keyed by their path in the capsule, such as
+/blog/index.gmi.  By default, it reports the pages no other page links to and
+the pages that link to no other page as:
+
+	orphan /drafts/page.gmi
+	dead-end /blog/post.gmi
+
+With -backlinks, it writes the pages linking to a page as Gemini text link
+lines, which can be appended to the page when building a site.  With -dot, it
+writes the graph in the DOT language of Graphviz.`
+
+// runLinksGraph runs the links graph command.
+func runLinksGraph(e *env, args []string) error {
+	var (
+		dot       bool
+		backlinks string
+		heading   string
+	)
+
+	fs := flags(e, "links graph", "[flags] dir", linksGraphDesc)
+	fs.BoolVar(&dot, "dot", false, "write the graph in the DOT language")
+	fs.StringVar(&backlinks, "backlinks", "",
+		"write the pages linking to the page at the `path`")
+	fs.StringVar(&heading, "heading", "",
+		"write the backlinks after a level 2 heading with the `text`")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	if dot && backlinks != "" {
+		return errDOT
+	}
+
+	g, err := linkgraph.Build(fs.Arg(0))
+	if err != nil {
+		return err // nolint: wrapcheck // has context
+	}
+
+	switch {
+	case dot:
+		err = g.WriteDOT(e.stdout)
+	case backlinks != "":
+		err = g.WriteBacklinks(e.stdout, backlinks, heading)
+	default:
+		for _, p := range g.Orphans() {
+			fmt.Fprintln(e.stdout, "orphan", p)
+		}
+
+		for _, p := range g.DeadEnds() {
+			fmt.Fprintln(e.stdout, "dead-end", p)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("problem writing graph: %w", err)
+	}
+
+	return nil
+}
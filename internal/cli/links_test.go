@@ -0,0 +1,259 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestLinksCheck(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi":     "# Home\n=> about.gmi About\n=> gone.gmi Gone\n",
+		"about.gmi":     "# About\n=> /#home Home\n=> /#nope Nope\n",
+		"sub/index.gmi": "=> gemini://example.org/ Remote\n=> ../ Up\n",
+	})
+
+	code, stdout, _ := run(t, "", "links", "check", dir)
+	expectCode(t, code, 1)
+
+	expected := filepath.Join(dir, "about.gmi") +
+		":3: /#nope: no heading matches the fragment\n" +
+		filepath.Join(dir, "index.gmi") +
+		":3: gone.gmi: target does not exist\n"
+	if stdout != expected {
+		t.Errorf("Expected broken links:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "links", "check", "-json", dir)
+	expectCode(t, code, 1)
+
+	var problems []struct {
+		File string
+		Line int
+		URL  string
+	}
+
+	if err := json.Unmarshal([]byte(stdout), &problems); err != nil {
+		t.Fatalf("could not decode JSON output: %v\n%s", err, stdout)
+	}
+
+	if len(problems) != 2 || problems[1].URL != "gone.gmi" ||
+		problems[1].Line != 3 {
+		t.Errorf("Expected 2 broken links, got: %+v", problems)
+	}
+
+	code, stdout, _ = run(t, "", "links", "check",
+		filepath.Join(dir, "sub"))
+	expectCode(t, code, 0)
+
+	if stdout != "" {
+		t.Errorf("Expected no broken links, got:\n%s", stdout)
+	}
+
+	code, stdout, _ = run(t, "", "links", "check", "-json",
+		filepath.Join(dir, "sub"))
+	expectCode(t, code, 0)
+
+	if strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("Expected an empty JSON array, got: %s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	code, _, stderr := run(t, "", "links", "check", filepath.Join(dir, "no"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem checking") {
+		t.Errorf("Expected checking error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"links"},
+		{"links", "-x"},
+		{"links", "nope"},
+		{"links", "check"},
+		{"links", "check", "-x"},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
+
+func TestLinksList(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi": "# Home\n=> blog/ Blog\n=> https://example.com/ Web\n",
+		"blog/index.gmi": "=> post.gmi A\tpost\n" +
+			"=> gemini://example.org/ Home\n" +
+			"=> mailto:kiba@example.org Mail\n",
+	})
+	index := filepath.Join(dir, "index.gmi")
+	blog := filepath.Join(dir, "blog", "index.gmi")
+
+	t.Log("checking tab-separated values")
+
+	code, stdout, _ := run(t, "", "links", "list", dir)
+	expectCode(t, code, 0)
+
+	expected := "file\tline\turl\tresolved\tscheme\thost\ttext\n" +
+		blog + "\t1\tpost.gmi\t/blog/post.gmi\t\t\tA post\n" +
+		blog + "\t2\tgemini://example.org/\tgemini://example.org/\tgemini\t" +
+		"example.org\tHome\n" +
+		blog + "\t3\tmailto:kiba@example.org\tmailto:kiba@example.org\t" +
+		"mailto\t\tMail\n" +
+		index + "\t2\tblog/\t/blog/\t\t\tBlog\n" +
+		index + "\t3\thttps://example.com/\thttps://example.com/\thttps\t" +
+		"example.com\tWeb\n"
+	if stdout != expected {
+		t.Errorf("Expected links:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	t.Log("checking CSV with filters")
+
+	code, stdout, _ = run(t, "", "links", "list", "-format", "csv",
+		"-base", "gemini://example.org/", "-internal", blog)
+	expectCode(t, code, 0)
+
+	expected = "file,line,url,resolved,scheme,host,text\n" +
+		blog + ",1,post.gmi,gemini://example.org/post.gmi,gemini," +
+		"example.org,A\tpost\n" +
+		blog + ",2,gemini://example.org/,gemini://example.org/,gemini," +
+		"example.org,Home\n"
+	if stdout != expected {
+		t.Errorf("Expected links:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "links", "list", "-format", "csv",
+		"-scheme", "gemini, https", "-host", "*.com", "-external", dir)
+	expectCode(t, code, 0)
+
+	expected = "file,line,url,resolved,scheme,host,text\n" +
+		index + ",3,https://example.com/,https://example.com/,https," +
+		"example.com,Web\n"
+	if stdout != expected {
+		t.Errorf("Expected links:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	t.Log("checking JSON Lines from standard input")
+
+	code, stdout, _ = run(t, "=> a.gmi A\n=> gopher://example.org/ B\n",
+		"links", "list", "-format", "jsonl", "-scheme", "gopher")
+	expectCode(t, code, 0)
+
+	var link struct {
+		File     string
+		Line     int
+		Scheme   string
+		Internal bool
+	}
+
+	if err := json.Unmarshal([]byte(stdout), &link); err != nil {
+		t.Fatalf("could not decode JSON output: %v\n%s", err, stdout)
+	}
+
+	if link.File != "<standard input>" || link.Line != 2 ||
+		link.Scheme != "gopher" || link.Internal {
+		t.Errorf("Expected gopher link from standard input, got: %+v", link)
+	}
+
+	t.Log("checking a gemini URL")
+
+	url := serveGemini(t, map[string]string{
+		"blog/index.gmi": "=> post.gmi Post\n=> /about.gmi About\n",
+	})
+	host := strings.TrimSuffix(strings.TrimPrefix(url, "gemini://"), "/")
+	hosts := filepath.Join(dir, "known_hosts")
+
+	code, stdout, _ = run(t, "", "links", "list", "-known-hosts", hosts,
+		"-internal", url+"blog/")
+	expectCode(t, code, 0)
+
+	expected = "file\tline\turl\tresolved\tscheme\thost\ttext\n" +
+		url + "blog/\t1\tpost.gmi\t" + url + "blog/post.gmi\tgemini\t" +
+		host + "\tPost\n" +
+		url + "blog/\t2\t/about.gmi\t" + url + "about.gmi\tgemini\t" +
+		host + "\tAbout\n"
+	if stdout != expected {
+		t.Errorf("Expected links:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	t.Log("checking with errors")
+
+	long := testutil.TempDir(t, map[string]string{
+		"a.gmi": strings.Repeat("a", 70000),
+	})
+
+	for _, args := range [][]string{
+		{"-format", "xml"},
+		{"-internal", "-external"},
+		{"-host", "["},
+		{"-base", "%zz"},
+		{filepath.Join(dir, "no.gmi")},
+		{long},
+		{"-known-hosts", hosts, url + "no.gmi"},
+		{"-known-hosts", dir, url},
+	} {
+		code, _, stderr := run(t, "", append([]string{"links", "list"},
+			args...)...)
+		expectCode(t, code, 1)
+
+		if stderr == "" {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+
+	code, _, _ = run(t, "", "links", "list", "-x")
+	expectCode(t, code, 2)
+}
+
+func TestLinksGraph(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi":      "# Home\n=> about.gmi About\n",
+		"about.gmi":      "# About\n=> / Home\n=> blog/ Blog\n",
+		"blog/index.gmi": "# Blog\n",
+		"draft.gmi":      "=> index.gmi Home\n",
+	})
+
+	code, stdout, _ := run(t, "", "links", "graph", dir)
+	expectCode(t, code, 0)
+
+	expected := "orphan /draft.gmi\ndead-end /blog/index.gmi\n"
+	if stdout != expected {
+		t.Errorf("Expected report:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "links", "graph", "-backlinks", "/index.gmi",
+		"-heading", "Linking here", dir)
+	expectCode(t, code, 0)
+
+	expected = "\n## Linking here\n" +
+		"=> /about.gmi About\n" +
+		"=> /draft.gmi /draft.gmi\n"
+	if stdout != expected {
+		t.Errorf("Expected backlinks:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "", "links", "graph", "-dot", dir)
+	expectCode(t, code, 0)
+
+	if !strings.HasPrefix(stdout, "digraph capsule {\n") ||
+		!strings.Contains(stdout, `"/about.gmi" -> "/blog/index.gmi";`) {
+		t.Errorf("Expected DOT graph, got:\n%s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	code, _, _ = run(t, "", "links", "graph", filepath.Join(dir, "no"))
+	expectCode(t, code, 1)
+
+	code, _, _ = run(t, "", "links", "graph", "-dot", "-backlinks", "/", dir)
+	expectCode(t, code, 1)
+
+	code, _, _ = run(t, "", "links", "graph")
+	expectCode(t, code, 2)
+
+	code, _, _ = run(t, "", "links", "graph", "-x")
+	expectCode(t, code, 2)
+}
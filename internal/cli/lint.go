@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"git.sr.ht/~kiba/gmitxt/lint"
+)
+
+var errStdinFix = errors.New("cannot use -fix with standard input")
+
+// maxFixPasses is the most times the fixes are applied to a file.  Fixes that
+// overlap are applied in later passes.
+const maxFixPasses = 10
+
+const lintDesc = `Lint checks Gemini text for problems and reports each problem as:
+
+	file:line:col: rule: message
+
+Without paths, it checks standard input.  Paths to directories check the .gmi
+files in them.  It exits with status 1 when problems are found.
+
+With -fix, the problems that can be fixed are fixed in the files, and only the
+problems that remain are reported.
+
+Rules can be enabled or disabled in a JSON config file, such as:
+
+	{"rules": {"link-no-text": false}, "maxLineLength": 100}`
+
+// runLint runs the lint command.
+func runLint(e *env, args []string) error {
+	var (
+		asJSON bool
+		config string
+		rules  bool
+		fix    bool
+	)
+
+	fs := flags(e, "lint", "[flags] [path ...]", lintDesc)
+	fs.BoolVar(&asJSON, "json", false, "report problems as a JSON array")
+	fs.StringVar(&config, "config", "", "read the config from a JSON `file`")
+	fs.BoolVar(&rules, "rules", false, "list the rules and exit")
+	fs.BoolVar(&fix, "fix", false, "fix the problems that can be fixed")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if rules {
+		for _, info := range lint.Rules() {
+			fmt.Fprintf(e.stdout, "%-20s %s\n", info.Name, info.Doc)
+		}
+
+		return nil
+	}
+
+	cfg, err := readLintConfig(config)
+	if err != nil {
+		return err
+	}
+
+	l, err := lint.New(cfg)
+	if err != nil {
+		return fmt.Errorf("problem with config: %w", err)
+	}
+
+	diags, err := lintFiles(e, l, fs.Args(), fix)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if diags == nil {
+			diags = []lint.Diagnostic{}
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "\t")
+
+		if err := enc.Encode(diags); err != nil {
+			return fmt.Errorf("problem writing problems: %w", err)
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Fprintln(e.stdout, d)
+		}
+	}
+
+	if len(diags) != 0 {
+		return errFailed
+	}
+
+	return nil
+}
+
+// readLintConfig reads the lint config from the named file.  The default
+// config is returned if no file is named.
+func readLintConfig(name string) (lint.Config, error) {
+	if name == "" {
+		return lint.Config{}, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return lint.Config{}, fmt.Errorf("problem reading config: %w", err)
+	}
+	defer f.Close()
+
+	cfg, err := lint.ReadConfig(f)
+	if err != nil {
+		return cfg, fmt.Errorf("problem with %s: %w", name, err)
+	}
+
+	return cfg, nil
+}
+
+// lintFiles checks the files at the paths, or standard input if there are no
+// paths, and returns the problems found.  If fix is set, the problems that can
+// be fixed are fixed in the files first.
+func lintFiles(
+	e *env,
+	l *lint.Linter,
+	paths []string,
+	fix bool,
+) ([]lint.Diagnostic, error) {
+	if len(paths) == 0 {
+		if fix {
+			return nil, errStdinFix
+		}
+
+		return l.Lint(stdinName, e.stdin) // nolint: wrapcheck // has context
+	}
+
+	files, err := gmiFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []lint.Diagnostic
+
+	for _, name := range files {
+		diags, err := lintFile(l, name, fix)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, diags...)
+	}
+
+	return all, nil
+}
+
+// lintFile checks the named file and returns the problems found.  If fix is
+// set, the problems that can be fixed are fixed and the file is written before
+// the problems that remain are returned.
+func lintFile(
+	l *lint.Linter,
+	name string,
+	fix bool,
+) ([]lint.Diagnostic, error) {
+	src, err := ioutil.ReadFile(name) // nolint: gosec // file to check
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	diags, err := l.Lint(name, bytes.NewReader(src))
+	if err != nil || !fix {
+		return diags, err // nolint: wrapcheck // has context
+	}
+
+	text := src
+
+	for i := 0; i < maxFixPasses; i++ {
+		var fixed int
+
+		text, fixed = lint.Apply(text, diags)
+		if fixed == 0 {
+			break
+		}
+
+		diags, err = l.Lint(name, bytes.NewReader(text))
+		if err != nil {
+			return nil, err // nolint: wrapcheck // has context
+		}
+	}
+
+	if !bytes.Equal(text, src) {
+		if err := writeFile(name, text); err != nil {
+			return nil, err
+		}
+	}
+
+	return diags, nil
+}
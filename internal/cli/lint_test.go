@@ -0,0 +1,157 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+const unlinted = "# Title\n#Title \n=> foo.gmi\n"
+
+func TestLint(t *testing.T) {
+	t.Log("checking standard input")
+
+	code, stdout, _ := run(t, unlinted, "lint")
+	expectCode(t, code, 1)
+
+	expected := `<standard input>:2:1: multiple-head1: more than one level 1 heading, the first is on line 1
+<standard input>:2:7: trailing-whitespace: trailing whitespace
+<standard input>:3:1: link-no-text: link has no descriptive text
+`
+	if stdout != expected {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	code, stdout, _ = run(t, "# Title\n", "lint")
+	expectCode(t, code, 0)
+
+	if stdout != "" {
+		t.Errorf("Expected no problems, got:\n%s", stdout)
+	}
+
+	t.Log("checking files")
+
+	dir := testutil.TempDir(t, map[string]string{
+		"a.gmi":        unlinted,
+		"sub/b.gmi":    "=> bar.gmi\n",
+		"config.json":  `{"rules": {"multiple-head1": false}}`,
+		"invalid.json": `{"rules": {"nope": false}}`,
+	})
+
+	code, stdout, _ = run(t, "", "lint", "-json",
+		"-config", filepath.Join(dir, "config.json"), dir)
+	expectCode(t, code, 1)
+
+	var diags []struct {
+		File string
+		Line int
+		Col  int
+		Rule string
+	}
+
+	if err := json.Unmarshal([]byte(stdout), &diags); err != nil {
+		t.Fatalf("could not decode JSON output: %v\n%s", err, stdout)
+	}
+
+	if len(diags) != 3 {
+		t.Fatalf("Expected 3 problems, got: %+v", diags)
+	}
+
+	if diags[2].File != filepath.Join(dir, "sub", "b.gmi") ||
+		diags[2].Line != 1 || diags[2].Col != 1 ||
+		diags[2].Rule != "link-no-text" {
+		t.Errorf("Expected link-no-text in sub/b.gmi, got: %+v", diags[2])
+	}
+
+	code, _, _ = run(t, "", "lint", filepath.Join(dir, "a.gmi"))
+	expectCode(t, code, 1)
+
+	code, stdout, _ = run(t, "# Title", "lint", "-json")
+	expectCode(t, code, 0)
+
+	if strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("Expected an empty JSON array, got: %s", stdout)
+	}
+
+	t.Log("listing rules")
+
+	code, stdout, _ = run(t, "", "lint", "-rules")
+	expectCode(t, code, 0)
+
+	if !strings.Contains(stdout, "trailing-whitespace") {
+		t.Errorf("Expected list of rules, got:\n%s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	code, _, stderr := run(t, "", "lint", "-config",
+		filepath.Join(dir, "invalid.json"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "unknown rule: nope") {
+		t.Errorf("Expected unknown rule error, got: %q", stderr)
+	}
+
+	code, _, _ = run(t, "", "lint", "-config", filepath.Join(dir, "a.gmi"))
+	expectCode(t, code, 1)
+
+	code, _, _ = run(t, "", "lint", "-config", filepath.Join(dir, "no.json"))
+	expectCode(t, code, 1)
+
+	code, _, _ = run(t, "", "lint", filepath.Join(dir, "no.gmi"))
+	expectCode(t, code, 1)
+
+	code, _, _ = run(t, "", "lint", "-x")
+	expectCode(t, code, 2)
+}
+
+func TestLintFix(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"a.gmi": unlinted + "*item\n```\ncode",
+		"b.gmi": "# Title\n",
+	})
+
+	code, stdout, _ := run(t, "", "lint", "-fix", dir)
+	expectCode(t, code, 1)
+
+	expected := filepath.Join(dir, "a.gmi") +
+		":3:1: link-no-text: link has no descriptive text\n" +
+		filepath.Join(dir, "a.gmi") +
+		":5:1: pre-no-alt: preformatted text has no alt text\n"
+	if stdout != expected {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", expected, stdout)
+	}
+
+	fixed := "# Title\n##Title\n=> foo.gmi\n* item\n```\ncode\n```\n"
+	if text := readFile(t, dir, "a.gmi"); text != fixed {
+		t.Errorf("Expected fixed file %q, got: %q", fixed, text)
+	}
+
+	code, _, _ = run(t, "", "lint", "-fix", filepath.Join(dir, "b.gmi"))
+	expectCode(t, code, 0)
+
+	t.Log("checking standard input")
+
+	code, _, stderr := run(t, unlinted, "lint", "-fix")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "cannot use -fix with standard input") {
+		t.Errorf("Expected standard input error, got: %q", stderr)
+	}
+}
+
+func TestLintFormatted(t *testing.T) {
+	code, stdout, _ := run(t, "# Title\n=>  \n*  \n* \n", "fmt")
+	expectCode(t, code, 0)
+
+	code, stdout, _ = run(t, stdout, "lint")
+	expectCode(t, code, 1)
+
+	if strings.Contains(stdout, "trailing-whitespace") {
+		t.Errorf("Expected formatted text without trailing whitespace, "+
+			"got:\n%s", stdout)
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/gemini"
+)
+
+// isURL returns whether the argument of a command is a gemini URL to request
+// instead of a path.
+func isURL(arg string) bool {
+	return strings.HasPrefix(arg, "gemini://")
+}
+
+// knownHostsFlag adds the -known-hosts flag to the flags of a command that
+// requests gemini URLs, which sets the name of the known hosts file.
+func knownHostsFlag(fs *flag.FlagSet, name *string) {
+	dir, err := os.UserConfigDir()
+
+	file := ""
+	if err == nil {
+		file = filepath.Join(dir, "gmitxt", "known_hosts")
+	}
+
+	fs.StringVar(name, "known-hosts", file,
+		"trust the certificates of servers of gemini URLs in the `file`")
+}
+
+// fetch requests the gemini URL, trusting the certificates of servers in the
+// known hosts file, and returns a Scanner of the Gemini text of the response
+// with the URL it is from after redirects.  The body must be closed.
+func fetch(rawurl, knownHosts string) (*gmitxt.Scanner, *gemini.Response,
+	error) {
+	hosts, err := gemini.LoadKnownHosts(knownHosts)
+	if err != nil {
+		return nil, nil, err // nolint: wrapcheck // has context
+	}
+
+	c := &gemini.Client{KnownHosts: hosts}
+
+	res, err := c.Get(rawurl)
+	if err != nil {
+		return nil, nil, err // nolint: wrapcheck // has context
+	}
+
+	s, err := res.Scanner()
+	if err != nil {
+		res.Body.Close()
+
+		return nil, nil, fmt.Errorf("problem reading %s: %w", rawurl, err)
+	}
+
+	return s, res, nil
+}
+
+// fetchText requests the Gemini text at the gemini URL and writes it to w.
+func fetchText(w io.Writer, rawurl, knownHosts string) error {
+	s, res, err := fetch(rawurl, knownHosts)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	tw := gmitxt.NewWriter(w)
+
+	for s.Scan() {
+		tw.Write(s.Line()) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading %s: %w", rawurl, err)
+	}
+
+	tw.Flush()
+
+	if err := tw.Error(); err != nil {
+		return fmt.Errorf("problem writing text: %w", err)
+	}
+
+	return nil
+}
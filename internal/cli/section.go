@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+var errNoSection = errors.New("no section matches")
+
+const sectionDesc = `Section writes the section of a heading of a Gemini text file, or of standard
+input without a file, to standard output.  The section is the heading and the
+lines until the next heading of the same or a higher level.
+
+The heading is matched by its text, ignoring case and surrounding whitespace,
+or by its slug, such as "installing-the-command-line-tool".  The first matching
+heading is used.  It exits with status 1 when no heading matches.`
+
+// runSection runs the section command.
+func runSection(e *env, args []string) error {
+	var heading string
+
+	fs := flags(e, "section", "-h heading [file]", sectionDesc)
+	fs.StringVar(&heading, "h", "", "the `heading` of the section")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if heading == "" || fs.NArg() > 1 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	name, src := stdinName, e.stdin
+
+	if fs.NArg() == 1 {
+		name = fs.Arg(0)
+
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("problem reading %s: %w", name, err)
+		}
+		defer f.Close()
+
+		src = f
+	}
+
+	root, err := gmitxt.Sections(src)
+	if err != nil {
+		return fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	sec := root.Find(func(sec *gmitxt.Section) bool {
+		return sec.Level != 0 && matchHeading(sec.Title(), heading)
+	})
+	if sec == nil {
+		return fmt.Errorf("%w %q in %s", errNoSection, heading, name)
+	}
+
+	if err := writeLines(e.stdout, sec.AllLines()); err != nil {
+		return fmt.Errorf("problem writing section: %w", err)
+	}
+
+	return nil
+}
+
+// matchHeading reports whether the text of a heading matches the heading given
+// to the section command, by its text or by its slug.
+func matchHeading(text, heading string) bool {
+	heading = strings.TrimSpace(heading)
+
+	return strings.EqualFold(strings.TrimSpace(text), heading) ||
+		links.Slug(text) == heading
+}
+
+// writeLines writes the lines to w as Gemini text.
+func writeLines(w io.Writer, lines []gmitxt.Line) error {
+	gw := gmitxt.NewWriter(w)
+
+	for _, line := range lines {
+		gw.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	gw.Flush()
+
+	return gw.Error() // nolint: wrapcheck // wrapped by caller
+}
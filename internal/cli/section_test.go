@@ -0,0 +1,74 @@
+package cli_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestSection(t *testing.T) {
+	text := "# gmitxt\n" +
+		"Intro\n" +
+		"## Installing the Command-Line Tool\n" +
+		"Run go install.\n" +
+		"### From Source\n" +
+		"Clone it.\n" +
+		"## Library Usage\n" +
+		"Import it.\n"
+	dir := testutil.TempDir(t, map[string]string{"README.gmi": text})
+	name := filepath.Join(dir, "README.gmi")
+
+	expected := "## Installing the Command-Line Tool\n" +
+		"Run go install.\n" +
+		"### From Source\n" +
+		"Clone it.\n"
+
+	for _, heading := range []string{
+		"Installing the Command-Line Tool",
+		" installing the command-line tool ",
+		"installing-the-command-line-tool",
+	} {
+		code, stdout, _ := run(t, "", "section", "-h", heading, name)
+		expectCode(t, code, 0)
+
+		if stdout != expected {
+			t.Errorf("Expected section for %q:\n%s\ngot:\n%s", heading,
+				expected, stdout)
+		}
+	}
+
+	code, stdout, _ := run(t, text, "section", "-h", "library-usage")
+	expectCode(t, code, 0)
+
+	if stdout != "## Library Usage\nImport it.\n" {
+		t.Errorf("Expected section from standard input, got:\n%s", stdout)
+	}
+
+	t.Log("checking with errors")
+
+	code, _, stderr := run(t, "", "section", "-h", "Nope", name)
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, `no section matches "Nope"`) {
+		t.Errorf("Expected no section error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "section", "-h", "x",
+		filepath.Join(dir, "no.gmi"))
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem reading") {
+		t.Errorf("Expected reading error, got: %q", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"section"},
+		{"section", "-x"},
+		{"section", "-h", "x", "a.gmi", "b.gmi"},
+	} {
+		code, _, _ = run(t, "", args...)
+		expectCode(t, code, 2)
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/internal/preview"
+)
+
+// errNoCert is returned by serve -gemini when the certificate or key file is
+// set to an empty name.
+var errNoCert = errors.New("no certificate file")
+
+// pollInterval is how often the capsule is polled for changed files.
+const pollInterval = 500 * time.Millisecond
+
+// certValidFor is how long a certificate created for the Gemini server is
+// valid.
+const certValidFor = 5 * 365 * 24 * time.Hour
+
+const serveDesc = `Serve serves a capsule directory over HTTP to preview it while writing.
+
+Gemini text files are rendered as HTML pages, which reload when files change,
+or are served as text/gemini with the raw query parameter, such as
+/index.gmi?raw.  A directory is served by its index.gmi file, or by a listing
+of its files generated as Gemini text.  The path /.events sends server-sent
+events when files change.
+
+With -gemini, the capsule is served over the Gemini protocol instead, on
+port 1965 by default.  The TLS certificate and key are loaded from the -cert
+and -key files, which are created with a self-signed certificate for the
+host of the address if neither exists.  They are in the gmitxt directory of
+the user config directory by default, and must be set when there is no such
+directory, such as when $HOME is not set.
+
+The server listens on localhost by default, and runs until it is stopped.`
+
+// serveCmd holds the flags of the serve command.
+type serveCmd struct {
+	addr   string
+	gemini bool
+	cert   string
+	key    string
+	lang   string
+
+	configErr error // error finding the user config directory
+}
+
+// runServe runs the serve command.
+func runServe(e *env, args []string) error {
+	var c serveCmd
+
+	var cert, key string
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		c.configErr = err
+	} else {
+		cert = filepath.Join(dir, "gmitxt", "cert.pem")
+		key = filepath.Join(dir, "gmitxt", "key.pem")
+	}
+
+	fs := flags(e, "serve", "[flags] dir", serveDesc)
+	fs.StringVar(&c.addr, "addr", "",
+		"listen on the `address` (default localhost:8080, or "+
+			"localhost:1965 with -gemini)")
+	fs.BoolVar(&c.gemini, "gemini", false,
+		"serve over the Gemini protocol instead of HTTP")
+	fs.StringVar(&c.cert, "cert", cert,
+		"load the TLS certificate from the `file` with -gemini")
+	fs.StringVar(&c.key, "key", key,
+		"load the TLS key from the `file` with -gemini")
+	fs.StringVar(&c.lang, "lang", "",
+		"send the `language` of Gemini text files with -gemini")
+
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+
+		return errUsage
+	}
+
+	if c.gemini {
+		return c.serveGemini(e, fs.Arg(0))
+	}
+
+	if c.addr == "" {
+		c.addr = "localhost:8080"
+	}
+
+	l, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("problem listening: %w", err)
+	}
+
+	fmt.Fprintf(e.stderr, "serving %s at http://%s/\n", fs.Arg(0), l.Addr())
+
+	srv := &http.Server{
+		Handler:           preview.NewHandler(fs.Arg(0), pollInterval),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return srv.Serve(l) // nolint: wrapcheck // server stopped
+}
+
+// serveGemini serves the capsule directory over the Gemini protocol.
+func (c *serveCmd) serveGemini(e *env, dir string) error {
+	if c.addr == "" {
+		c.addr = "localhost:1965"
+	}
+
+	if c.cert == "" || c.key == "" {
+		err := c.configErr
+		if err == nil {
+			err = errNoCert
+		}
+
+		return fmt.Errorf("problem finding certificate, set -cert and -key: %w",
+			err)
+	}
+
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+
+	cert, err := gemini.LoadCertificate(c.cert, c.key, []string{host},
+		certValidFor)
+	if err != nil {
+		return err // nolint: wrapcheck // has context
+	}
+
+	l, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("problem listening: %w", err)
+	}
+
+	fmt.Fprintf(e.stderr, "serving %s at gemini://%s/\n", dir, l.Addr())
+
+	srv := &gemini.Server{
+		Handler: &gemini.FileServer{Dir: dir, Lang: c.lang},
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+
+	return srv.Serve(l) // nolint: wrapcheck // server stopped
+}
@@ -0,0 +1,98 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestServe(t *testing.T) {
+	code, _, stderr := run(t, "", "serve", "-addr", "localhost:-1", ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem listening") {
+		t.Errorf("Expected listening error, got: %q", stderr)
+	}
+
+	code, _, _ = run(t, "", "serve")
+	expectCode(t, code, 2)
+
+	code, _, _ = run(t, "", "serve", "-x", ".")
+	expectCode(t, code, 2)
+}
+
+func TestServeGemini(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{"file": ""})
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+
+	code, _, stderr := run(t, "", "serve", "-gemini", "-addr",
+		"localhost:-1", "-cert", cert, "-key", key, ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem listening") {
+		t.Errorf("Expected listening error, got: %q", stderr)
+	}
+
+	if _, err := os.Stat(cert); err != nil {
+		t.Errorf("Expected a certificate to be created, got: %v", err)
+	}
+
+	code, _, stderr = run(t, "", "serve", "-gemini",
+		"-cert", filepath.Join(dir, "file", "cert.pem"),
+		"-key", filepath.Join(dir, "file", "key.pem"), ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem loading certificate") {
+		t.Errorf("Expected certificate error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "serve", "-gemini", "-cert", "", ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem finding certificate") {
+		t.Errorf("Expected certificate error, got: %q", stderr)
+	}
+
+	t.Log("checking the certificate without a user config directory")
+
+	setenv(t, "HOME", "")
+	setenv(t, "XDG_CONFIG_HOME", "")
+	setenv(t, "AppData", "")
+
+	code, _, stderr = run(t, "", "serve", "-gemini", ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem finding certificate") {
+		t.Errorf("Expected certificate error, got: %q", stderr)
+	}
+
+	code, _, stderr = run(t, "", "serve", "-gemini", "-cert", cert, ".")
+	expectCode(t, code, 1)
+
+	if !strings.Contains(stderr, "problem finding certificate") {
+		t.Errorf("Expected certificate error, got: %q", stderr)
+	}
+}
+
+// setenv sets the environment variable for the test.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(key)
+
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("could not set %s: %v", key, err)
+	}
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
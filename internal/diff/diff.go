@@ -0,0 +1,127 @@
+// Package diff finds the differences between two sequences using the Myers
+// difference algorithm, and writes differences between lines of text in the
+// unified diff format.
+package diff
+
+// Op is the operation of an Edit.
+type Op uint8
+
+const (
+	// Equal keeps an element that is in both sequences.
+	Equal Op = iota
+	// Delete removes an element from the first sequence.
+	Delete
+	// Insert adds an element from the second sequence.
+	Insert
+)
+
+// Edit is an operation of an edit script that turns a sequence A into a
+// sequence B.
+type Edit struct {
+	// Op is the operation of the edit.
+	Op Op
+	// A is the index of the element in A.  For an Insert, it is the index of
+	// the element in A the element of B is inserted before.
+	A int
+	// B is the index of the element in B.  For a Delete, it is the index of
+	// the element in B the element of A is deleted before.
+	B int
+}
+
+// Diff returns the shortest edit script that turns a sequence A of n elements
+// into a sequence B of m elements.  The eq function reports whether the
+// element at index i of A is equal to the element at index j of B.  The edits
+// are in order and cover every element of both sequences.
+func Diff(n, m int, eq func(i, j int) bool) []Edit {
+	trace := shortest(n, m, eq)
+	edits := make([]Edit, 0, n+m)
+
+	// Walk back from the end through the trace to find the edits.
+	x, y := n, m
+
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && prev(trace, d, k-1) < prev(trace, d, k+1)) {
+			prevK = k + 1
+		}
+
+		prevX := prev(trace, d, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{Op: Equal, A: x, B: y})
+		}
+
+		if x == prevX {
+			y--
+			edits = append(edits, Edit{Op: Insert, A: x, B: y})
+		} else {
+			x--
+			edits = append(edits, Edit{Op: Delete, A: x, B: y})
+		}
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, Edit{Op: Equal, A: x, B: y})
+	}
+
+	// Reverse the edits, as they were found from the end.
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
+
+// shortest returns the furthest reaching x for each diagonal k after each
+// number of edits d, until the end of both sequences is reached.  The x for
+// diagonal k after d edits is at trace[d][d+k].
+func shortest(n, m int, eq func(i, j int) bool) [][]int {
+	var trace [][]int
+
+	for d := 0; d <= n+m; d++ {
+		v := make([]int, 2*d+1)
+		off := d
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d ||
+				(k != d && prev(trace, d, k-1) < prev(trace, d, k+1)):
+				x = prev(trace, d, k+1) // down: insert from B
+			default:
+				x = prev(trace, d, k-1) + 1 // right: delete from A
+			}
+
+			y := x - k
+			for x < n && y < m && eq(x, y) {
+				x++
+				y++
+			}
+
+			v[off+k] = x
+
+			if x >= n && y >= m {
+				return append(trace, v)
+			}
+		}
+
+		trace = append(trace, v)
+	}
+
+	return trace
+}
+
+// prev returns the furthest reaching x for diagonal k after d-1 edits.
+func prev(trace [][]int, d, k int) int {
+	return trace[d-1][d-1+k]
+}
@@ -0,0 +1,150 @@
+package diff_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/diff"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int // expected number of inserts and deletes
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abcabba", "cbabac", 5},
+		{"abcdef", "abxdefg", 3},
+		{"xabc", "abc", 1},
+		{"abc", "abcx", 1},
+	}
+
+	for _, test := range tests {
+		a, b := test.a, test.b
+		edits := diff.Diff(len(a), len(b), func(i, j int) bool {
+			return a[i] == b[j]
+		})
+
+		var (
+			gotA, gotB strings.Builder
+			changes    int
+		)
+
+		for _, e := range edits {
+			switch e.Op {
+			case diff.Equal:
+				if a[e.A] != b[e.B] {
+					t.Errorf("%q to %q: %q is not equal to %q",
+						a, b, a[e.A], b[e.B])
+				}
+
+				gotA.WriteByte(a[e.A])
+				gotB.WriteByte(b[e.B])
+			case diff.Delete:
+				gotA.WriteByte(a[e.A])
+				changes++
+			case diff.Insert:
+				gotB.WriteByte(b[e.B])
+				changes++
+			}
+		}
+
+		if gotA.String() != a || gotB.String() != b {
+			t.Errorf("%q to %q: edits do not cover both, got %q and %q",
+				a, b, gotA.String(), gotB.String())
+		}
+
+		if changes != test.edits {
+			t.Errorf("%q to %q: expected %d changes, got: %d",
+				a, b, test.edits, changes)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16", " ")
+	b := strings.Split("1 2 3 x 5 6 7 8 9 10 11 12 14 15 16 17", " ")
+
+	expected := `--- a.gmi
++++ b.gmi
+@@ -1,7 +1,7 @@
+ 1
+ 2
+ 3
+-4
++x
+ 5
+ 6
+ 7
+@@ -10,7 +10,7 @@
+ 10
+ 11
+ 12
+-13
+ 14
+ 15
+ 16
++17
+`
+
+	var buf bytes.Buffer
+	if err := diff.Unified(&buf, "a.gmi", "b.gmi", a, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	t.Log("writing a diff of an empty file")
+
+	expected = `--- a.gmi
++++ b.gmi
+@@ -0,0 +1,2 @@
++1
++2
+`
+
+	buf.Reset()
+
+	if err := diff.Unified(&buf, "a.gmi", "b.gmi", nil, a[:2]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	t.Log("writing a diff without differences")
+
+	buf.Reset()
+
+	if err := diff.Unified(&buf, "a.gmi", "b.gmi", a, a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no diff, got:\n%s", buf.String())
+	}
+
+	t.Log("writing a diff with an error")
+
+	err := diff.Unified(errWriter{}, "a.gmi", "b.gmi", a, b)
+	if !errors.Is(err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+}
+
+var errWrite = errors.New("write error")
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
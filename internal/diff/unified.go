@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// context is the number of unchanged lines written around each change.
+const context = 3
+
+// Unified writes the differences between the lines of a and b in the unified
+// diff format, with three unchanged lines of context around each change.  The
+// from and to names are written in the header of the diff.  Nothing is written
+// if there are no differences.
+func Unified(w io.Writer, from, to string, a, b []string) error {
+	edits := Diff(len(a), len(b), func(i, j int) bool { return a[i] == b[j] })
+	bw := bufio.NewWriter(w)
+	header := false
+
+	for start := 0; start < len(edits); {
+		first, last := hunk(edits, start)
+		if first == -1 {
+			break
+		}
+
+		if !header {
+			fmt.Fprintf(bw, "--- %s\n+++ %s\n", from, to)
+			header = true
+		}
+
+		writeHunk(bw, edits[first:last], a, b)
+		start = last
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("problem writing diff: %w", err)
+	}
+
+	return nil
+}
+
+// hunk returns the range of edits for the next hunk of changes after start,
+// including the lines of context around the changes.  Changes that are close
+// enough for their context to overlap are in the same hunk.  It returns -1 for
+// first when there are no more changes.
+func hunk(edits []Edit, start int) (first, last int) {
+	first = -1
+
+	for i := start; i < len(edits); i++ {
+		if edits[i].Op == Equal {
+			if first != -1 && i-last >= 2*context {
+				break
+			}
+
+			continue
+		}
+
+		if first == -1 {
+			first = i
+		}
+
+		last = i + 1
+	}
+
+	if first == -1 {
+		return -1, -1
+	}
+
+	first -= context
+	if first < start {
+		first = start
+	}
+
+	last += context
+	if last > len(edits) {
+		last = len(edits)
+	}
+
+	return first, last
+}
+
+// writeHunk writes a hunk header followed by the edited lines.
+func writeHunk(w *bufio.Writer, edits []Edit, a, b []string) {
+	var countA, countB int
+
+	for _, e := range edits {
+		if e.Op != Insert {
+			countA++
+		}
+
+		if e.Op != Delete {
+			countB++
+		}
+	}
+
+	fmt.Fprintf(w, "@@ -%s +%s @@\n",
+		span(edits[0].A, countA), span(edits[0].B, countB))
+
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			fmt.Fprintf(w, " %s\n", a[e.A])
+		case Delete:
+			fmt.Fprintf(w, "-%s\n", a[e.A])
+		case Insert:
+			fmt.Fprintf(w, "+%s\n", b[e.B])
+		}
+	}
+}
+
+// span returns the range of lines of a hunk header.  The start is the index of
+// the first line, which is written as a line number.  An empty range is
+// written with the number of the line before it.
+func span(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,250 @@
+// Package preview serves a capsule directory over HTTP, so authors can preview
+// their Gemini text as they write it.
+//
+// Gemini text files are rendered as HTML pages with a script that reloads them
+// when files change, or are served as text/gemini with the raw query
+// parameter, such as /index.gmi?raw.  A directory is served by its index.gmi
+// file, or by a listing of its files generated as Gemini text.  Clients can
+// listen to the EventsPath for server-sent events sent when files change.
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/html"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+	"git.sr.ht/~kiba/gmitxt/internal/watch"
+)
+
+// EventsPath is the path of the server-sent events sent when files change.
+const EventsPath = "/.events"
+
+// gmiType is the content type of Gemini text.
+const gmiType = "text/gemini; charset=utf-8"
+
+// htmlType is the content type of the HTML pages of Gemini text.
+const htmlType = "text/html; charset=utf-8"
+
+// reloadScript is the script of the HTML pages, which reloads the page when a
+// file changes, such as a file it includes or its stylesheet.
+const reloadScript = `<script>
+new EventSource("` + EventsPath + `").addEventListener("change", function () {
+  location.reload();
+});
+</script>`
+
+// Handler serves the files in a capsule directory.
+type Handler struct {
+	dir      string
+	interval time.Duration
+}
+
+// NewHandler returns a Handler of the directory that polls it for changed
+// files at the interval for each client listening to the EventsPath.
+func NewHandler(dir string, interval time.Duration) *Handler {
+	return &Handler{dir: dir, interval: interval}
+}
+
+// ServeHTTP serves the file or directory at the path of the request.  With the
+// raw query parameter, Gemini text is served as it is instead of as HTML.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	p := path.Clean("/" + r.URL.Path)
+	if p == EventsPath {
+		h.serveEvents(w, r)
+
+		return
+	}
+
+	name := filepath.Join(h.dir, filepath.FromSlash(p))
+
+	info, err := os.Stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if !info.IsDir() {
+		h.serveFile(w, r, name, info)
+
+		return
+	}
+
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		u := *r.URL
+		u.Path += "/"
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+
+		return
+	}
+
+	if info, err := os.Stat(filepath.Join(name, capsule.Index)); err == nil {
+		h.serveFile(w, r, filepath.Join(name, capsule.Index), info)
+
+		return
+	}
+
+	h.serveDir(w, r, name, p)
+}
+
+// serveFile serves the named file.  Gemini text files are served as HTML, and
+// other files with the type of their extension.
+func (h *Handler) serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	info os.FileInfo,
+) {
+	data, err := ioutil.ReadFile(name) // nolint: gosec // file to serve
+	if err != nil {
+		http.Error(w, "file cannot be read", http.StatusInternalServerError)
+
+		return
+	}
+
+	if filepath.Ext(name) == capsule.Ext {
+		serveText(w, r, name, info.ModTime(), data)
+
+		return
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(data))
+}
+
+// serveText serves the Gemini text of the named file as an HTML page with the
+// reload script, or as text/gemini with the raw query parameter.
+func serveText(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	modtime time.Time,
+	data []byte,
+) {
+	if _, raw := r.URL.Query()["raw"]; raw {
+		w.Header().Set("Content-Type", gmiType)
+		http.ServeContent(w, r, name, modtime, bytes.NewReader(data))
+
+		return
+	}
+
+	meta := gmitxt.ExtractMeta(namedReader{bytes.NewReader(data), name})
+
+	var b bytes.Buffer
+
+	if err := html.Render(&b, bytes.NewReader(data), html.Options{
+		Document: true,
+		Title:    meta.Title,
+		Lang:     meta.Lang,
+		Head:     reloadScript,
+	}); err != nil {
+		http.Error(w, "file cannot be rendered",
+			http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", htmlType)
+	http.ServeContent(w, r, name, modtime, bytes.NewReader(b.Bytes()))
+}
+
+// namedReader is a reader of the content of a named file, whose language is
+// taken from its name by gmitxt.ExtractMeta.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+// Name returns the name of the file.
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// serveDir serves a listing of the files in the named directory, with the path
+// p, generated as Gemini text and served as the Gemini text files are.  Hidden
+// files, which start with a dot, are not listed.
+func (h *Handler) serveDir(
+	w http.ResponseWriter,
+	r *http.Request,
+	name, p string,
+) {
+	infos, err := ioutil.ReadDir(name)
+	if err != nil {
+		http.Error(w, "directory cannot be read",
+			http.StatusInternalServerError)
+
+		return
+	}
+
+	var b bytes.Buffer
+
+	if err := gemini.Listing(&b, p, infos); err != nil {
+		http.Error(w, "directory cannot be listed",
+			http.StatusInternalServerError)
+
+		return
+	}
+
+	serveText(w, r, capsule.Index, time.Time{}, b.Bytes())
+}
+
+// serveEvents sends a server-sent event with the name of each file in the
+// capsule that changes, until the client goes away.  The name is the path of
+// the file in the capsule:
+//
+//     event: change
+//     data: /blog/post.gmi
+//
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	watcher, err := watch.New(h.dir)
+	if err != nil {
+		http.Error(w, "directory cannot be watched",
+			http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The error is either from the request ending, or from the directory
+	// that can no longer be watched, so the events end.
+	_ = watcher.Watch(r.Context(), h.interval, func(changed []string) {
+		for _, name := range changed {
+			rel, err := filepath.Rel(h.dir, name)
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(w, "event: change\ndata: /%s\n\n",
+				filepath.ToSlash(rel))
+		}
+
+		flusher.Flush()
+	})
+}
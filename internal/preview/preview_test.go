@@ -0,0 +1,224 @@
+package preview_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/internal/preview"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestHandler(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi":       "# Home\n",
+		"image.png":       "png",
+		"blog/a b.gmi":    "# A B\n",
+		"blog/c:d.gmi":    "# C:D\n",
+		"blog/.draft.gmi": "# Draft\n",
+		"blog/old/x.gmi":  "",
+		"bad/index.gmi/x": "",
+	})
+	h := preview.NewHandler(dir, time.Millisecond)
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+		typ    string
+		body   string
+	}{
+		{"GET", "/", 200, "text/html; charset=utf-8", ""},
+		{"GET", "/?raw", 200, "text/gemini; charset=utf-8", "# Home\n"},
+		{"GET", "/index.gmi?raw", 200, "text/gemini; charset=utf-8",
+			"# Home\n"},
+		{"GET", "/image.png", 200, "image/png", "png"},
+		{"GET", "/blog/?raw", 200, "text/gemini; charset=utf-8",
+			"# Index of /blog\n\n=> ../ ../\n=> ./a%20b.gmi a b.gmi\n" +
+				"=> ./c:d.gmi c:d.gmi\n=> ./old/ old/\n"},
+		{"GET", "/blog?raw", 301, "", ""},
+		{"GET", "/nope.gmi", 404, "", ""},
+		{"GET", "/bad/", 500, "", ""},
+		{"GET", "/../index.gmi?raw", 200, "", "# Home\n"},
+		{"POST", "/", 405, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Logf("checking %s %s", test.method, test.target)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+
+		if rec.Code != test.code {
+			t.Errorf("Expected status %d, got: %d", test.code, rec.Code)
+		}
+
+		if typ := rec.Header().Get("Content-Type"); test.typ != "" &&
+			typ != test.typ {
+			t.Errorf("Expected content type %q, got: %q", test.typ, typ)
+		}
+
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("Expected body %q, got: %q", test.body, rec.Body.String())
+		}
+
+		if test.code == 301 &&
+			rec.Header().Get("Location") != "/blog/?raw" {
+			t.Errorf("Expected redirect to /blog/?raw, got: %q",
+				rec.Header().Get("Location"))
+		}
+	}
+
+	t.Log("checking a listing of the root")
+
+	if err := os.Remove(filepath.Join(dir, "index.gmi")); err != nil {
+		t.Fatalf("could not remove index.gmi: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?raw", nil))
+
+	expected := "# Index of /\n\n=> ./bad/ bad/\n=> ./blog/ blog/\n" +
+		"=> ./image.png image.png\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected body %q, got: %q", expected, rec.Body.String())
+	}
+}
+
+func TestHandlerHTML(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{
+		"index.fr.gmi": "# Accueil\n=> blog/ Blog\n",
+		"blog/a.gmi":   "<script>\n",
+	})
+	h := preview.NewHandler(dir, time.Millisecond)
+
+	for target, expected := range map[string][]string{
+		"/index.fr.gmi": {
+			`<html lang="fr">`,
+			"<title>Accueil</title>",
+			`new EventSource("/.events")`,
+			`<h1 id="accueil">Accueil</h1>`,
+			`<p><a href="blog/">Blog</a></p>`,
+		},
+		"/blog/a.gmi": {"<p>&lt;script&gt;</p>"},
+		"/blog/": {
+			"<title>Index of /blog</title>",
+			`<p><a href="./a.gmi">a.gmi</a></p>`,
+		},
+	} {
+		t.Logf("checking %s", target)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+
+		if typ := rec.Header().Get("Content-Type"); typ !=
+			"text/html; charset=utf-8" {
+			t.Errorf("Expected HTML, got: %q", typ)
+		}
+
+		for _, e := range expected {
+			if !strings.Contains(rec.Body.String(), e) {
+				t.Errorf("Expected %q in the page, got:\n%s", e,
+					rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dir := testutil.TempDir(t, map[string]string{"index.gmi": "# Home\n"})
+	srv := httptest.NewServer(preview.NewHandler(dir, time.Millisecond))
+
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET",
+		srv.URL+preview.EventsPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if typ := res.Header.Get("Content-Type"); typ != "text/event-stream" {
+		t.Errorf("Expected event stream, got: %q", typ)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "new.gmi"),
+		[]byte("# New\n"), 0o600); err != nil {
+		t.Fatalf("could not write new.gmi: %v", err)
+	}
+
+	r := bufio.NewReader(res.Body)
+
+	var event strings.Builder
+
+	for !strings.HasSuffix(event.String(), "\n\n") {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		event.WriteString(line)
+	}
+
+	expected := "event: change\ndata: /sub/new.gmi\n\n"
+	if event.String() != expected {
+		t.Errorf("Expected event %q, got: %q", expected, event.String())
+	}
+}
+
+func TestEventsError(t *testing.T) {
+	h := preview.NewHandler(filepath.Join("testdata", "nope"), time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", preview.EventsPath, nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got: %d",
+			http.StatusInternalServerError, rec.Code)
+	}
+
+	var w noFlusher
+
+	h.ServeHTTP(&w, httptest.NewRequest("GET", preview.EventsPath, nil))
+
+	if w.code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got: %d",
+			http.StatusInternalServerError, w.code)
+	}
+}
+
+// noFlusher is an http.ResponseWriter that cannot be flushed.
+type noFlusher struct {
+	code int
+}
+
+func (w *noFlusher) Header() http.Header {
+	return http.Header{}
+}
+
+func (w *noFlusher) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *noFlusher) WriteHeader(code int) {
+	w.code = code
+}
@@ -0,0 +1,274 @@
+package site
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+)
+
+// atomNS is the XML namespace of Atom.
+const atomNS = "http://www.w3.org/2005/Atom"
+
+// feed is an Atom feed.
+type feed struct {
+	XMLName xml.Name `xml:"feed"`
+	NS      string   `xml:"xmlns,attr"`
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Links   []link   `xml:"link"`
+	Entries []entry  `xml:"entry"`
+}
+
+// entry is an entry of an Atom feed.
+type entry struct {
+	Title   string `xml:"title"`
+	ID      string `xml:"id"`
+	Updated string `xml:"updated"`
+	Link    link   `xml:"link"`
+	Summary string `xml:"summary,omitempty"`
+}
+
+// link is a link of an Atom feed or entry.
+type link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// post is a post of a gemlog.
+type post struct {
+	gmitxt.Meta
+	name string
+	url  string
+}
+
+// gemlog builds the feed of the gemlog directory, and its index page when it
+// has no index file.  The feed and the index are built from the index file
+// and the posts of the directory, which are recorded as their dependencies.
+func (b *Builder) gemlog(res *Result, dir string) error {
+	posts, err := b.posts(dir)
+	if err != nil {
+		return err
+	}
+
+	key := filepath.Join(dir, FeedName)
+	deps := []string{filepath.Join(dir, capsule.Index)}
+
+	for _, p := range posts {
+		deps = append(deps, p.name)
+	}
+
+	b.deps.Remove(key)
+	b.deps.Add(key, deps...)
+
+	if err := b.index(res, dir, posts); err != nil {
+		return err
+	}
+
+	return b.feed(res, dir, posts)
+}
+
+// posts returns the posts of the gemlog directory, from the most recent.
+func (b *Builder) posts(dir string) ([]post, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("problem reading %s: %w", dir, err)
+	}
+
+	var posts []post
+
+	for _, info := range infos {
+		name := filepath.Join(dir, info.Name())
+		if info.IsDir() || !isPost(name) || b.ignored(name) {
+			continue
+		}
+
+		meta, err := readMeta(name)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post{meta, name, b.url(name)})
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+
+	return posts, nil
+}
+
+// index builds the index page of the gemlog directory when it has no index
+// file, with a heading of the name of the directory and a link to each post
+// with its date and title.  A gemlog without posts gets no index page.
+func (b *Builder) index(res *Result, dir string, posts []post) error {
+	name := filepath.Join(dir, capsule.Index)
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+
+	rel, err := filepath.Rel(b.src, name)
+	if err != nil {
+		return fmt.Errorf("problem building %s: %w", name, err)
+	}
+
+	out := filepath.Join(b.dst, strings.TrimSuffix(rel, capsule.Ext)+PageExt)
+
+	if len(posts) == 0 {
+		return remove(res, out)
+	}
+
+	lines := []gmitxt.Line{
+		{Type: gmitxt.Head1, Text: []byte(filepath.Base(dir))},
+		{Type: gmitxt.Text},
+	}
+
+	for _, p := range posts {
+		text := p.Title
+		if date := p.Date.Format("2006-01-02"); !p.Date.IsZero() &&
+			!strings.HasPrefix(text, date) {
+			text = date + " " + text
+		}
+
+		u := url.URL{Path: "./" + filepath.Base(p.name)}
+		lines = append(lines, gmitxt.Line{
+			Type: gmitxt.Link,
+			URL:  []byte(u.String()),
+			Text: []byte(text),
+		})
+	}
+
+	var text bytes.Buffer
+
+	gw := gmitxt.NewWriter(&text)
+
+	for _, line := range lines {
+		gw.Write(line) // nolint: errcheck // cannot fail with a buffer
+	}
+
+	gw.Flush()
+
+	data, err := b.render(name, rel, bytes.NewReader(text.Bytes()))
+	if err != nil {
+		res.Errors = append(res.Errors, err)
+
+		return nil
+	}
+
+	return writeFile(res, out, data)
+}
+
+// feed builds the feed of the gemlog directory, with its posts from the most
+// recent.  Its title is the title of the index of the directory, or the name
+// of the directory.  A gemlog with its own feed file, or without posts, gets
+// no feed.
+func (b *Builder) feed(res *Result, dir string, posts []post) error {
+	key := filepath.Join(dir, FeedName)
+
+	rel, err := filepath.Rel(b.src, key)
+	if err != nil {
+		return fmt.Errorf("problem building %s: %w", key, err)
+	}
+
+	out := filepath.Join(b.dst, rel)
+
+	if _, err := os.Stat(key); err == nil {
+		return nil
+	}
+
+	if len(posts) == 0 {
+		return remove(res, out)
+	}
+
+	index := filepath.Join(dir, capsule.Index)
+
+	title := filepath.Base(dir)
+	if meta, err := readMeta(index); err == nil && meta.Title != "" {
+		title = meta.Title
+	}
+
+	f := feed{
+		NS:      atomNS,
+		Title:   title,
+		ID:      b.url(index),
+		Updated: posts[0].Date.Format(time.RFC3339),
+		Links: []link{
+			{Href: b.url(index)},
+			{Rel: "self", Href: b.url(key)},
+		},
+	}
+
+	for _, p := range posts {
+		f.Entries = append(f.Entries, entry{
+			Title:   p.Title,
+			ID:      p.url,
+			Updated: p.Date.Format(time.RFC3339),
+			Link:    link{Href: p.url},
+			Summary: p.Summary,
+		})
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("problem writing %s: %w", out, err)
+	}
+
+	buf.WriteByte('\n')
+
+	return writeFile(res, out, buf.Bytes())
+}
+
+// url returns the URL of the named file of the capsule directory in the site,
+// resolved against the URL of the site, with the path of a Gemini text file
+// rewritten to the one of its page.  A directory index is linked to as its
+// directory.
+func (b *Builder) url(name string) string {
+	rel, err := filepath.Rel(b.src, name)
+	if err != nil {
+		rel = name
+	}
+
+	p := "/" + filepath.ToSlash(rel)
+
+	if filepath.Base(p) == capsule.Index {
+		p = strings.TrimSuffix(p, capsule.Index)
+	}
+
+	if strings.HasSuffix(p, capsule.Ext) {
+		p = strings.TrimSuffix(p, capsule.Ext) + PageExt
+	}
+
+	base, err := url.Parse(b.opts.URL)
+	if err != nil || b.opts.URL == "" {
+		return p
+	}
+
+	return base.ResolveReference(&url.URL{Path: p}).String()
+}
+
+// readMeta returns the metadata of the named Gemini text file.
+func readMeta(name string) (gmitxt.Meta, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return gmitxt.Meta{}, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	return gmitxt.ExtractMeta(f), nil
+}
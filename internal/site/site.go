@@ -0,0 +1,590 @@
+// Package site builds an HTTP site from a capsule directory, so a capsule and
+// its web site are built from the same Gemini text.
+//
+// Gemini text files are rendered as HTML pages, with their include links
+// expanded and their links to other Gemini text files rewritten to link to
+// their pages.  Other files are copied as they are.  Each gemlog, which is a
+// directory with posts named by their date such as 2021-03-17-release.gmi,
+// gets an Atom feed of its posts, and an index page listing them when it has
+// no index file.  Pages can end with a section of the pages linking to them.
+// Hidden files, which start with a dot, are not built.
+//
+// The files each page and feed is built from are recorded, so when files
+// change, Rebuild builds them again with the pages that include them, the
+// pages they link to or that link to them, and the feed and index of their
+// gemlog.
+//
+// Files are only written when their content changed, and copied files are
+// skipped when their modification time and size are the ones of their source,
+// so building again is fast and keeps the modification times of unchanged
+// files.
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/html"
+	"git.sr.ht/~kiba/gmitxt/include"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+	"git.sr.ht/~kiba/gmitxt/internal/watch"
+	"git.sr.ht/~kiba/gmitxt/linkgraph"
+)
+
+// PageExt is the extension of the HTML pages of Gemini text files.
+const PageExt = ".html"
+
+// FeedName is the name of the Atom feed of a gemlog.
+const FeedName = "atom.xml"
+
+// Options are the options of a Builder.
+type Options struct {
+	// Template writes each page with a Page as its data.  If it is nil,
+	// pages are HTML documents written by the html package.
+	Template *template.Template
+	// Stylesheet is the URL of the stylesheet of the pages written without
+	// a Template, if any.
+	Stylesheet string
+	// URL is the URL of the site, such as "https://example.org/", which the
+	// links of the feeds are resolved against.  Feed readers need absolute
+	// links, which the links are not without it.
+	URL string
+	// Backlinks is the heading of a section added at the end of each page
+	// with links to the pages linking to it.  If it is empty, pages have no
+	// such section.
+	Backlinks string
+}
+
+// Page is the data of the template of a page.
+type Page struct {
+	gmitxt.Meta
+	// Path is the path of the page in the site, such as "/blog/index.html".
+	Path string
+	// Content is the HTML of the Gemini text of the page.
+	Content template.HTML
+}
+
+// Result is what a build did.
+type Result struct {
+	// Written are the names of the files written in the site directory.
+	Written []string
+	// Removed are the names of the files removed from the site directory, as
+	// their source file was removed.
+	Removed []string
+	// Errors are the problems with the source files that could not be
+	// built, with their file and line when they have one.  The other files
+	// are still built.
+	Errors []error
+}
+
+// Builder builds a site from a capsule directory.
+type Builder struct {
+	src   string
+	dst   string
+	opts  Options
+	deps  watch.Deps       // files each page and feed is built from
+	graph *linkgraph.Graph // links between the pages, with Backlinks
+}
+
+// New returns a Builder of the site directory dst from the capsule directory
+// src.
+func New(src, dst string, opts Options) *Builder {
+	return &Builder{
+		src:  filepath.Clean(src),
+		dst:  filepath.Clean(dst),
+		opts: opts,
+	}
+}
+
+// Build builds all the files of the capsule directory and the feeds of its
+// gemlogs.  It returns an error if the capsule directory cannot be walked or
+// a file cannot be written, and the problems with source files in the Result.
+func (b *Builder) Build() (Result, error) {
+	var (
+		res   Result
+		feeds = map[string]bool{}
+	)
+
+	b.linkGraph(&res)
+
+	err := filepath.Walk(b.src, func(
+		name string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+
+		if b.ignored(name) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if isPost(name) {
+			feeds[filepath.Dir(name)] = true
+		}
+
+		return b.file(&res, name)
+	})
+	if err != nil {
+		return res, fmt.Errorf("problem building %s: %w", b.src, err)
+	}
+
+	return res, b.feeds(&res, feeds)
+}
+
+// Rebuild builds the files of the capsule directory that changed, which were
+// created, modified or removed, and the pages and feeds built from them.  The
+// outputs of removed files are removed.
+func (b *Builder) Rebuild(changed []string) (Result, error) {
+	var (
+		res   Result
+		feeds = map[string]bool{}
+	)
+
+	if b.linkGraph(&res) {
+		changed = append(changed, b.linked(changed)...)
+	}
+
+	for _, name := range b.deps.Affected(changed...) {
+		if b.ignored(name) {
+			continue
+		}
+
+		if isPost(name) {
+			feeds[filepath.Dir(name)] = true
+		}
+
+		if filepath.Base(name) == FeedName {
+			feeds[filepath.Dir(name)] = true
+
+			if _, err := os.Stat(name); os.IsNotExist(err) {
+				continue
+			}
+		}
+
+		if err := b.file(&res, name); err != nil {
+			return res, err
+		}
+	}
+
+	return res, b.feeds(&res, feeds)
+}
+
+// Watch polls the capsule directory at each interval until the context is
+// done, and rebuilds the files that changed with Rebuild.  It calls fn with the
+// result and error of each rebuild.  Build must be called first, so the pages
+// built from the changed files are known.  It returns the error of the
+// context, or the first error polling the capsule directory.
+func (b *Builder) Watch(
+	ctx context.Context,
+	interval time.Duration,
+	fn func(Result, error),
+) error {
+	w, err := watch.New(b.src)
+	if err != nil {
+		return err // nolint: wrapcheck // has the directory
+	}
+
+	err = w.Watch(ctx, interval, func(changed []string) {
+		fn(b.Rebuild(changed))
+	})
+
+	return err // nolint: wrapcheck // has the directory or is of the context
+}
+
+// linkGraph builds the graph of the links between the pages with the
+// Backlinks option, and returns whether it was built.  A problem building it
+// is added to the result, and the pages are built without backlinks.
+func (b *Builder) linkGraph(res *Result) bool {
+	if b.opts.Backlinks == "" {
+		return false
+	}
+
+	g, err := linkgraph.Build(b.src)
+	if err != nil {
+		res.Errors = append(res.Errors, err)
+	}
+
+	b.graph = g
+
+	return g != nil
+}
+
+// linked returns the names of the files of the pages the changed Gemini text
+// files link to, as their backlinks changed when the links were added.  The
+// pages they no longer link to depend on them, so they are already affected.
+func (b *Builder) linked(changed []string) []string {
+	var names []string
+
+	for _, name := range changed {
+		if filepath.Ext(name) != capsule.Ext {
+			continue
+		}
+
+		for _, p := range b.graph.Links(b.pagePath(name)) {
+			names = append(names, b.fileName(p))
+		}
+	}
+
+	return names
+}
+
+// pagePath returns the path in the capsule of the named file, such as
+// /blog/index.gmi, as it is in the graph of links.
+func (b *Builder) pagePath(name string) string {
+	rel, err := filepath.Rel(b.src, name)
+	if err != nil {
+		return ""
+	}
+
+	return "/" + filepath.ToSlash(rel)
+}
+
+// fileName returns the name of the file with the path p in the capsule.
+func (b *Builder) fileName(p string) string {
+	return filepath.Join(b.src, filepath.FromSlash(p))
+}
+
+// ignored returns whether the named file or directory is not built, which is
+// when it or a directory it is in is hidden, or it is in the site directory.
+func (b *Builder) ignored(name string) bool {
+	if name == b.dst ||
+		strings.HasPrefix(name, b.dst+string(filepath.Separator)) {
+		return true
+	}
+
+	rel, err := filepath.Rel(b.src, name)
+	if err != nil {
+		return true
+	}
+
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem != "." && strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// file builds the named file of the capsule directory, or removes its output
+// when it no longer exists.
+func (b *Builder) file(res *Result, name string) error {
+	rel, err := filepath.Rel(b.src, name)
+	if err != nil {
+		return fmt.Errorf("problem building %s: %w", name, err)
+	}
+
+	out := filepath.Join(b.dst, rel)
+	if filepath.Ext(name) == capsule.Ext {
+		out = strings.TrimSuffix(out, capsule.Ext) + PageExt
+	}
+
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		b.deps.Remove(name)
+
+		if filepath.Base(name) == capsule.Index {
+			// The index page of a gemlog is built from its posts instead.
+			return b.gemlog(res, filepath.Dir(name))
+		}
+
+		return remove(res, out)
+	} else if err != nil {
+		return fmt.Errorf("problem building %s: %w", name, err)
+	}
+
+	if filepath.Ext(name) != capsule.Ext {
+		return copyFile(res, out, name, info)
+	}
+
+	data, err := b.page(name, rel)
+	if err != nil {
+		res.Errors = append(res.Errors, err)
+
+		return nil
+	}
+
+	return writeFile(res, out, data)
+}
+
+// page returns the HTML page of the named Gemini text file, with the path rel
+// in the capsule directory.
+func (b *Builder) page(name, rel string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	return b.render(name, rel, f)
+}
+
+// render returns the HTML page of the Gemini text read from r, which is of
+// the named file with the path rel in the capsule directory.  The files it
+// includes and the pages linking to it are recorded as its dependencies.
+func (b *Builder) render(name, rel string, r io.ReadSeeker) ([]byte, error) {
+	meta := gmitxt.ExtractMeta(r)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	var included []string
+
+	b.deps.Remove(name)
+
+	e := include.NewExpander(name, r, include.Options{
+		ReadFile: func(name string) ([]byte, error) {
+			included = append(included, name)
+
+			return ioutil.ReadFile(name) // nolint: gosec // included file
+		},
+	})
+
+	var content bytes.Buffer
+
+	w := html.NewWriter(&content, html.Options{
+		Document:   b.opts.Template == nil,
+		Title:      meta.Title,
+		Lang:       meta.Lang,
+		Stylesheet: b.opts.Stylesheet,
+		RewriteURL: PageURL,
+	})
+
+	for e.Scan() {
+		w.Write(e.Line().Line) // nolint: errcheck // checked by Error
+	}
+
+	b.deps.Add(name, included...)
+
+	if err := e.Err(); err != nil {
+		return nil, err // nolint: wrapcheck // has the position
+	}
+
+	b.deps.Add(name, b.backlinks(w, name)...)
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("problem rendering %s: %w", name, err)
+	}
+
+	if b.opts.Template == nil {
+		return content.Bytes(), nil
+	}
+
+	var page bytes.Buffer
+
+	err := b.opts.Template.Execute(&page, Page{
+		Meta:    meta,
+		Path:    "/" + PageURL(filepath.ToSlash(rel)),
+		Content: template.HTML(content.String()), // nolint: gosec // escaped
+	})
+	if err != nil {
+		return nil, fmt.Errorf("problem rendering %s: %w", name, err)
+	}
+
+	return page.Bytes(), nil
+}
+
+// backlinks writes the section of the pages linking to the named page with w,
+// with the Backlinks option, and returns the names of their files.
+func (b *Builder) backlinks(w *html.Writer, name string) []string {
+	if b.graph == nil {
+		return nil
+	}
+
+	var (
+		names []string
+		lines = []gmitxt.Line{
+			{Type: gmitxt.Text},
+			{Type: gmitxt.Head2, Text: []byte(b.opts.Backlinks)},
+		}
+	)
+
+	for _, p := range b.graph.Backlinks(b.pagePath(name)) {
+		if b.ignored(b.fileName(p)) {
+			continue
+		}
+
+		names = append(names, b.fileName(p))
+		lines = append(lines, gmitxt.Line{
+			Type: gmitxt.Link,
+			URL:  []byte((&url.URL{Path: p}).String()),
+			Text: []byte(b.graph.Title(p)),
+		})
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	for _, line := range lines {
+		w.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	return names
+}
+
+// PageURL returns the URL of a link in Gemini text, with the URL of a Gemini
+// text file in the capsule rewritten to the URL of its page, such as
+// "post.html#intro" for "post.gmi#intro".  Other URLs are returned as they
+// are.
+func PageURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "" || u.Host != "" ||
+		!strings.HasSuffix(u.Path, capsule.Ext) {
+		return rawurl
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, capsule.Ext) + PageExt
+
+	return u.String()
+}
+
+// postRegexp matches the names of the posts of a gemlog, which start with
+// their date in the YYYY-MM-DD format.
+var postRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}.*\.gmi$`)
+
+// isPost returns whether the named file is a post of a gemlog.
+func isPost(name string) bool {
+	return postRegexp.MatchString(filepath.Base(name))
+}
+
+// copyFile copies the named file with the info to out, unless out has the
+// same modification time and size, or the same content.  The copy has the
+// modification time of the file.
+func copyFile(res *Result, out, name string, info os.FileInfo) error {
+	if o, err := os.Stat(out); err == nil && o.Size() == info.Size() {
+		if o.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+
+		if sameFiles(out, name) {
+			return touch(out, info)
+		}
+	}
+
+	data, err := ioutil.ReadFile(name) // nolint: gosec // file to copy
+	if err != nil {
+		return fmt.Errorf("problem reading %s: %w", name, err)
+	}
+
+	if err := writeFile(res, out, data); err != nil {
+		return err
+	}
+
+	return touch(out, info)
+}
+
+// touch sets the modification time of out to the one of the info.
+func touch(out string, info os.FileInfo) error {
+	if err := os.Chtimes(out, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("problem writing %s: %w", out, err)
+	}
+
+	return nil
+}
+
+// sameFiles returns whether the named files have the same content, by their
+// hash.
+func sameFiles(a, b string) bool {
+	ha, errA := hashFile(a)
+	hb, errB := hashFile(b)
+
+	return errA == nil && errB == nil && ha == hb
+}
+
+// hashFile returns the SHA-256 hash of the content of the named file.
+func hashFile(name string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(name)
+	if err != nil {
+		return sum, err // nolint: wrapcheck // only compared
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err // nolint: wrapcheck // only compared
+	}
+
+	copy(sum[:], h.Sum(nil))
+
+	return sum, nil
+}
+
+// writeFile writes the data to the named file, creating its directory, unless
+// it already has the same content by its hash.
+func writeFile(res *Result, name string, data []byte) error {
+	if sum, err := hashFile(name); err == nil && sum == sha256.Sum256(data) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	if err := ioutil.WriteFile(name, data, 0o644); err != nil { // nolint: gosec
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+
+	res.Written = append(res.Written, name)
+
+	return nil
+}
+
+// remove removes the named file, if it exists.
+func remove(res *Result, name string) error {
+	err := os.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("problem removing %s: %w", name, err)
+	}
+
+	res.Removed = append(res.Removed, name)
+
+	return nil
+}
+
+// feeds builds the feeds and index pages of the gemlog directories, in lexical
+// order.
+func (b *Builder) feeds(res *Result, dirs map[string]bool) error {
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+
+	sort.Strings(sorted)
+
+	for _, dir := range sorted {
+		if err := b.gemlog(res, dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
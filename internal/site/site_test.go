@@ -0,0 +1,475 @@
+package site_test
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/internal/site"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestBuild(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"index.gmi": "# Home\n=> about.gmi#me About\n" +
+			"=> gemini://example.org/a.gmi Other\n=> include:footer.gmi\n",
+		"footer.gmi":                    "Bye\n",
+		"images/cat.png":                "png",
+		"gemlog/index.gmi":              "# My Gemlog\n",
+		"gemlog/2021-03-17-release.gmi": "# Release\nIt is out.\n",
+		"gemlog/2021-01-02-hello.gmi":   "# Hello\n",
+		".git/config":                   "",
+		".hidden.gmi":                   "",
+	})
+	dst := filepath.Join(src, "public")
+
+	b := site.New(src, dst, site.Options{URL: "https://example.org/"})
+
+	res, err := b.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Written, []string{
+		"footer.html",
+		"gemlog/2021-01-02-hello.html",
+		"gemlog/2021-03-17-release.html",
+		"gemlog/index.html",
+		"images/cat.png",
+		"index.html",
+		"gemlog/atom.xml",
+	})
+
+	if len(res.Errors) != 0 {
+		t.Errorf("Expected no errors, got: %v", res.Errors)
+	}
+
+	index := readFile(t, dst, "index.html")
+	for _, expected := range []string{
+		"<title>Home</title>",
+		`<a href="about.html#me">About</a>`,
+		`<a href="gemini://example.org/a.gmi">Other</a>`,
+		"<p>Bye</p>",
+	} {
+		if !strings.Contains(index, expected) {
+			t.Errorf("Expected %q in the page, got:\n%s", expected, index)
+		}
+	}
+
+	if readFile(t, dst, "images/cat.png") != "png" {
+		t.Error("Expected the image to be copied")
+	}
+
+	feed := readFile(t, dst, "gemlog/atom.xml")
+	for _, expected := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		"<title>My Gemlog</title>",
+		`<link rel="self" href="https://example.org/gemlog/atom.xml"></link>`,
+		"<updated>2021-03-17T00:00:00Z</updated>",
+		"<id>https://example.org/gemlog/2021-03-17-release.html</id>",
+		"<summary>It is out.</summary>",
+	} {
+		if !strings.Contains(feed, expected) {
+			t.Errorf("Expected %q in the feed, got:\n%s", expected, feed)
+		}
+	}
+
+	if strings.Index(feed, "Release") > strings.Index(feed, "Hello") {
+		t.Errorf("Expected the most recent post first, got:\n%s", feed)
+	}
+
+	t.Log("checking up to date files are skipped")
+
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dst, "images", "cat.png"), past,
+		past); err != nil {
+		t.Fatalf("could not change times: %v", err)
+	}
+
+	if res, err = site.New(src, dst, site.Options{
+		URL: "https://example.org/",
+	}).Build(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Written, nil)
+
+	t.Log("checking changed files are rebuilt")
+
+	write(t, src, "footer.gmi", "See you\n")
+	write(t, src, "gemlog/2021-03-18-fix.gmi", "# Fix\n")
+	write(t, src, "images/cat.png", "new")
+	remove(t, src, "gemlog/2021-01-02-hello.gmi")
+	remove(t, src, "gemlog/index.gmi")
+
+	res, err = b.Rebuild([]string{
+		filepath.Join(src, "footer.gmi"),
+		filepath.Join(src, "gemlog", "2021-01-02-hello.gmi"),
+		filepath.Join(src, "gemlog", "2021-03-18-fix.gmi"),
+		filepath.Join(src, "gemlog", "index.gmi"),
+		filepath.Join(src, "images", "cat.png"),
+		filepath.Join(src, ".git", "config"),
+		filepath.Join(dst, "index.html"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Written, []string{
+		"footer.html",
+		"gemlog/2021-03-18-fix.html",
+		"gemlog/index.html",
+		"gemlog/atom.xml",
+		"images/cat.png",
+		"index.html",
+	})
+	expectNames(t, dst, res.Removed, []string{
+		"gemlog/2021-01-02-hello.html",
+	})
+
+	if !strings.Contains(readFile(t, dst, "index.html"), "See you") {
+		t.Error("Expected the page to include the changed file")
+	}
+
+	t.Log("checking the index page of a gemlog without an index file")
+
+	index = readFile(t, dst, "gemlog/index.html")
+	if !strings.Contains(index, "<h1 id=\"gemlog\">gemlog</h1>\n"+
+		"<p><a href=\"./2021-03-18-fix.html\">2021-03-18 Fix</a></p>\n"+
+		"<p><a href=\"./2021-03-17-release.html\">2021-03-17 Release</a>"+
+		"</p>\n") {
+		t.Errorf("Expected the posts in the index page, got:\n%s", index)
+	}
+
+	feed = readFile(t, dst, "gemlog/atom.xml")
+	if !strings.Contains(feed, "<title>gemlog</title>") ||
+		!strings.Contains(feed, "<title>Fix</title>") ||
+		strings.Contains(feed, "Hello") {
+		t.Errorf("Expected the feed to be rebuilt, got:\n%s", feed)
+	}
+
+	t.Log("checking a gemlog without posts")
+
+	remove(t, src, "gemlog/2021-03-17-release.gmi")
+	remove(t, src, "gemlog/2021-03-18-fix.gmi")
+
+	res, err = b.Rebuild([]string{
+		filepath.Join(src, "gemlog", "2021-03-17-release.gmi"),
+		filepath.Join(src, "gemlog", "2021-03-18-fix.gmi"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Removed, []string{
+		"gemlog/2021-03-17-release.html",
+		"gemlog/2021-03-18-fix.html",
+		"gemlog/index.html",
+		"gemlog/atom.xml",
+	})
+}
+
+func TestBuildTemplate(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"blog/index.fr.gmi":       "# Blog\nBonjour\n",
+		"gemlog/2021-01-01.gmi":   "Hi\n",
+		"gemlog/atom.xml":         "mine",
+		"gemlog/index.gmi":        "# Mine\n",
+		"gemlog/2021-01-02.txt":   "",
+		"gemlog/2021-01-03.gmi/x": "",
+	})
+	dst := testutil.TempDir(t, nil)
+
+	tmpl := template.Must(template.New("page").Parse(
+		`<html lang="{{.Lang}}"><title>{{.Title}}</title>` +
+			`<a href="{{.Path}}">{{.Summary}}</a>{{.Content}}</html>`))
+
+	res, err := site.New(src, dst, site.Options{Template: tmpl}).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `<html lang="fr"><title>Blog</title>` +
+		`<a href="/blog/index.fr.html">Bonjour</a>` +
+		"<h1 id=\"blog\">Blog</h1>\n<p>Bonjour</p>\n</html>"
+	if actual := readFile(t, dst, "blog/index.fr.html"); actual != expected {
+		t.Errorf("Expected page:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	if readFile(t, dst, "gemlog/atom.xml") != "mine" {
+		t.Error("Expected the feed of the gemlog to be kept")
+	}
+
+	if len(res.Errors) != 0 {
+		t.Errorf("Expected no errors, got: %v", res.Errors)
+	}
+}
+
+func TestBuildBacklinks(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"index.gmi":  "# Home\n=> about.gmi About\n",
+		"about.gmi":  "# About\n",
+		"notes.gmi":  "# Notes\n",
+		".draft.gmi": "# Draft\n=> about.gmi\n",
+	})
+	dst := filepath.Join(src, "public")
+
+	b := site.New(src, dst, site.Options{Backlinks: "Linked from"})
+
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "<h2 id=\"linked-from\">Linked from</h2>\n" +
+		"<p><a href=\"/index.html\">Home</a></p>\n</body>"
+	if about := readFile(t, dst, "about.html"); !strings.Contains(about,
+		expected) {
+		t.Errorf("Expected backlinks %q, got:\n%s", expected, about)
+	}
+
+	if index := readFile(t, dst, "index.html"); strings.Contains(index,
+		"Linked from") {
+		t.Errorf("Expected no backlinks, got:\n%s", index)
+	}
+
+	t.Log("checking the pages a changed page links to are rebuilt")
+
+	write(t, src, "notes.gmi", "# Notes\n=> about.gmi\n")
+
+	res, err := b.Rebuild([]string{filepath.Join(src, "notes.gmi")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Written, []string{"about.html", "notes.html"})
+
+	if about := readFile(t, dst, "about.html"); !strings.Contains(about,
+		"<p><a href=\"/notes.html\">Notes</a></p>") {
+		t.Errorf("Expected a backlink to the changed page, got:\n%s", about)
+	}
+
+	t.Log("checking the pages a changed page linked to are rebuilt")
+
+	write(t, src, "index.gmi", "# Start\n")
+
+	res, err = b.Rebuild([]string{filepath.Join(src, "index.gmi")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectNames(t, dst, res.Written, []string{"about.html", "index.html"})
+
+	if about := readFile(t, dst, "about.html"); strings.Contains(about,
+		"/index.html") {
+		t.Errorf("Expected no backlink to the changed page, got:\n%s", about)
+	}
+
+	t.Log("checking a graph that cannot be built")
+
+	write(t, src, "long.gmi", strings.Repeat("a", 70000))
+
+	res, err = b.Rebuild([]string{filepath.Join(src, "long.gmi")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Errors) == 0 ||
+		!strings.Contains(res.Errors[0].Error(), "problem building graph") {
+		t.Errorf("Expected graph error, got: %v", res.Errors)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"a.gmi": "# A\n=> include:missing.gmi\n",
+		"b.gmi": "# B\n",
+	})
+	dst := testutil.TempDir(t, nil)
+
+	res, err := site.New(src, dst, site.Options{}).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Error(),
+		filepath.Join(src, "a.gmi")+":2: problem including missing.gmi") {
+		t.Errorf("Expected include error with its position, got: %v",
+			res.Errors)
+	}
+
+	expectNames(t, dst, res.Written, []string{"b.html"})
+
+	t.Log("checking a template error")
+
+	tmpl := template.Must(template.New("page").Parse(`{{.Nope}}`))
+
+	res, err = site.New(src, dst, site.Options{Template: tmpl}).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Errors) != 2 ||
+		!strings.Contains(res.Errors[1].Error(), "problem rendering") {
+		t.Errorf("Expected template error, got: %v", res.Errors)
+	}
+
+	t.Log("checking a site that cannot be written")
+
+	file := filepath.Join(dst, "b.html")
+
+	if _, err := site.New(src, file, site.Options{}).Build(); err == nil {
+		t.Error("Expected writing error")
+	}
+
+	if _, err := site.New(filepath.Join(src, "no"), dst,
+		site.Options{}).Build(); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+}
+
+func TestBuilderWatch(t *testing.T) {
+	src := testutil.TempDir(t, map[string]string{
+		"index.gmi":                     "# Home\n=> include:footer.gmi\n",
+		"footer.gmi":                    "Bye\n",
+		"gemlog/2021-03-17-release.gmi": "# Release\n",
+	})
+	dst := filepath.Join(src, "public")
+
+	b := site.New(src, dst, site.Options{})
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		file     string
+		text     string
+		page     string
+		expected string
+	}{
+		{"footer.gmi", "See you\n", "index.html", "See you"},
+		{"gemlog/2021-03-17-release.gmi", "# Released\n", "gemlog/index.html",
+			"2021-03-17 Released"},
+	}
+
+	for _, test := range tests {
+		t.Logf("checking %s is rebuilt when %s changes", test.page, test.file)
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			10*time.Second)
+		done := make(chan error)
+
+		go func() {
+			done <- b.Watch(ctx, 10*time.Millisecond, func(res site.Result,
+				err error) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				if len(res.Written) != 0 {
+					cancel()
+				}
+			})
+		}()
+
+		// The modification time must change for the watcher to find the
+		// change.
+		time.Sleep(20 * time.Millisecond)
+		write(t, src, test.file, test.text)
+
+		err := <-done
+
+		cancel()
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected canceled error, got: %v", err)
+		}
+
+		if page := readFile(t, dst, test.page); !strings.Contains(page,
+			test.expected) {
+			t.Errorf("Expected %q in the page, got:\n%s", test.expected,
+				page)
+		}
+	}
+
+	t.Log("checking a capsule directory that cannot be watched")
+
+	err := site.New(filepath.Join(src, "no"), dst, site.Options{}).Watch(
+		context.Background(), time.Millisecond, func(site.Result, error) {})
+	if !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"post.gmi":                   "post.html",
+		"/blog/post.gmi?q=1#intro":   "/blog/post.html?q=1#intro",
+		"blog/":                      "blog/",
+		"gemini://example.org/a.gmi": "gemini://example.org/a.gmi",
+		"//example.org/a.gmi":        "//example.org/a.gmi",
+		"%zz.gmi":                    "%zz.gmi",
+	} {
+		if actual := site.PageURL(url); actual != expected {
+			t.Errorf("Expected %q for %q, got: %q", expected, url, actual)
+		}
+	}
+}
+
+// expectNames checks the names of the files in the directory.
+func expectNames(t *testing.T, dir string, names, expected []string) {
+	t.Helper()
+
+	var actual []string
+
+	for _, name := range names {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		actual = append(actual, filepath.ToSlash(rel))
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected files %v, got: %v", expected, actual)
+	}
+}
+
+// readFile returns the contents of the file in the directory.
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatalf("could not read %s: %v", name, err)
+	}
+
+	return string(data)
+}
+
+// write writes the text to the file in the directory.
+func write(t *testing.T, dir, name, text string) {
+	t.Helper()
+
+	name = filepath.Join(dir, filepath.FromSlash(name))
+	if err := ioutil.WriteFile(name, []byte(text), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", name, err)
+	}
+}
+
+// remove removes the file in the directory.
+func remove(t *testing.T, dir, name string) {
+	t.Helper()
+
+	name = filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.Remove(name); err != nil {
+		t.Fatalf("could not remove %s: %v", name, err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package testutil has helpers shared by the tests of the packages of gmitxt.
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TempDir creates a temporary directory with the files, which are named by
+// their slash-separated path.  The directory is removed when the test ends.
+func TempDir(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gmitxt")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, text := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatalf("could not create directory: %v", err)
+		}
+
+		if err := ioutil.WriteFile(name, []byte(text), 0o600); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+
+	return dir
+}
@@ -0,0 +1,186 @@
+// Package watch watches a directory tree for changed files by polling it, so it
+// only needs the standard library and works the same on every platform.  It
+// also tracks which files depend on others, to find the files affected by a
+// change.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stamp is what is compared to tell if a file changed.
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// Watcher polls a directory tree for files that were created, modified or
+// removed.  A file is modified when its modification time or size changes.
+type Watcher struct {
+	dir   string
+	files map[string]stamp
+}
+
+// New returns a Watcher of the directory tree, which is polled once to find the
+// files in it.
+func New(dir string) (*Watcher, error) {
+	w := &Watcher{dir: dir}
+
+	files, err := w.poll()
+	if err != nil {
+		return nil, err
+	}
+
+	w.files = files
+
+	return w, nil
+}
+
+// Changes polls the directory tree and returns the names of the files that
+// were created, modified or removed since it was last polled, in lexical order.
+func (w *Watcher) Changes() ([]string, error) {
+	files, err := w.poll()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+
+	for name, s := range files {
+		if old, ok := w.files[name]; !ok || !old.mod.Equal(s.mod) ||
+			old.size != s.size {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range w.files {
+		if _, ok := files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	w.files = files
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// Watch polls the directory tree at each interval until the context is done,
+// and calls fn with the names of the files that changed, if any.  It returns
+// the error of the context, or the first error polling the tree.
+func (w *Watcher) Watch(
+	ctx context.Context,
+	interval time.Duration,
+	fn func(changed []string),
+) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err() // nolint: wrapcheck // error of the context
+		case <-t.C:
+		}
+
+		changed, err := w.Changes()
+		if err != nil {
+			return err
+		}
+
+		if len(changed) != 0 {
+			fn(changed)
+		}
+	}
+}
+
+// poll returns the stamps of the files in the directory tree.
+func (w *Watcher) poll() (map[string]stamp, error) {
+	files := map[string]stamp{}
+
+	err := filepath.Walk(w.dir, func(
+		name string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files[name] = stamp{mod: info.ModTime(), size: info.Size()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("problem watching %s: %w", w.dir, err)
+	}
+
+	return files, nil
+}
+
+// Deps tracks the files that depend on other files, such as a page that lists
+// the posts of a gemlog, or a page with a section of the pages linking to it.
+// The zero value is ready to use.
+type Deps struct {
+	dependents map[string]map[string]bool // files that depend on each file
+}
+
+// Add records that the file depends on the other files.
+func (d *Deps) Add(name string, deps ...string) {
+	if d.dependents == nil {
+		d.dependents = map[string]map[string]bool{}
+	}
+
+	for _, dep := range deps {
+		if d.dependents[dep] == nil {
+			d.dependents[dep] = map[string]bool{}
+		}
+
+		d.dependents[dep][name] = true
+	}
+}
+
+// Remove removes the dependencies of the file, such as before they are added
+// again when it changed.
+func (d *Deps) Remove(name string) {
+	for _, names := range d.dependents {
+		delete(names, name)
+	}
+}
+
+// Affected returns the changed files and the files that depend on them,
+// directly or through other files, in lexical order.
+func (d *Deps) Affected(changed ...string) []string {
+	seen := map[string]bool{}
+	queue := append([]string(nil), changed...)
+
+	for len(queue) != 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		for dependent := range d.dependents[name] {
+			queue = append(queue, dependent)
+		}
+	}
+
+	affected := make([]string, 0, len(seen))
+	for name := range seen {
+		affected = append(affected, name)
+	}
+
+	sort.Strings(affected)
+
+	return affected
+}
@@ -0,0 +1,183 @@
+package watch_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+	"git.sr.ht/~kiba/gmitxt/internal/watch"
+)
+
+func TestChanges(t *testing.T) {
+	dir := testutil.TempDir(t, nil)
+	a := write(t, dir, "a.gmi", "# A\n")
+	b := write(t, dir, "sub/b.gmi", "# B\n")
+	c := write(t, dir, "c.png", "")
+
+	w, err := watch.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectChanges(t, w, nil)
+
+	t.Log("checking modified, created and removed files")
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, future, future); err != nil {
+		t.Fatalf("could not change times of %s: %v", a, err)
+	}
+
+	if err := ioutil.WriteFile(b, []byte("# Bigger B\n"), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", b, err)
+	}
+
+	if err := os.Remove(c); err != nil {
+		t.Fatalf("could not remove %s: %v", c, err)
+	}
+
+	d := write(t, dir, "d.gmi", "")
+
+	expectChanges(t, w, []string{a, c, d, b})
+	expectChanges(t, w, nil)
+
+	t.Log("checking errors")
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("could not remove %s: %v", dir, err)
+	}
+
+	if _, err := w.Changes(); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+
+	if _, err := watch.New(dir); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := testutil.TempDir(t, nil)
+
+	w, err := watch.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	name := write(t, dir, "a.gmi", "# A\n")
+
+	var changes [][]string
+
+	err = w.Watch(ctx, time.Millisecond, func(changed []string) {
+		changes = append(changes, changed)
+
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error `%v`, got: %v", context.Canceled, err)
+	}
+
+	if !reflect.DeepEqual(changes, [][]string{{name}}) {
+		t.Errorf("Expected one change of %s, got: %v", name, changes)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("could not remove %s: %v", dir, err)
+	}
+
+	err = w.Watch(context.Background(), time.Millisecond, func([]string) {
+		t.Error("Expected no changes")
+	})
+	if !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+}
+
+func TestDeps(t *testing.T) {
+	var d watch.Deps
+
+	if affected := d.Affected("a.gmi"); !reflect.DeepEqual(affected,
+		[]string{"a.gmi"}) {
+		t.Errorf("Expected only the changed file, got: %v", affected)
+	}
+
+	d.Add("gemlog/index.gmi", "gemlog/1.gmi", "gemlog/2.gmi")
+	d.Add("atom.xml", "gemlog/index.gmi")
+	d.Add("index.gmi", "about.gmi")
+	d.Add("about.gmi", "index.gmi")
+
+	tests := []struct {
+		changed  []string
+		expected []string
+	}{
+		{
+			[]string{"gemlog/2.gmi"},
+			[]string{"atom.xml", "gemlog/2.gmi", "gemlog/index.gmi"},
+		},
+		{
+			[]string{"index.gmi", "gemlog/1.gmi"},
+			[]string{
+				"about.gmi", "atom.xml", "gemlog/1.gmi", "gemlog/index.gmi",
+				"index.gmi",
+			},
+		},
+		{[]string{"atom.xml"}, []string{"atom.xml"}},
+	}
+
+	for _, test := range tests {
+		affected := d.Affected(test.changed...)
+		if !reflect.DeepEqual(affected, test.expected) {
+			t.Errorf("Expected files affected by %v to be %v, got: %v",
+				test.changed, test.expected, affected)
+		}
+	}
+
+	d.Remove("atom.xml")
+
+	affected := d.Affected("gemlog/1.gmi")
+	if !reflect.DeepEqual(affected, []string{
+		"gemlog/1.gmi", "gemlog/index.gmi",
+	}) {
+		t.Errorf("Expected atom.xml not to be affected, got: %v", affected)
+	}
+}
+
+func expectChanges(t *testing.T, w *watch.Watcher, expected []string) {
+	t.Helper()
+
+	changed, err := w.Changes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Expected changes %v, got: %v", expected, changed)
+	}
+}
+
+// write writes the file with the slash-separated name in the directory and
+// returns its path.
+func write(t *testing.T, dir, name, text string) string {
+	t.Helper()
+
+	name = filepath.Join(dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte(text), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", name, err)
+	}
+
+	return name
+}
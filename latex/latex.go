@@ -0,0 +1,271 @@
+// Package latex renders Gemini text as LaTeX, to be included in a document
+// with \input.  The document needs the hyperref package for links, and the
+// listings package when preformatted text is written as listings.
+//
+// Headings become sections, subsections and subsubsections, lists become
+// itemize environments, quotes become quote environments and links become
+// \href commands.  Preformatted text becomes a verbatim environment, or a
+// lstlisting environment with the language of its alt text.  The special
+// characters of LaTeX are escaped everywhere else.
+package latex
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Options are the options of a Writer.
+type Options struct {
+	// Listings writes preformatted text with alt text as a lstlisting
+	// environment with the first word of the alt text as its language, such
+	// as "go".  Otherwise, preformatted text is written as a verbatim
+	// environment.
+	Listings bool
+}
+
+// Writer writes lines of Gemini text as LaTeX.
+//
+// As returned by NewWriter, a Writer writes lines with a buffer.  The client
+// should call the Flush method to end an open list or quote, and to guarantee
+// all data has been forwarded to the underlying io.Writer.  Any errors that
+// occurred should be checked by calling the Error method.
+type Writer struct {
+	w    *bufio.Writer
+	opts Options
+	env  string // environment of the open list, quote or preformatted text
+}
+
+// NewWriter returns a new Writer that writes to w with the options.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	return &Writer{w: bufio.NewWriter(w), opts: opts}
+}
+
+// Write writes a single line of Gemini text as LaTeX.  Consecutive list items
+// and quote lines are written in a single environment, which is ended by the
+// next line of another type.  Whitespace around the text of lines is trimmed
+// outside of preformatted text.  If there was an error, it is returned and can
+// also be retrieved by the Error method.
+func (w *Writer) Write(line gmitxt.Line) error {
+	text := string(line.Text)
+	if line.Type != gmitxt.PreBody {
+		text = strings.TrimSpace(text)
+	}
+
+	switch line.Type {
+	case gmitxt.Head1:
+		w.command("section", text)
+	case gmitxt.Head2:
+		w.command("subsection", text)
+	case gmitxt.Head3:
+		w.command("subsubsection", text)
+	case gmitxt.Text:
+		w.end()
+
+		if text != "" {
+			w.paragraph(Escape(text))
+		}
+	case gmitxt.Link:
+		w.end()
+		w.paragraph(link(string(line.URL), text))
+	case gmitxt.List:
+		w.begin("itemize")
+		w.item(text)
+	case gmitxt.Quote:
+		w.begin("quote")
+
+		if text != "" {
+			w.paragraph(Escape(text))
+		}
+	case gmitxt.PreStart:
+		w.end()
+		w.beginPre(text)
+	case gmitxt.PreBody:
+		w.printf("%s\n", text)
+	case gmitxt.PreEnd:
+		w.end()
+	}
+
+	return w.Error()
+}
+
+// command writes the sectioning command with the text.  Empty headings are
+// not written.
+func (w *Writer) command(name, text string) {
+	w.end()
+
+	if text == "" {
+		return
+	}
+
+	w.printf("\\%s{%s}\n\n", name, Escape(text))
+}
+
+// item writes the text as an item of a list.
+func (w *Writer) item(text string) {
+	if text == "" {
+		w.printf("\\item\n")
+
+		return
+	}
+
+	w.printf("\\item %s\n", Escape(text))
+}
+
+// paragraph writes the text as a paragraph.
+func (w *Writer) paragraph(text string) {
+	w.printf("%s\n\n", text)
+}
+
+// begin begins the environment, unless it is already open.
+func (w *Writer) begin(env string) {
+	if w.env == env {
+		return
+	}
+
+	w.end()
+	w.env = env
+	w.printf("\\begin{%s}\n", env)
+}
+
+// beginPre begins the environment of preformatted text with the alt text.
+func (w *Writer) beginPre(alt string) {
+	lang := ""
+	if fields := strings.Fields(alt); len(fields) != 0 {
+		lang = fields[0]
+	}
+
+	if !w.opts.Listings || lang == "" {
+		w.begin("verbatim")
+
+		return
+	}
+
+	w.env = "lstlisting"
+	w.printf("\\begin{lstlisting}[language=%s]\n", escapeOption(lang))
+}
+
+// end ends the open environment, if any.
+func (w *Writer) end() {
+	if w.env == "" {
+		return
+	}
+
+	w.printf("\\end{%s}\n\n", w.env)
+	w.env = ""
+}
+
+// printf writes the formatted text.  The errors are checked by Error.
+func (w *Writer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(w.w, format, args...)
+}
+
+// link returns the \href command of the link, or the \url command when it
+// has no text.
+func link(url, text string) string {
+	if text == "" {
+		return fmt.Sprintf("\\url{%s}", escapeURL(url))
+	}
+
+	return fmt.Sprintf("\\href{%s}{%s}", escapeURL(url), Escape(text))
+}
+
+// escaper escapes the special characters of LaTeX.
+var escaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`^`, `\textasciicircum{}`,
+	`~`, `\textasciitilde{}`,
+)
+
+// Escape escapes the special characters of LaTeX in the text, which are
+// \ { } $ & % # _ ^ and ~, so it is typeset as it is.
+func Escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// urlEscaper escapes the characters of a URL that cannot be in the argument
+// of \href or \url.  Braces and backslashes are percent-encoded, as they
+// cannot be escaped.
+var urlEscaper = strings.NewReplacer(
+	`\`, `\%5C`,
+	`{`, `\%7B`,
+	`}`, `\%7D`,
+	`%`, `\%`,
+	`#`, `\#`,
+)
+
+// escapeURL escapes the URL for the argument of \href or \url.
+func escapeURL(url string) string {
+	return urlEscaper.Replace(url)
+}
+
+// escapeOption escapes the value of an option, which cannot have commas,
+// brackets or the special characters of LaTeX.
+func escapeOption(value string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`,[]=\{}$&%#_^~`, r) {
+			return -1
+		}
+
+		return r
+	}, value)
+}
+
+// Flush ends an open list or quote and writes any buffered data to the
+// underlying io.Writer.  Preformatted text that is not closed is ended too.
+// To check if an error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.end()
+	w.w.Flush() // nolint: errcheck // checked by Error
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+
+	return err // nolint: wrapcheck // error from the underlying io.Writer
+}
+
+// Render reads Gemini text from src and writes it to dst as LaTeX.
+func Render(dst io.Writer, src io.Reader, opts Options) error {
+	return RenderContext(context.Background(), dst, src, opts)
+}
+
+// RenderContext is like Render, but stops reading when the context is done,
+// and returns the error of the context.
+func RenderContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+	opts Options,
+) error {
+	s := gmitxt.NewScanner(src)
+	w := NewWriter(dst, opts)
+
+	for s.ScanContext(ctx) {
+		w.Write(s.Line()) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing LaTeX: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package latex_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/latex"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		input  string
+		golden string
+		opts   latex.Options
+	}{
+		{"../testdata/example.gmi", "example.tex", latex.Options{}},
+		{"../testdata/example.gmi", "example_listings.tex",
+			latex.Options{Listings: true}},
+		{"testdata/escape.gmi", "escape.tex", latex.Options{Listings: true}},
+	}
+
+	for _, test := range tests {
+		t.Logf("rendering %s as %s", test.input, test.golden)
+
+		f, err := os.Open(test.input)
+		if err != nil {
+			t.Fatalf("could not open %s: %v", test.input, err)
+		}
+
+		golden := filepath.Join("testdata", test.golden)
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("could not read file %s: %v", golden, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = latex.Render(&buf, f, test.opts)
+		f.Close()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("Expected %s to be rendered as %s, got:\n%s",
+				test.input, golden, buf.Bytes())
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	expected := `\textbackslash{}\{\}\$\&\%\#\_\textasciicircum{}` +
+		`\textasciitilde{} text`
+	if actual := latex.Escape(`\{}$&%#_^~ text`); actual != expected {
+		t.Errorf("Expected %q, got: %q", expected, actual)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	err := latex.Render(&strings.Builder{}, errReader{}, latex.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+
+	err = latex.Render(errWriter{}, strings.NewReader("text\n"),
+		latex.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := latex.RenderContext(ctx, &strings.Builder{},
+		strings.NewReader("# Title\n"), latex.Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+var errTest = errors.New("test error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errTest
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTest
+}
@@ -1,5 +1,13 @@
 package gmitxt
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownLineType is returned when a line type name is not known.
+var ErrUnknownLineType = errors.New("unknown line type")
+
 // Line represents a line of Gemini text.
 type Line struct {
 	// Num is the line number of the source of Gemini text.  Can be 0 if not
@@ -11,6 +19,14 @@ type Line struct {
 	Text []byte
 	// URL is a slice of bytes containing the URL when the line is a Link.
 	URL []byte
+	// Offset is the byte offset of the start of the line in the source of
+	// Gemini text.  Like Num, it can be 0 if not scanned.
+	Offset int64
+	// Flags describes how the line was scanned when it was too long to fit in
+	// the scanner's buffer, or that the line was added by the scanner and is
+	// not in the source text.  This is 0 for lines of the source text that
+	// were scanned whole.
+	Flags LineFlag
 }
 
 // LineType describes the type of line in Gemini formatted text.
@@ -77,3 +93,55 @@ func (typ LineType) String() string {
 		return "UNKNOWN"
 	}
 }
+
+// MarshalText returns the name of the line type, as returned by String.  It
+// is used when the line type is encoded in JSON.
+func (typ LineType) MarshalText() ([]byte, error) {
+	if typ < Head1 || typ > Quote {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownLineType, typ)
+	}
+
+	return []byte(typ.String()), nil
+}
+
+// UnmarshalText sets the line type from its name, as returned by String.
+func (typ *LineType) UnmarshalText(text []byte) error {
+	for t := Head1; t <= Quote; t++ {
+		if t.String() == string(text) {
+			*typ = t
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownLineType, text)
+}
+
+// LineFlag is a set of bit flags that describe how a line of Gemini text was
+// scanned.
+type LineFlag uint8
+
+const (
+	// Truncated marks a line that was too long to fit in the buffer.  Only the
+	// start of the line is kept and the rest of it was discarded.
+	Truncated LineFlag = 1 << iota
+	// Split marks a fragment of a line that was too long to fit in the buffer.
+	// The next line scanned continues the fragment.
+	Split
+	// Continued marks a line that continues the fragment of the previous line.
+	// The last fragment of a split line is Continued but not Split.
+	Continued
+	// Skipped marks a line that was too long to fit in the buffer and was
+	// skipped.  The line type is identified from the start of the line, but
+	// its text and URL are empty.
+	Skipped
+	// Synthetic marks a line that is not in the source text.  For example, the
+	// PreEnd line a Scanner adds to close preformatted text that was not
+	// closed.
+	Synthetic
+)
+
+// Has returns whether all of the given flags are set.
+func (f LineFlag) Has(flags LineFlag) bool {
+	return f&flags == flags
+}
@@ -1,6 +1,7 @@
 package gmitxt_test
 
 import (
+	"errors"
 	"testing"
 
 	"git.sr.ht/~kiba/gmitxt"
@@ -53,3 +54,32 @@ func TestLineTypeString(t *testing.T) {
 		t.Errorf("Expected `Quote` for line type, got: `%s`", gmitxt.Quote)
 	}
 }
+
+func TestLineTypeText(t *testing.T) {
+	for typ := gmitxt.Head1; typ <= gmitxt.Quote; typ++ {
+		text, err := typ.MarshalText()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var actual gmitxt.LineType
+		if err := actual.UnmarshalText(text); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if actual != typ {
+			t.Errorf("Expected %s for %q, got: %s", typ, text, actual)
+		}
+	}
+
+	if _, err := gmitxt.LineType(0).MarshalText(); !errors.Is(err,
+		gmitxt.ErrUnknownLineType) {
+		t.Errorf("Expected ErrUnknownLineType, got: %v", err)
+	}
+
+	var typ gmitxt.LineType
+	if err := typ.UnmarshalText([]byte("Head4")); !errors.Is(err,
+		gmitxt.ErrUnknownLineType) {
+		t.Errorf("Expected ErrUnknownLineType, got: %v", err)
+	}
+}
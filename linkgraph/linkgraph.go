@@ -0,0 +1,297 @@
+// Package linkgraph builds the graph of the internal links between the pages
+// of a capsule, to find the pages linking to a page, pages no page links to,
+// and pages that link to no page.
+//
+// Pages are the Gemini text files in the capsule directory.  They are keyed by
+// their path in the capsule, which is the slash-separated path of the file in
+// the directory with a leading slash, such as /blog/index.gmi.  A link to a
+// directory is a link to the index.gmi file in it.
+package linkgraph
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+)
+
+// Index is the path of the home page of a capsule.  It is not an orphan, as it
+// is not expected to be linked to.
+const Index = "/" + capsule.Index
+
+// page is a page in the graph.
+type page struct {
+	title string          // text of the first heading
+	out   map[string]bool // paths of the pages it links to
+	in    map[string]bool // paths of the pages linking to it
+}
+
+// Graph is a directed graph of the internal links between the pages of a
+// capsule.  Links to remote resources, to files that are not pages, and from a
+// page to itself are not in the graph.
+type Graph struct {
+	pages map[string]*page
+}
+
+// Build scans the Gemini text files in the directory and its subdirectories
+// and returns the graph of the links between them.
+func Build(dir string) (*Graph, error) {
+	g := &Graph{pages: map[string]*page{}}
+	targets := map[string][]string{} // paths of the targets of each page
+
+	err := filepath.Walk(dir, func(
+		name string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(name) != capsule.Ext {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err // nolint: wrapcheck // wrapped below
+		}
+
+		p := "/" + filepath.ToSlash(rel)
+		g.pages[p] = &page{
+			out: map[string]bool{},
+			in:  map[string]bool{},
+		}
+		targets[p], g.pages[p].title, err = scan(name, p)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("problem building graph of %s: %w", dir, err)
+	}
+
+	for from, paths := range targets {
+		for _, to := range paths {
+			if to = g.normalize(to); to != "" && to != from {
+				g.pages[from].out[to] = true
+				g.pages[to].in[from] = true
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// scan returns the paths of the internal links in the named file with the
+// path p, and the text of its first heading.
+func scan(name, p string) ([]string, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err // nolint: wrapcheck // wrapped by Build
+	}
+	defer f.Close()
+
+	var (
+		paths []string
+		title string
+	)
+
+	s := gmitxt.NewScanner(f)
+	base := &url.URL{Path: p}
+
+	for s.Scan() {
+		line := s.Line()
+
+		switch line.Type {
+		case gmitxt.Link:
+			u, err := url.Parse(string(line.URL))
+			if err == nil && u.Scheme == "" && u.Host == "" && u.Path != "" {
+				paths = append(paths, base.ResolveReference(u).Path)
+			}
+		case gmitxt.Head1, gmitxt.Head2, gmitxt.Head3:
+			if title == "" {
+				title = strings.TrimSpace(string(line.Text))
+			}
+		case gmitxt.Text, gmitxt.PreStart, gmitxt.PreBody, gmitxt.PreEnd,
+			gmitxt.List, gmitxt.Quote:
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, "", fmt.Errorf("problem scanning %s: %w", name, err)
+	}
+
+	return paths, title, nil
+}
+
+// normalize returns the path of the page at the path of a link, or an empty
+// string if it is not a page.
+func (g *Graph) normalize(p string) string {
+	if strings.HasSuffix(p, "/") {
+		p += capsule.Index
+	}
+
+	p = path.Clean(p)
+	if g.pages[p] != nil {
+		return p
+	}
+
+	if p = path.Join(p, capsule.Index); g.pages[p] != nil {
+		return p
+	}
+
+	return ""
+}
+
+// Pages returns the paths of the pages in lexical order.
+func (g *Graph) Pages() []string {
+	paths := make([]string, 0, len(g.pages))
+	for p := range g.pages {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Title returns the text of the first heading of the page, or its path if it
+// has no heading or is not in the graph.
+func (g *Graph) Title(p string) string {
+	if pg := g.pages[p]; pg != nil && pg.title != "" {
+		return pg.title
+	}
+
+	return p
+}
+
+// Links returns the paths of the pages the page links to in lexical order.
+func (g *Graph) Links(p string) []string {
+	if pg := g.pages[p]; pg != nil {
+		return sorted(pg.out)
+	}
+
+	return nil
+}
+
+// Backlinks returns the paths of the pages linking to the page in lexical
+// order.
+func (g *Graph) Backlinks(p string) []string {
+	if pg := g.pages[p]; pg != nil {
+		return sorted(pg.in)
+	}
+
+	return nil
+}
+
+// Orphans returns the paths of the pages no other page links to in lexical
+// order.  The Index page is not an orphan.
+func (g *Graph) Orphans() []string {
+	var paths []string
+
+	for _, p := range g.Pages() {
+		if len(g.pages[p].in) == 0 && p != Index {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
+
+// DeadEnds returns the paths of the pages that link to no other page in
+// lexical order.
+func (g *Graph) DeadEnds() []string {
+	var paths []string
+
+	for _, p := range g.Pages() {
+		if len(g.pages[p].out) == 0 {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
+
+// WriteBacklinks writes the pages linking to the page as Gemini text, with a
+// link line to each page with its title as the text.  If heading is not
+// empty, the links follow a level 2 heading with the text after a blank line,
+// so the section can be appended to the page, such as when building a site.
+// Nothing is written if no page links to the page.
+func (g *Graph) WriteBacklinks(w io.Writer, p, heading string) error {
+	backlinks := g.Backlinks(p)
+	if len(backlinks) == 0 {
+		return nil
+	}
+
+	var lines []gmitxt.Line
+
+	if heading != "" {
+		lines = append(lines,
+			gmitxt.Line{Type: gmitxt.Text},
+			gmitxt.Line{Type: gmitxt.Head2, Text: []byte(heading)})
+	}
+
+	for _, b := range backlinks {
+		lines = append(lines, gmitxt.Line{
+			Type: gmitxt.Link,
+			URL:  []byte((&url.URL{Path: b}).String()),
+			Text: []byte(g.Title(b)),
+		})
+	}
+
+	gw := gmitxt.NewWriter(w)
+
+	for _, line := range lines {
+		gw.Write(line) // nolint: errcheck // checked by Error
+	}
+
+	gw.Flush()
+
+	return gw.Error() // nolint: wrapcheck // error from the writer
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz.  Each page is a
+// node labeled with its title, and each link is an edge.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("digraph capsule {\n")
+
+	for _, p := range g.Pages() {
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(p), dotQuote(g.Title(p)))
+	}
+
+	for _, p := range g.Pages() {
+		for _, to := range g.Links(p) {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(p), dotQuote(to))
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err // nolint: wrapcheck // error from the writer
+}
+
+// dotQuote returns the string as a quoted DOT ID.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// sorted returns the keys of the set in lexical order.
+func sorted(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,183 @@
+package linkgraph_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+	"git.sr.ht/~kiba/gmitxt/linkgraph"
+)
+
+var capsule = map[string]string{
+	"index.gmi": "# Home\n" +
+		"=> blog/ Blog\n" +
+		"=> about.gmi About\n" +
+		"=> index.gmi#top Self\n" +
+		"=> gemini://example.org/ Remote\n" +
+		"=> image.png Image\n" +
+		"=> missing.gmi Missing\n",
+	"about.gmi": "Text before the heading\n## About \"me\"\n=> / Home\n",
+	"blog/index.gmi": "# Blog\n" +
+		"=> first%20post.gmi First\n" +
+		"=> /blog/second.gmi?x=1 Second\n",
+	"blog/first post.gmi":  "# First\n=> /blog Blog\n=> ../about.gmi About\n",
+	"blog/second.gmi":      "No heading\n",
+	"drafts/draft.gmi":     "# Draft\n=> ../index.gmi Home\n",
+	"image.png":            "",
+	"blog/notes/index.txt": "not Gemini text\n",
+}
+
+func TestBuild(t *testing.T) {
+	g, err := linkgraph.Build(testutil.TempDir(t, capsule))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectPaths(t, "pages", g.Pages(), []string{
+		"/about.gmi",
+		"/blog/first post.gmi",
+		"/blog/index.gmi",
+		"/blog/second.gmi",
+		"/drafts/draft.gmi",
+		"/index.gmi",
+	})
+	expectPaths(t, "links", g.Links("/index.gmi"), []string{
+		"/about.gmi",
+		"/blog/index.gmi",
+	})
+	expectPaths(t, "backlinks", g.Backlinks("/about.gmi"), []string{
+		"/blog/first post.gmi",
+		"/index.gmi",
+	})
+	expectPaths(t, "backlinks", g.Backlinks("/index.gmi"), []string{
+		"/about.gmi",
+		"/drafts/draft.gmi",
+	})
+	expectPaths(t, "orphans", g.Orphans(), []string{"/drafts/draft.gmi"})
+	expectPaths(t, "dead ends", g.DeadEnds(), []string{"/blog/second.gmi"})
+	expectPaths(t, "links", g.Links("/nope.gmi"), nil)
+	expectPaths(t, "backlinks", g.Backlinks("/nope.gmi"), nil)
+
+	for p, title := range map[string]string{
+		"/about.gmi":       `About "me"`,
+		"/blog/second.gmi": "/blog/second.gmi",
+		"/nope.gmi":        "/nope.gmi",
+	} {
+		if got := g.Title(p); got != title {
+			t.Errorf("Expected title of %s to be %q, got: %q", p, title, got)
+		}
+	}
+}
+
+func TestWriteBacklinks(t *testing.T) {
+	g, err := linkgraph.Build(testutil.TempDir(t, capsule))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+
+	if err := g.WriteBacklinks(&b, "/about.gmi", "Backlinks"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "\n## Backlinks\n" +
+		"=> /blog/first%20post.gmi First\n" +
+		"=> /index.gmi Home\n"
+	if b.String() != expected {
+		t.Errorf("Expected backlinks %q, got: %q", expected, b.String())
+	}
+
+	b.Reset()
+
+	if err := g.WriteBacklinks(&b, "/blog/second.gmi", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.String() != "=> /blog/index.gmi Blog\n" {
+		t.Errorf("Expected backlinks without heading, got: %q", b.String())
+	}
+
+	b.Reset()
+
+	err = g.WriteBacklinks(&b, "/drafts/draft.gmi", "Backlinks")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.Len() != 0 {
+		t.Errorf("Expected no backlinks, got: %q", b.String())
+	}
+
+	if err := g.WriteBacklinks(errWriter{}, "/about.gmi", ""); !errors.Is(
+		err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g, err := linkgraph.Build(testutil.TempDir(t, map[string]string{
+		"index.gmi": "# Home\n=> a.gmi A\n",
+		"a.gmi":     "# A \\ \"B\"\n=> index.gmi Home\n",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var b bytes.Buffer
+
+	if err := g.WriteDOT(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `digraph capsule {
+	"/a.gmi" [label="A \\ \"B\""];
+	"/index.gmi" [label="Home"];
+	"/a.gmi" -> "/index.gmi";
+	"/index.gmi" -> "/a.gmi";
+}
+`
+	if b.String() != expected {
+		t.Errorf("Expected DOT:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	if err := g.WriteDOT(errWriter{}); !errors.Is(err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	_, err := linkgraph.Build(filepath.Join("testdata", "nope"))
+	if !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+
+	_, err = linkgraph.Build(testutil.TempDir(t, map[string]string{
+		"index.gmi": strings.Repeat("a", 70000),
+	}))
+	if err == nil {
+		t.Error("Expected error for a line too long to scan, got nil")
+	}
+}
+
+var errWrite = errors.New("write error")
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func expectPaths(t *testing.T, name string, paths, expected []string) {
+	t.Helper()
+
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %s %q, got: %q", name, expected, paths)
+	}
+}
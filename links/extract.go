@@ -0,0 +1,124 @@
+package links
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Link is a link line in Gemini text.
+type Link struct {
+	// File is the name of the file the link is in, if it is known.
+	File string `json:"file"`
+	// Line is the line number of the link.
+	Line uint32 `json:"line"`
+	// URL is the URL of the link as it is in the text.
+	URL string `json:"url"`
+	// Resolved is the URL resolved against the URL of the text.  It is
+	// empty if the URL is invalid.
+	Resolved string `json:"resolved"`
+	// Scheme is the scheme of the resolved URL, such as gemini or https.
+	Scheme string `json:"scheme"`
+	// Host is the host of the resolved URL, including its port if any.
+	Host string `json:"host"`
+	// Text is the descriptive text of the link.
+	Text string `json:"text"`
+	// Internal tells if the link is to the same capsule as the text, which
+	// is when the URL has no scheme and host, or the same as the URL of the
+	// text.
+	Internal bool `json:"internal"`
+}
+
+// Iter iterates over the links in Gemini text.  Successive calls to Next step
+// through the links, skipping the other lines.  Like a Scanner, iterating
+// stops at the end of the text or at the first error.
+//
+//     it := links.ExtractLinks(r)
+//     for it.Next() {
+//         fmt.Println(it.Link().Resolved)
+//     }
+//     if err := it.Err(); err != nil {
+//         // handle error
+//     }
+type Iter struct {
+	s    *gmitxt.Scanner
+	file string
+	base *url.URL
+	link Link
+}
+
+// ExtractLinks returns an Iter over the links in the Gemini text read from r.
+func ExtractLinks(r io.Reader) *Iter {
+	return ScanLinks(gmitxt.NewScanner(r))
+}
+
+// ScanLinks returns an Iter over the links in the Gemini text scanned by s,
+// such as the Scanner of a Gemini response.
+func ScanLinks(s *gmitxt.Scanner) *Iter {
+	return &Iter{s: s}
+}
+
+// Source sets the name of the file the text is from and the URL of the text,
+// which links are resolved against.  The URL can be nil, in which case links
+// are resolved as they are.  It must be called before Next.
+func (it *Iter) Source(file string, base *url.URL) {
+	it.file = file
+	it.base = base
+}
+
+// Next advances to the next link, which is then available through Link.  It
+// returns false when there are no more links, either by reaching the end of
+// the text or an error.
+func (it *Iter) Next() bool {
+	for it.s.Scan() {
+		line := it.s.Line()
+		if line.Type == gmitxt.Link {
+			it.link = it.parse(line)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Link returns the current link.
+func (it *Iter) Link() Link {
+	return it.link
+}
+
+// Err returns the first error that occurred while reading the text.
+func (it *Iter) Err() error {
+	return it.s.Err() // nolint: wrapcheck // error from the Scanner
+}
+
+// parse returns the Link of a link line.
+func (it *Iter) parse(line gmitxt.Line) Link {
+	link := Link{
+		File: it.file,
+		Line: line.Num,
+		URL:  string(line.URL),
+		Text: string(line.Text),
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return link
+	}
+
+	link.Internal = u.Scheme == "" && u.Host == ""
+
+	if it.base != nil {
+		u = it.base.ResolveReference(u)
+		link.Internal = link.Internal || (u.Scheme == it.base.Scheme &&
+			strings.EqualFold(u.Host, it.base.Host))
+	}
+
+	link.Resolved = u.String()
+	link.Scheme = u.Scheme
+	link.Host = u.Host
+
+	return link
+}
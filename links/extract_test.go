@@ -0,0 +1,127 @@
+package links_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+const extract = "# Links\n" +
+	"=> post.gmi Post\n" +
+	"Text\n" +
+	"=> /about.gmi\n" +
+	"```\n=> not a link\n```\n" +
+	"=> gemini://Example.org/x Same host\n" +
+	"=> https://example.com/ Web\n" +
+	"=> //other.org/y Other\n" +
+	"=> mailto:kiba@example.org Mail\n" +
+	"=> %zz Invalid\n"
+
+func TestExtractLinks(t *testing.T) {
+	base, err := url.Parse("gemini://example.org/blog/index.gmi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	it := links.ExtractLinks(strings.NewReader(extract))
+	it.Source("blog/index.gmi", base)
+
+	expected := []links.Link{
+		{
+			File: "blog/index.gmi", Line: 2, URL: "post.gmi",
+			Resolved: "gemini://example.org/blog/post.gmi",
+			Scheme:   "gemini", Host: "example.org", Text: "Post",
+			Internal: true,
+		},
+		{
+			File: "blog/index.gmi", Line: 4, URL: "/about.gmi",
+			Resolved: "gemini://example.org/about.gmi",
+			Scheme:   "gemini", Host: "example.org", Internal: true,
+		},
+		{
+			File: "blog/index.gmi", Line: 8, URL: "gemini://Example.org/x",
+			Resolved: "gemini://Example.org/x",
+			Scheme:   "gemini", Host: "Example.org", Text: "Same host",
+			Internal: true,
+		},
+		{
+			File: "blog/index.gmi", Line: 9, URL: "https://example.com/",
+			Resolved: "https://example.com/",
+			Scheme:   "https", Host: "example.com", Text: "Web",
+		},
+		{
+			File: "blog/index.gmi", Line: 10, URL: "//other.org/y",
+			Resolved: "gemini://other.org/y",
+			Scheme:   "gemini", Host: "other.org", Text: "Other",
+		},
+		{
+			File: "blog/index.gmi", Line: 11, URL: "mailto:kiba@example.org",
+			Resolved: "mailto:kiba@example.org",
+			Scheme:   "mailto", Text: "Mail",
+		},
+		{
+			File: "blog/index.gmi", Line: 12, URL: "%zz", Text: "Invalid",
+		},
+	}
+
+	expectLinks(t, it, expected)
+
+	t.Log("checking without a source")
+
+	it = links.ExtractLinks(strings.NewReader(extract))
+	expected = []links.Link{
+		{Line: 2, URL: "post.gmi", Resolved: "post.gmi", Text: "Post",
+			Internal: true},
+		{Line: 4, URL: "/about.gmi", Resolved: "/about.gmi", Internal: true},
+	}
+
+	for i := 0; i < len(expected) && it.Next(); i++ {
+		if link := it.Link(); !reflect.DeepEqual(link, expected[i]) {
+			t.Errorf("Expected link %+v, got: %+v", expected[i], link)
+		}
+	}
+
+	t.Log("checking with an error")
+
+	it = links.ExtractLinks(errReader{})
+	expectLinks(t, it, nil)
+
+	if !errors.Is(it.Err(), errRead) {
+		t.Errorf("Expected error `%v`, got: %v", errRead, it.Err())
+	}
+}
+
+var errRead = errors.New("read error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errRead
+}
+
+func expectLinks(t *testing.T, it *links.Iter, expected []links.Link) {
+	t.Helper()
+
+	var got []links.Link
+
+	for it.Next() {
+		got = append(got, it.Link())
+	}
+
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d links, got %d: %+v", len(expected), len(got), got)
+
+		return
+	}
+
+	for i, link := range got {
+		if !reflect.DeepEqual(link, expected[i]) {
+			t.Errorf("Expected link %+v, got: %+v", expected[i], link)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package links extracts and checks the links in the Gemini text files of a
+// capsule.
+//
+// Relative links are resolved against the path of the file they are in, and
+// links with an absolute path are resolved against the capsule directory.  A
+// link is broken when its target does not exist, or when its fragment does not
+// match the slug of a heading in the target.  Links to remote resources are
+// only checked by a RemoteChecker.
+package links
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/capsule"
+)
+
+// Problem is a broken link.
+type Problem struct {
+	// File is the name of the file the link is in.
+	File string `json:"file"`
+	// Line is the line number of the link.
+	Line uint32 `json:"line"`
+	// URL is the URL of the link as it is in the text.
+	URL string `json:"url"`
+	// Message describes why the link is broken.
+	Message string `json:"message"`
+}
+
+// String returns the problem as "file:line: url: message".
+func (p Problem) String() string {
+	return p.File + ":" + strconv.FormatUint(uint64(p.Line), 10) + ": " +
+		p.URL + ": " + p.Message
+}
+
+// RemoteChecker checks links to remote resources, which are links with a
+// scheme or a host.
+type RemoteChecker interface {
+	// CheckRemote returns an error if the resource at the URL cannot be
+	// reached.
+	CheckRemote(u *url.URL) error
+}
+
+// Checker checks the links in the Gemini text files of a capsule directory.
+type Checker struct {
+	// Remote checks links to remote resources.  If it is nil, they are
+	// skipped.
+	Remote RemoteChecker
+
+	dir     string                     // capsule directory
+	slugs   map[string]map[string]bool // slugs of the headings of files
+	remotes map[string]error           // results of remote checks by URL
+}
+
+// Check checks the links in the Gemini text files in the directory and its
+// subdirectories.  It returns the broken links in the order of the files and
+// lines they are in.  An error is returned if a file cannot be read.
+func (c *Checker) Check(dir string) ([]Problem, error) {
+	c.dir = dir
+	c.slugs = map[string]map[string]bool{}
+	c.remotes = map[string]error{}
+
+	var problems []Problem
+
+	err := filepath.Walk(dir, func(
+		name string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(name) != capsule.Ext {
+			return nil
+		}
+
+		p, err := c.checkFile(name)
+		problems = append(problems, p...)
+
+		return err
+	})
+	if err != nil {
+		return problems, fmt.Errorf("problem checking %s: %w", dir, err)
+	}
+
+	return problems, nil
+}
+
+// link is a link in a file.
+type link struct {
+	num uint32 // line number
+	url string // URL as it is in the text
+}
+
+// checkFile checks the links in the named file.
+func (c *Checker) checkFile(name string) ([]Problem, error) {
+	links, slugs, err := scan(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.slugs[name] = slugs
+
+	var problems []Problem
+
+	for _, l := range links {
+		msg, err := c.checkLink(name, l.url)
+		if err != nil {
+			return problems, err
+		}
+
+		if msg != "" {
+			problems = append(problems, Problem{
+				File:    name,
+				Line:    l.num,
+				URL:     l.url,
+				Message: msg,
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// checkLink checks the link with the URL in the named file.  It returns why
+// the link is broken, or an empty string if it is not.
+func (c *Checker) checkLink(name, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid URL", nil
+	}
+
+	if u.Scheme != "" || u.Host != "" {
+		return c.checkRemote(u), nil
+	}
+
+	target := name
+
+	switch {
+	case u.Path == "":
+	case path.IsAbs(u.Path):
+		target = filepath.Join(c.dir, filepath.FromSlash(u.Path))
+	default:
+		target = filepath.Join(filepath.Dir(name), filepath.FromSlash(u.Path))
+	}
+
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return "target does not exist", nil
+	} else if err != nil {
+		return "target cannot be read", nil
+	}
+
+	if u.Fragment == "" {
+		return "", nil
+	}
+
+	if info.IsDir() {
+		target = filepath.Join(target, capsule.Index)
+	}
+
+	if filepath.Ext(target) != capsule.Ext {
+		return "", nil
+	}
+
+	slugs, err := c.headings(target)
+	if os.IsNotExist(err) {
+		return "target does not exist", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if !slugs[u.Fragment] {
+		return "no heading matches the fragment", nil
+	}
+
+	return "", nil
+}
+
+// checkRemote checks the link to a remote resource with the Remote checker.
+// The result is kept, so each URL is checked once.
+func (c *Checker) checkRemote(u *url.URL) string {
+	if c.Remote == nil {
+		return ""
+	}
+
+	key := u.String()
+
+	err, ok := c.remotes[key]
+	if !ok {
+		err = c.Remote.CheckRemote(u)
+		c.remotes[key] = err
+	}
+
+	if err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
+
+// headings returns the slugs of the headings in the named file.  The slugs are
+// kept, so each file is scanned once.
+func (c *Checker) headings(name string) (map[string]bool, error) {
+	if slugs, ok := c.slugs[name]; ok {
+		return slugs, nil
+	}
+
+	_, slugs, err := scan(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.slugs[name] = slugs
+
+	return slugs, nil
+}
+
+// scan returns the links in the named file and the slugs of its headings.
+func scan(name string) ([]link, map[string]bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err // nolint: wrapcheck // checked by callers
+	}
+	defer f.Close()
+
+	var (
+		links []link
+		slugs = map[string]bool{}
+		ids   Slugs
+	)
+
+	s := gmitxt.NewScanner(f)
+
+	for s.Scan() {
+		line := s.Line()
+
+		switch line.Type {
+		case gmitxt.Link:
+			links = append(links, link{num: line.Num, url: string(line.URL)})
+		case gmitxt.Head1, gmitxt.Head2, gmitxt.Head3:
+			if slug := ids.Next(string(line.Text)); slug != "" {
+				slugs[slug] = true
+			}
+		case gmitxt.Text, gmitxt.PreStart, gmitxt.PreBody, gmitxt.PreEnd,
+			gmitxt.List, gmitxt.Quote:
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, nil, fmt.Errorf("problem scanning %s: %w", name, err)
+	}
+
+	return links, slugs, nil
+}
+
+// Slugs gives the headings of a document their slugs, in order.  Headings
+// with the same slug are told apart by a number, so the second "Notes"
+// heading is "notes-1".  The zero value is ready to use.
+type Slugs struct {
+	used map[string]bool // slugs already given
+}
+
+// Next returns the slug of the next heading of the document, which has the
+// text.  It returns an empty string if the text has no letters or digits.
+func (s *Slugs) Next(text string) string {
+	slug := Slug(text)
+	if slug == "" {
+		return ""
+	}
+
+	if s.used == nil {
+		s.used = map[string]bool{}
+	}
+
+	id := slug
+	for n := 1; s.used[id]; n++ {
+		id = slug + "-" + strconv.Itoa(n)
+	}
+
+	s.used[id] = true
+
+	return id
+}
+
+// Slug returns the slug of the text of a heading, which is the fragment used
+// to link to it.  The text is lowercased, its letters and digits are kept, and
+// each run of spaces, dashes and underscores becomes a single dash.  Other
+// characters are removed.  For example, the slug of "Getting Started!" is
+// "getting-started".
+func Slug(text string) string {
+	var (
+		b    strings.Builder
+		dash bool // whether a dash is needed before the next letter or digit
+	)
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() != 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+
+			dash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+
+	return b.String()
+}
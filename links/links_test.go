@@ -0,0 +1,210 @@
+package links_test
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+	"git.sr.ht/~kiba/gmitxt/links"
+)
+
+var capsule = map[string]string{
+	"index.gmi": "# Home\n" +
+		"=> about.gmi About\n" +
+		"=> /blog/ Blog\n" +
+		"=> missing.gmi Missing\n" +
+		"=> about.gmi#contact Contact\n" +
+		"=> about.gmi#nope Nope\n" +
+		"=> #home Top\n" +
+		"=> ?query Query\n" +
+		"=> gemini://example.org/ Remote\n" +
+		"=> //example.org/down Down\n" +
+		"=> %zz Invalid\n",
+	"about.gmi": "# About\n## Contact\n## Notes\n## Notes\n" +
+		"=> #notes-1 Second notes\n" +
+		"=> image.png#x Image\n" +
+		"=> index.gmi#home Home\n",
+	"image.png": "",
+	"blog/index.gmi": "# Blog Posts!\n" +
+		"=> ../index.gmi Home\n" +
+		"=> /blog#blog-posts Self\n" +
+		"=> ../about.gmi#notes Notes\n" +
+		"=> /gone/#x Gone\n",
+	"blog/draft.txt": "not Gemini text\n",
+}
+
+// remote is a RemoteChecker that fails for the example.org/down URL and
+// counts the URLs it checks.
+type remote map[string]int
+
+var errDown = errors.New("host is down")
+
+func (r remote) CheckRemote(u *url.URL) error {
+	r[u.String()]++
+
+	if u.Path == "/down" {
+		return errDown
+	}
+
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	dir := testutil.TempDir(t, capsule)
+
+	var c links.Checker
+
+	problems, err := c.Check(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"blog/index.gmi:5: /gone/#x: target does not exist",
+		"index.gmi:4: missing.gmi: target does not exist",
+		"index.gmi:6: about.gmi#nope: no heading matches the fragment",
+		"index.gmi:11: %zz: invalid URL",
+	}
+	expectProblems(t, dir, problems, expected)
+
+	t.Log("checking with a remote checker")
+
+	r := remote{}
+	c.Remote = r
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "remote.gmi"),
+		[]byte("=> //example.org/down Down again\n"), 0o600); err != nil {
+		t.Fatalf("could not write remote.gmi: %v", err)
+	}
+
+	problems, err = c.Check(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectProblems(t, dir, problems, []string{
+		expected[0],
+		expected[1],
+		expected[2],
+		"index.gmi:10: //example.org/down: host is down",
+		expected[3],
+		"remote.gmi:1: //example.org/down: host is down",
+	})
+
+	if r["//example.org/down"] != 1 || r["gemini://example.org/"] != 1 {
+		t.Errorf("Expected each remote URL checked once, got: %v", r)
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	var c links.Checker
+
+	_, err := c.Check(filepath.Join("testdata", "nope"))
+	if !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("Expected not exist error, got: %v", err)
+	}
+
+	dir := testutil.TempDir(t, map[string]string{
+		"index.gmi": "=> a.gmi#x A\n=> a%00 Null\n",
+		"a.gmi/x":   "",
+	})
+
+	problems, err := c.Check(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectProblems(t, dir, problems, []string{
+		"index.gmi:1: a.gmi#x: target does not exist",
+		"index.gmi:2: a%00: target cannot be read",
+	})
+
+	t.Log("checking files too long to scan")
+
+	long := strings.Repeat("a", 70000)
+
+	for _, files := range []map[string]string{
+		{"a.gmi": long},
+		{"a.gmi": "=> b.gmi#x B\n", "b.gmi": long},
+	} {
+		_, err = c.Check(testutil.TempDir(t, files))
+		if !errors.Is(err, bufio.ErrTooLong) {
+			t.Errorf("Expected error `%v`, got: %v", bufio.ErrTooLong, err)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Getting Started!":        "getting-started",
+		"  Spaces  and\ttabs  ":   "spaces-and-tabs",
+		"snake_case and-dashes":   "snake-case-and-dashes",
+		"Ünïcödé Heading 2":       "ünïcödé-heading-2",
+		"What's new? (2021)":      "whats-new-2021",
+		"!!!":                     "",
+		"-- Leading and trailing": "leading-and-trailing",
+	}
+
+	for text, expected := range tests {
+		if slug := links.Slug(text); slug != expected {
+			t.Errorf("Expected slug of %q to be %q, got: %q",
+				text, expected, slug)
+		}
+	}
+}
+
+func TestSlugs(t *testing.T) {
+	var s links.Slugs
+
+	for _, test := range []struct {
+		text     string
+		expected string
+	}{
+		{"Notes", "notes"},
+		{"notes!", "notes-1"},
+		{"Notes 1", "notes-1-1"},
+		{"!!!", ""},
+		{"Notes", "notes-2"},
+		{"Other", "other"},
+	} {
+		if slug := s.Next(test.text); slug != test.expected {
+			t.Errorf("Expected slug of %q to be %q, got: %q",
+				test.text, test.expected, slug)
+		}
+	}
+}
+
+func expectProblems(
+	t *testing.T,
+	dir string,
+	problems []links.Problem,
+	expected []string,
+) {
+	t.Helper()
+
+	if len(problems) != len(expected) {
+		t.Errorf("Expected %d problems, got %d: %v",
+			len(expected), len(problems), problems)
+
+		return
+	}
+
+	for i, p := range problems {
+		rel, err := filepath.Rel(dir, p.File)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		p.File = filepath.ToSlash(rel)
+
+		if p.String() != expected[i] {
+			t.Errorf("Expected problem `%s`, got: `%s`", expected[i], p)
+		}
+	}
+}
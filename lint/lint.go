@@ -0,0 +1,379 @@
+// Package lint checks Gemini text for problems with a set of rules.  Each rule
+// checks the lines scanned by a gmitxt.Scanner and reports a Diagnostic for
+// each problem it finds.  Rules are kept in a registry and can be enabled or
+// disabled by name with a Config.  Additional rules can be added to the
+// registry with Register.
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// ErrUnknownRule is returned when a Config names a rule that is not in the
+// registry.
+var ErrUnknownRule = errors.New("unknown rule")
+
+// Rule checks lines of Gemini text for problems.  A new Rule is created for
+// each text that is checked, so it can keep state between lines.
+type Rule interface {
+	// Check checks a line that was scanned and reports any problems found
+	// with the Context.
+	Check(c *Context, line gmitxt.Line)
+}
+
+// Ender is implemented by a Rule that checks for problems at the end of the
+// text, such as problems with the text as a whole.
+type Ender interface {
+	// End is called after the last line of the text was checked.
+	End(c *Context)
+}
+
+// RuleInfo describes a rule in the registry.
+type RuleInfo struct {
+	// Name is the name of the rule used to enable or disable it.  Names are
+	// lowercase words separated by dashes, such as "trailing-whitespace".
+	Name string
+	// Doc is a short description of the problems reported by the rule.
+	Doc string
+	// Default is whether the rule is enabled when the Config does not enable
+	// or disable it.
+	Default bool
+	// New returns a new Rule to check a text with the given Config.
+	New func(cfg Config) Rule
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]RuleInfo{}
+)
+
+// Register adds a rule to the registry.  If Register is called twice with the
+// same rule name, it panics.
+func Register(info RuleInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, dup := registry[info.Name]; dup {
+		panic("lint: Register called twice for rule " + info.Name)
+	}
+
+	registry[info.Name] = info
+}
+
+// Rules returns the rules in the registry sorted by name.
+func Rules() []RuleInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	rules := make([]RuleInfo, 0, len(registry))
+	for _, info := range registry {
+		rules = append(rules, info)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+
+	return rules
+}
+
+// Config configures which rules are enabled and how they check text.  It can
+// be read from a JSON file with ReadConfig.
+type Config struct {
+	// Rules enables or disables rules by name.  Rules that are not listed are
+	// enabled or disabled by their default.
+	Rules map[string]bool `json:"rules,omitempty"`
+	// MaxLineLength is the maximum length of a line in preformatted text in
+	// characters, checked by the long-line rule.  If it is 0,
+	// DefaultMaxLineLength is used.
+	MaxLineLength int `json:"maxLineLength,omitempty"`
+}
+
+// DefaultMaxLineLength is the maximum length of a line in preformatted text
+// used when a Config does not set it.
+const DefaultMaxLineLength = 80
+
+// ReadConfig reads a Config in JSON format, such as:
+//
+//     {
+//         "rules": {"link-no-text": false},
+//         "maxLineLength": 100
+//     }
+//
+func ReadConfig(r io.Reader) (Config, error) {
+	var cfg Config
+
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("problem reading config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Diagnostic describes a problem found by a rule.
+type Diagnostic struct {
+	// File is the name of the file of the text that was checked.
+	File string `json:"file"`
+	// Line is the line number of the problem.
+	Line uint32 `json:"line"`
+	// Col is the column of the byte in the line where the problem starts,
+	// starting at 1.
+	Col int `json:"col"`
+	// Rule is the name of the rule that reported the problem.
+	Rule string `json:"rule"`
+	// Message describes the problem.
+	Message string `json:"message"`
+	// Fix are the edits that fix the problem, if it can be fixed.  The edits
+	// are applied together by Apply.
+	Fix []Edit `json:"fix,omitempty"`
+}
+
+// Edit replaces a range of bytes in a text with new text.
+type Edit struct {
+	// Start is the byte offset of the start of the range in the text.
+	Start int64 `json:"start"`
+	// End is the byte offset of the end of the range in the text.  The byte at
+	// End is not replaced.  If End is equal to Start, New is inserted.
+	End int64 `json:"end"`
+	// New is the text the range is replaced with.  If it is empty, the range
+	// is deleted.
+	New string `json:"new"`
+}
+
+// String returns the diagnostic in the format "file:line:col: rule: message".
+func (d Diagnostic) String() string {
+	return d.File + ":" + strconv.FormatUint(uint64(d.Line), 10) + ":" +
+		strconv.Itoa(d.Col) + ": " + d.Rule + ": " + d.Message
+}
+
+// Context is given to a rule to check a line and report problems.
+type Context struct {
+	// File is the name of the file of the text being checked.
+	File string
+	// Config is the configuration the text is checked with.
+	Config Config
+
+	rule  string       // name of the rule being run
+	bytes []byte       // bytes of the line as they are in the text
+	diags []Diagnostic // problems reported
+	size  int64        // number of bytes of the text read so far
+	last  byte         // last byte of the text read so far
+}
+
+// Bytes returns the bytes of the line being checked as they are in the text,
+// without the new line.
+func (c *Context) Bytes() []byte {
+	return c.bytes
+}
+
+// Size returns the number of bytes of the text.  It is only complete when the
+// rule's End method is called.
+func (c *Context) Size() int64 {
+	return c.size
+}
+
+// Report reports a problem found by the rule at the given line number and
+// column.
+func (c *Context) Report(num uint32, col int, msg string) {
+	c.ReportFix(num, col, msg)
+}
+
+// ReportFix reports a problem found by the rule at the given line number and
+// column, with the edits that fix it.  The offsets of the edits are from the
+// start of the text, such as the Offset of a line plus the byte offset in the
+// line.
+func (c *Context) ReportFix(num uint32, col int, msg string, fix ...Edit) {
+	c.diags = append(c.diags, Diagnostic{
+		File:    c.File,
+		Line:    num,
+		Col:     col,
+		Rule:    c.rule,
+		Message: msg,
+		Fix:     fix,
+	})
+}
+
+// read counts the bytes read from the text and keeps the last one.
+func (c *Context) read(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if n > 0 {
+			c.size += int64(n)
+			c.last = p[n-1]
+		}
+
+		return n, err // nolint: wrapcheck // passed to the Scanner
+	})
+}
+
+// readerFunc is an io.Reader implemented by a function.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// Linter checks Gemini text with the rules enabled by a Config.
+type Linter struct {
+	cfg   Config
+	rules []RuleInfo
+}
+
+// New returns a Linter that checks text with the rules enabled by the Config.
+// It returns an ErrUnknownRule error if the Config names a rule that is not in
+// the registry.
+func New(cfg Config) (*Linter, error) {
+	l := &Linter{cfg: cfg}
+	all := Rules()
+
+	for name := range cfg.Rules {
+		if !hasRule(all, name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRule, name)
+		}
+	}
+
+	for _, info := range all {
+		enabled, ok := cfg.Rules[info.Name]
+		if !ok {
+			enabled = info.Default
+		}
+
+		if enabled {
+			l.rules = append(l.rules, info)
+		}
+	}
+
+	return l, nil
+}
+
+// hasRule returns whether the named rule is in the list of rules.
+func hasRule(rules []RuleInfo, name string) bool {
+	for _, info := range rules {
+		if info.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lint checks the Gemini text read from r and returns the problems found in
+// order of their line numbers.  The name of the file is used in the
+// diagnostics.  Lines that are too long to fit in the Scanner's buffer are
+// truncated.
+func (l *Linter) Lint(file string, r io.Reader) ([]Diagnostic, error) {
+	c := &Context{File: file, Config: l.cfg}
+	rules := make([]Rule, len(l.rules))
+
+	for i, info := range l.rules {
+		rules[i] = info.New(l.cfg)
+	}
+
+	s := gmitxt.NewScanner(c.read(r))
+	s.LongLines(gmitxt.LongLineTruncate)
+
+	for s.Scan() {
+		c.bytes = s.Bytes()
+
+		for i, rule := range rules {
+			c.rule = l.rules[i].Name
+			rule.Check(c, s.Line())
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("problem scanning %s: %w", file, err)
+	}
+
+	c.bytes = nil
+
+	for i, rule := range rules {
+		if ender, ok := rule.(Ender); ok {
+			c.rule = l.rules[i].Name
+			ender.End(c)
+		}
+	}
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		if c.diags[i].Line != c.diags[j].Line {
+			return c.diags[i].Line < c.diags[j].Line
+		}
+
+		return c.diags[i].Col < c.diags[j].Col
+	})
+
+	return c.diags, nil
+}
+
+// Apply applies the fixes of the diagnostics to the text and returns the fixed
+// text with the number of diagnostics that were fixed.  The fixes are applied
+// in order of their offsets.  A fix that overlaps a fix that was applied is
+// skipped, so it can be applied after the text is checked again.
+func Apply(text []byte, diags []Diagnostic) ([]byte, int) {
+	fixes := make([][]Edit, 0, len(diags))
+
+	for _, d := range diags {
+		if len(d.Fix) != 0 {
+			fix := append([]Edit(nil), d.Fix...)
+			sort.Slice(fix, func(i, j int) bool {
+				return fix[i].Start < fix[j].Start
+			})
+			fixes = append(fixes, fix)
+		}
+	}
+
+	sort.SliceStable(fixes, func(i, j int) bool {
+		return fixes[i][0].Start < fixes[j][0].Start
+	})
+
+	var (
+		out   []byte
+		pos   int64       // offset of the text copied to out so far
+		prev  = int64(-1) // start of the last edit applied
+		fixed int
+	)
+
+	for _, fix := range fixes {
+		if !fits(fix, pos, prev, int64(len(text))) {
+			continue
+		}
+
+		for _, e := range fix {
+			out = append(out, text[pos:e.Start]...)
+			out = append(out, e.New...)
+			pos, prev = e.End, e.Start
+		}
+
+		fixed++
+	}
+
+	return append(out, text[pos:]...), fixed
+}
+
+// fits reports whether the sorted edits of a fix are in the text and do not
+// overlap each other or the edits applied before them, which end at pos and
+// the last of which starts at prev.  Two edits at the same offset overlap, as
+// the order of their new text is not known.
+func fits(fix []Edit, pos, prev, size int64) bool {
+	for _, e := range fix {
+		if e.Start < pos || e.Start <= prev || e.End < e.Start ||
+			e.End > size {
+			return false
+		}
+
+		pos, prev = e.End, e.Start
+	}
+
+	return true
+}
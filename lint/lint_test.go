@@ -0,0 +1,366 @@
+package lint_test
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/lint"
+)
+
+const example = "../testdata/example.gmi"
+
+func TestLint(t *testing.T) {
+	f, err := os.Open(example)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", example, err)
+	}
+	defer f.Close()
+
+	l, err := lint.New(lint.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diags, err := l.Lint("example.gmi", f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectDiagnostics(t, diags, []string{
+		"example.gmi:1:25: trailing-whitespace: trailing whitespace",
+		"example.gmi:2:1: multiple-head1: more than one level 1 heading, the first is on line 1", // nolint: lll
+		"example.gmi:3:1: empty-heading: heading has no text",
+		"example.gmi:3:1: multiple-head1: more than one level 1 heading, the first is on line 1", // nolint: lll
+		"example.gmi:4:1: empty-heading: heading has no text",
+		"example.gmi:4:1: multiple-head1: more than one level 1 heading, the first is on line 1", // nolint: lll
+		"example.gmi:4:2: trailing-whitespace: trailing whitespace",
+		"example.gmi:6:13: trailing-whitespace: trailing whitespace",
+		"example.gmi:7:1: empty-heading: heading has no text",
+		"example.gmi:8:1: empty-heading: heading has no text",
+		"example.gmi:8:3: trailing-whitespace: trailing whitespace",
+		"example.gmi:10:14: trailing-whitespace: trailing whitespace",
+		"example.gmi:11:1: empty-heading: heading has no text",
+		"example.gmi:11:4: trailing-whitespace: trailing whitespace",
+		"example.gmi:12:1: empty-heading: heading has no text",
+		"example.gmi:12:4: trailing-whitespace: trailing whitespace",
+		"example.gmi:15:44: trailing-whitespace: trailing whitespace",
+		"example.gmi:18:1: broken-list: * without a space is text, not a list item", // nolint: lll
+		"example.gmi:19:1: broken-list: * without a space is text, not a list item", // nolint: lll
+		"example.gmi:26:1: link-no-text: link has no descriptive text",
+		"example.gmi:27:1: link-no-text: link has no descriptive text",
+		"example.gmi:27:24: trailing-whitespace: trailing whitespace",
+		"example.gmi:29:36: trailing-whitespace: trailing whitespace",
+		"example.gmi:30:6: trailing-whitespace: trailing whitespace",
+		"example.gmi:37:1: pre-no-alt: preformatted text has no alt text",
+	})
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		input    string
+		expected []string
+	}{
+		{"heading-skip", "## A\n# B\n### C\n## D\n### E\n", []string{
+			"test.gmi:3:1: heading-skip: heading level skips from # to ###",
+		}},
+		{"image-no-alt", "=> a.png\n=> b.JPG?x=1\n=> c.gif C\n=> d\n", []string{
+			"test.gmi:1:1: image-no-alt: link to an image has no alt text",
+			"test.gmi:2:1: image-no-alt: link to an image has no alt text",
+		}},
+		{"link-no-text", "=> a.png\n=> b.gmi \n=> c.gmi C\n", []string{
+			"test.gmi:2:1: link-no-text: link has no descriptive text",
+		}},
+		{"long-line", "```\n" + strings.Repeat("é", 81) + "\n" +
+			strings.Repeat("é", 80) + "\n```\n" + strings.Repeat("a", 81),
+			[]string{
+				"test.gmi:2:161: long-line: preformatted line is 81 " +
+					"characters long, more than 80",
+			}},
+		{"unclosed-pre", "```a\n```\n```b\ncode\n", []string{
+			"test.gmi:3:1: unclosed-pre: preformatted text is not closed " +
+				"with ```",
+		}},
+		{"trailing-whitespace", "* \n*  \n```\n \n```\n", []string{
+			"test.gmi:2:3: trailing-whitespace: trailing whitespace",
+		}},
+	}
+
+	for _, test := range tests {
+		cfg := lint.Config{Rules: map[string]bool{}}
+		for _, info := range lint.Rules() {
+			cfg.Rules[info.Name] = info.Name == test.rule
+		}
+
+		l, err := lint.New(cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		diags, err := l.Lint("test.gmi", strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		t.Logf("checking rule: %s", test.rule)
+		expectDiagnostics(t, diags, test.expected)
+	}
+
+	t.Log("checking with a maximum line length")
+
+	l, err := lint.New(lint.Config{MaxLineLength: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diags, err := l.Lint("test.gmi", strings.NewReader("```a\nabcd\n```"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectDiagnostics(t, diags, []string{
+		"test.gmi:2:4: long-line: preformatted line is 4 characters long, " +
+			"more than 3",
+	})
+}
+
+func TestFix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		fixed    int
+	}{
+		{
+			"# A\n# B  \n*x\n**y**\n* \n```\ncode",
+			"# A\n## B\n* x\n**y**\n* \n```\ncode\n```\n",
+			4,
+		},
+		{"```a\ncode\n", "```a\ncode\n```\n", 1},
+		{"```", "```\n```\n", 1},
+		{"\xEF\xBB\xBF# A\r\n# B \r\n", "\xEF\xBB\xBF# A\r\n## B\r\n", 2},
+	}
+
+	l, err := lint.New(lint.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, test := range tests {
+		t.Logf("checking fixes of: %q", test.input)
+
+		diags, err := l.Lint("test.gmi", strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		out, fixed := lint.Apply([]byte(test.input), diags)
+		if string(out) != test.expected {
+			t.Errorf("Expected text %q, got: %q", test.expected, out)
+		}
+
+		if fixed != test.fixed {
+			t.Errorf("Expected %d fixes, got: %d", test.fixed, fixed)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	insert := func(at int64, s string) lint.Diagnostic {
+		return lint.Diagnostic{Fix: []lint.Edit{{Start: at, End: at, New: s}}}
+	}
+
+	diags := []lint.Diagnostic{
+		{Message: "no fix"},
+		insert(6, "b"),
+		insert(2, "a"),
+		insert(6, "c"),                          // inside the E and F fix
+		{Fix: []lint.Edit{{Start: 3, End: 5}}},  // deletes 34
+		insert(4, "d"),                          // in the deleted range
+		{Fix: []lint.Edit{{Start: 9, End: 12}}}, // past the end
+		{Fix: []lint.Edit{{Start: 8, End: 7}}},  // ends before it starts
+		{Fix: []lint.Edit{ // edits out of order
+			{Start: 7, End: 8, New: "F"},
+			{Start: 5, End: 5, New: "E"},
+		}},
+	}
+
+	out, fixed := lint.Apply([]byte("01234567"), diags)
+	if string(out) != "01a2E56F" {
+		t.Errorf("Expected text %q, got: %q", "01a2E56F", out)
+	}
+
+	if fixed != 3 {
+		t.Errorf("Expected %d fixes, got: %d", 3, fixed)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := lint.New(lint.Config{Rules: map[string]bool{"nope": true}})
+	if !errors.Is(err, lint.ErrUnknownRule) {
+		t.Errorf("Expected error `%v`, got: %v", lint.ErrUnknownRule, err)
+	}
+}
+
+func TestLintError(t *testing.T) {
+	l, err := lint.New(lint.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = l.Lint("test.gmi", errReader{})
+	if !errors.Is(err, errRead) {
+		t.Errorf("Expected error `%v`, got: %v", errRead, err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	cfg, err := lint.ReadConfig(strings.NewReader(
+		`{"rules": {"link-no-text": false}, "maxLineLength": 100}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if enabled, ok := cfg.Rules["link-no-text"]; !ok || enabled {
+		t.Errorf("Expected link-no-text to be disabled, got: %v", cfg.Rules)
+	}
+
+	if cfg.MaxLineLength != 100 {
+		t.Errorf("Expected maximum line length 100, got: %d",
+			cfg.MaxLineLength)
+	}
+
+	_, err = lint.ReadConfig(strings.NewReader(`{"rule": {}}`))
+	if err == nil {
+		t.Error("Expected error for unknown field, got nil")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rules := lint.Rules()
+	if len(rules) == 0 {
+		t.Fatal("Expected built-in rules in the registry")
+	}
+
+	for i := 1; i < len(rules); i++ {
+		if rules[i-1].Name >= rules[i].Name {
+			t.Errorf("Expected rules sorted by name, got %s before %s",
+				rules[i-1].Name, rules[i].Name)
+		}
+	}
+
+	lint.Register(lint.RuleInfo{
+		Name: "test-no-quotes",
+		Doc:  "quotes are not allowed",
+		New:  func(lint.Config) lint.Rule { return noQuotes{} },
+	})
+
+	l, err := lint.New(lint.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diags, err := l.Lint("test.gmi", strings.NewReader("> Quote"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectDiagnostics(t, diags, nil)
+
+	l, err = lint.New(lint.Config{Rules: map[string]bool{
+		"test-no-quotes": true,
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diags, err = l.Lint("test.gmi", strings.NewReader("> Quote"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectDiagnostics(t, diags, []string{
+		"test.gmi:1:1: test-no-quotes: quote: Quote",
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Register to panic for a duplicate rule")
+		}
+	}()
+
+	lint.Register(lint.RuleInfo{Name: "test-no-quotes"})
+}
+
+func TestContextSize(t *testing.T) {
+	lint.Register(lint.RuleInfo{
+		Name: "test-size",
+		Doc:  "reports the size of the text",
+		New:  func(lint.Config) lint.Rule { return size{} },
+	})
+
+	l, err := lint.New(lint.Config{Rules: map[string]bool{"test-size": true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diags, err := l.Lint("test.gmi", strings.NewReader("# A\nText\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectDiagnostics(t, diags, []string{
+		"test.gmi:2:1: test-size: 9 bytes in the text",
+	})
+}
+
+// size is a rule that reports the size of the text.
+type size struct{}
+
+func (size) Check(*lint.Context, gmitxt.Line) {}
+
+func (size) End(c *lint.Context) {
+	c.Report(2, 1, strconv.FormatInt(c.Size(), 10)+" bytes in the text")
+}
+
+// noQuotes is a rule that reports quotes.
+type noQuotes struct{}
+
+func (noQuotes) Check(c *lint.Context, line gmitxt.Line) {
+	if line.Type == gmitxt.Quote {
+		c.Report(line.Num, 1, "quote:"+string(line.Text))
+	}
+}
+
+var errRead = errors.New("read error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errRead
+}
+
+func expectDiagnostics(
+	t *testing.T,
+	diags []lint.Diagnostic,
+	expected []string,
+) {
+	t.Helper()
+
+	if len(diags) != len(expected) {
+		t.Errorf("Expected %d diagnostics, got %d: %v",
+			len(expected), len(diags), diags)
+
+		return
+	}
+
+	for i, d := range diags {
+		if d.String() != expected[i] {
+			t.Errorf("Expected diagnostic `%s`, got: `%s`", expected[i], d)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+func init() {
+	for _, info := range []RuleInfo{
+		{
+			Name:    "heading-skip",
+			Doc:     "heading level skips a level, such as from # to ###",
+			Default: true,
+			New:     func(Config) Rule { return &headingSkip{} },
+		},
+		{
+			Name:    "multiple-head1",
+			Doc:     "more than one level 1 heading",
+			Default: true,
+			New:     func(Config) Rule { return &multipleHead1{} },
+		},
+		{
+			Name:    "empty-heading",
+			Doc:     "heading has no text",
+			Default: true,
+			New:     func(Config) Rule { return emptyHeading{} },
+		},
+		{
+			Name:    "link-no-text",
+			Doc:     "link has no descriptive text",
+			Default: true,
+			New:     func(Config) Rule { return linkNoText{} },
+		},
+		{
+			Name:    "image-no-alt",
+			Doc:     "link to an image has no alt text",
+			Default: true,
+			New:     func(Config) Rule { return imageNoAlt{} },
+		},
+		{
+			Name:    "broken-list",
+			Doc:     "line starts with * without a space, so it is not a list",
+			Default: true,
+			New:     func(Config) Rule { return brokenList{} },
+		},
+		{
+			Name:    "trailing-whitespace",
+			Doc:     "trailing whitespace outside of preformatted text",
+			Default: true,
+			New:     func(Config) Rule { return trailingWhitespace{} },
+		},
+		{
+			Name:    "long-line",
+			Doc:     "preformatted line is longer than the maximum length",
+			Default: true,
+			New:     newLongLine,
+		},
+		{
+			Name:    "unclosed-pre",
+			Doc:     "preformatted text is not closed with ```",
+			Default: true,
+			New:     func(Config) Rule { return &unclosedPre{} },
+		},
+		{
+			Name:    "pre-no-alt",
+			Doc:     "preformatted text has no alt text",
+			Default: true,
+			New:     func(Config) Rule { return preNoAlt{} },
+		},
+	} {
+		Register(info)
+	}
+}
+
+// headingLevel returns the level of a heading line type, or 0 if it is not a
+// heading.
+func headingLevel(typ gmitxt.LineType) int {
+	switch typ {
+	case gmitxt.Head1:
+		return 1
+	case gmitxt.Head2:
+		return 2
+	case gmitxt.Head3:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// headingSkip reports headings whose level is more than one level below the
+// previous heading.
+type headingSkip struct {
+	level int // level of the previous heading
+}
+
+func (r *headingSkip) Check(c *Context, line gmitxt.Line) {
+	level := headingLevel(line.Type)
+	if level == 0 {
+		return
+	}
+
+	if r.level != 0 && level > r.level+1 {
+		c.Report(line.Num, 1, fmt.Sprintf(
+			"heading level skips from %s to %s",
+			strings.Repeat("#", r.level), strings.Repeat("#", level)))
+	}
+
+	r.level = level
+}
+
+// multipleHead1 reports each level 1 heading after the first.
+type multipleHead1 struct {
+	first uint32 // line number of the first level 1 heading
+}
+
+func (r *multipleHead1) Check(c *Context, line gmitxt.Line) {
+	if line.Type != gmitxt.Head1 {
+		return
+	}
+
+	if r.first == 0 {
+		r.first = line.Num
+
+		return
+	}
+
+	// The fix makes the heading a level 2 heading.
+	c.ReportFix(line.Num, 1, fmt.Sprintf(
+		"more than one level 1 heading, the first is on line %d", r.first),
+		Edit{Start: line.Offset, End: line.Offset, New: "#"})
+}
+
+// emptyHeading reports headings without text.
+type emptyHeading struct{}
+
+func (emptyHeading) Check(c *Context, line gmitxt.Line) {
+	if headingLevel(line.Type) != 0 && len(trimSpace(line.Text)) == 0 {
+		c.Report(line.Num, 1, "heading has no text")
+	}
+}
+
+// linkNoText reports links without descriptive text, except for images which
+// are reported by imageNoAlt.
+type linkNoText struct{}
+
+func (linkNoText) Check(c *Context, line gmitxt.Line) {
+	if line.Type == gmitxt.Link && len(trimSpace(line.Text)) == 0 &&
+		!isImage(line.URL) {
+		c.Report(line.Num, 1, "link has no descriptive text")
+	}
+}
+
+// imageNoAlt reports links to images without alt text.
+type imageNoAlt struct{}
+
+func (imageNoAlt) Check(c *Context, line gmitxt.Line) {
+	if line.Type == gmitxt.Link && len(trimSpace(line.Text)) == 0 &&
+		isImage(line.URL) {
+		c.Report(line.Num, 1, "link to an image has no alt text")
+	}
+}
+
+// imageExts are the file extensions of images.
+var imageExts = map[string]bool{
+	".apng": true,
+	".avif": true,
+	".bmp":  true,
+	".gif":  true,
+	".ico":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+	".svg":  true,
+	".webp": true,
+}
+
+// isImage returns whether the URL links to an image by its file extension.
+func isImage(url []byte) bool {
+	u := string(url)
+
+	if i := strings.IndexAny(u, "?#"); i != -1 {
+		u = u[:i]
+	}
+
+	return imageExts[strings.ToLower(path.Ext(u))]
+}
+
+// brokenList reports text lines that start with * without a space after it.
+// They look like list items, but are not.  The fix inserts the space, unless
+// the * is followed by another *, as the text is more likely emphasis.
+type brokenList struct{}
+
+func (brokenList) Check(c *Context, line gmitxt.Line) {
+	b := c.Bytes()
+	if line.Type != gmitxt.Text || !bytes.HasPrefix(b, []byte("*")) {
+		return
+	}
+
+	const msg = "* without a space is text, not a list item"
+
+	if len(b) == 1 || b[1] == '*' {
+		c.Report(line.Num, 1, msg)
+
+		return
+	}
+
+	c.ReportFix(line.Num, 1, msg,
+		Edit{Start: line.Offset + 1, End: line.Offset + 1, New: " "})
+}
+
+// trailingWhitespace reports whitespace at the end of lines outside of
+// preformatted text.  The space of an empty list item is not reported, as it
+// is needed for the line to be a list item.
+type trailingWhitespace struct{}
+
+func (trailingWhitespace) Check(c *Context, line gmitxt.Line) {
+	if line.Type == gmitxt.PreBody || line.Flags != 0 {
+		return
+	}
+
+	b := c.Bytes()
+	end := len(trimRightSpace(b))
+
+	if line.Type == gmitxt.List && end < len("* ") {
+		end = len("* ")
+	}
+
+	if end < len(b) {
+		c.ReportFix(line.Num, end+1, "trailing whitespace", Edit{
+			Start: line.Offset + int64(end),
+			End:   line.Offset + int64(len(b)),
+		})
+	}
+}
+
+// longLine reports lines of preformatted text that are longer than the
+// maximum length.  Other lines are not reported, as clients wrap them to fit.
+type longLine struct {
+	max int
+}
+
+func newLongLine(cfg Config) Rule {
+	if cfg.MaxLineLength == 0 {
+		return longLine{max: DefaultMaxLineLength}
+	}
+
+	return longLine{max: cfg.MaxLineLength}
+}
+
+func (r longLine) Check(c *Context, line gmitxt.Line) {
+	if line.Type != gmitxt.PreBody {
+		return
+	}
+
+	n := utf8.RuneCount(line.Text)
+	if n <= r.max {
+		return
+	}
+
+	// Find the column of the first character past the maximum length.
+	col := 0
+	for i := 0; i < r.max; i++ {
+		_, size := utf8.DecodeRune(line.Text[col:])
+		col += size
+	}
+
+	c.Report(line.Num, col+1, fmt.Sprintf(
+		"preformatted line is %d characters long, more than %d", n, r.max))
+}
+
+// unclosedPre reports preformatted text that is not closed by the end of the
+// text.
+type unclosedPre struct {
+	start uint32 // line number of the open preformatted text
+}
+
+func (r *unclosedPre) Check(_ *Context, line gmitxt.Line) {
+	switch line.Type {
+	case gmitxt.PreStart:
+		r.start = line.Num
+	case gmitxt.PreEnd:
+		r.start = 0
+	case gmitxt.Head1, gmitxt.Head2, gmitxt.Head3, gmitxt.Text, gmitxt.Link,
+		gmitxt.PreBody, gmitxt.List, gmitxt.Quote:
+	}
+}
+
+func (r *unclosedPre) End(c *Context) {
+	if r.start == 0 {
+		return
+	}
+
+	// The fix closes the preformatted text at the end of the text.
+	fence := "```\n"
+	if c.size != 0 && c.last != '\n' {
+		fence = "\n" + fence
+	}
+
+	c.ReportFix(r.start, 1, "preformatted text is not closed with ```",
+		Edit{Start: c.size, End: c.size, New: fence})
+}
+
+// preNoAlt reports preformatted text without alt text.
+type preNoAlt struct{}
+
+func (preNoAlt) Check(c *Context, line gmitxt.Line) {
+	if line.Type == gmitxt.PreStart && len(trimSpace(line.Text)) == 0 {
+		c.Report(line.Num, 1, "preformatted text has no alt text")
+	}
+}
+
+// trimSpace trims the whitespace around the text, where whitespace is either
+// a space or a tab.
+func trimSpace(b []byte) []byte {
+	return bytes.Trim(b, " \t")
+}
+
+// trimRightSpace trims the whitespace at the end of the text, where whitespace
+// is either a space or a tab.
+func trimRightSpace(b []byte) []byte {
+	return bytes.TrimRight(b, " \t")
+}
@@ -9,6 +9,15 @@ import (
 	"strings"
 )
 
+// Build builds all packages and commands of the project.
+func Build() error {
+	if err := run("go", "build", "./..."); err != nil {
+		return fmt.Errorf("problem building project: %w", err)
+	}
+
+	return nil
+}
+
 // Lint runs golangci-lint on the project.
 func Lint() error {
 	if err := run("golangci-lint", "run"); err != nil {
@@ -0,0 +1,243 @@
+// Package man renders Gemini text as a manual page in the man(7) format of
+// troff, to be read with man or formatted with groff.
+//
+// Level 1 headings become sections (.SH), level 2 headings become subsections
+// (.SS) and level 3 headings become bold paragraphs.  List items become
+// bulleted paragraphs (.IP), quotes are indented (.RS and .RE), preformatted
+// text is not filled (.nf and .fi) and links become URLs (.UR and .UE).
+package man
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+// Options are the options of a Writer.
+type Options struct {
+	// Title is the title of the manual page, such as "GMITXT".  If it is not
+	// empty, the page starts with a title line (.TH) with the title and the
+	// other options.
+	Title string
+	// Section is the section of the manual, such as "1" for commands.
+	Section string
+	// Date is the date of the last change to the page, such as "2021-03-17".
+	Date string
+	// Source is the source of the page, such as the name and version of the
+	// project.
+	Source string
+	// Manual is the title of the manual, such as "General Commands Manual".
+	Manual string
+}
+
+// Writer writes lines of Gemini text as a manual page.
+//
+// As returned by NewWriter, a Writer writes lines with a buffer.  The client
+// should call the Flush method to end an open quote, and to guarantee all data
+// has been forwarded to the underlying io.Writer.  Any errors that occurred
+// should be checked by calling the Error method.
+type Writer struct {
+	w     *bufio.Writer
+	quote bool // whether a quote is open
+	pre   bool // whether preformatted text is open
+}
+
+// NewWriter returns a new Writer that writes to w with the options.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	mw := &Writer{w: bufio.NewWriter(w)}
+
+	if opts.Title != "" {
+		mw.request(".TH", opts.Title, opts.Section, opts.Date, opts.Source,
+			opts.Manual)
+	}
+
+	return mw
+}
+
+// Write writes a single line of Gemini text as a manual page.  Consecutive
+// quote lines are indented together.  If there was an error, it is returned
+// and can also be retrieved by the Error method.
+func (w *Writer) Write(line gmitxt.Line) error {
+	text := string(line.Text)
+	if line.Type != gmitxt.PreBody {
+		text = strings.TrimSpace(text)
+	}
+
+	if line.Type != gmitxt.Quote {
+		w.endQuote()
+	}
+
+	switch line.Type {
+	case gmitxt.Head1:
+		w.heading(".SH", text)
+	case gmitxt.Head2:
+		w.heading(".SS", text)
+	case gmitxt.Head3:
+		w.heading(".B", text)
+	case gmitxt.Text:
+		if text != "" {
+			w.printf(".PP\n")
+			w.textLine(text)
+		}
+	case gmitxt.Link:
+		w.printf(".PP\n.UR %s\n", escapeURL(string(line.URL)))
+		w.textLine(text)
+		w.printf(".UE\n")
+	case gmitxt.List:
+		w.printf(".IP \\(bu 2\n")
+		w.textLine(text)
+	case gmitxt.Quote:
+		if !w.quote {
+			w.quote = true
+			w.printf(".RS\n")
+		}
+
+		if text != "" {
+			w.printf(".PP\n")
+			w.textLine(text)
+		}
+	case gmitxt.PreStart:
+		w.pre = true
+		w.printf(".PP\n.nf\n")
+	case gmitxt.PreBody:
+		w.printf("%s\n", escapeLine(text))
+	case gmitxt.PreEnd:
+		w.endPre()
+	}
+
+	return w.Error()
+}
+
+// heading writes the heading with the request, which starts a paragraph for
+// a bold heading.  Empty headings are not written.
+func (w *Writer) heading(name, text string) {
+	if text == "" {
+		return
+	}
+
+	if name == ".B" {
+		w.printf(".PP\n")
+	}
+
+	w.request(name, text)
+}
+
+// textLine writes the text as a line of text, unless it is empty, as an empty
+// line would be typeset as a blank line.
+func (w *Writer) textLine(text string) {
+	if text != "" {
+		w.printf("%s\n", escapeLine(text))
+	}
+}
+
+// request writes a request with the arguments, which are quoted.
+func (w *Writer) request(name string, args ...string) {
+	w.printf("%s", name)
+
+	for _, arg := range args {
+		w.printf(" \"%s\"", strings.ReplaceAll(Escape(arg), `"`, `\(dq`))
+	}
+
+	w.printf("\n")
+}
+
+// endQuote ends an open quote.
+func (w *Writer) endQuote() {
+	if w.quote {
+		w.quote = false
+		w.printf(".RE\n")
+	}
+}
+
+// endPre ends open preformatted text.
+func (w *Writer) endPre() {
+	if w.pre {
+		w.pre = false
+		w.printf(".fi\n")
+	}
+}
+
+// printf writes the formatted text.  The errors are checked by Error.
+func (w *Writer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(w.w, format, args...)
+}
+
+// escaper escapes the characters of troff that are not typeset as they are.
+var escaper = strings.NewReplacer(`\`, `\e`, `-`, `\-`)
+
+// Escape escapes the backslashes and hyphens in the text, so it is typeset as
+// it is.  Hyphens are escaped so they are typeset as minus signs, which can
+// be copied in command line options.
+func Escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// escapeLine escapes a line of text, which must not start with a dot or a
+// quote as it would be read as a request.
+func escapeLine(text string) string {
+	text = Escape(text)
+
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+
+	return text
+}
+
+// escapeURL escapes the backslashes in the URL of a link.
+func escapeURL(url string) string {
+	return strings.ReplaceAll(url, `\`, `\e`)
+}
+
+// Flush ends an open quote and writes any buffered data to the underlying
+// io.Writer.  Preformatted text that is not closed is ended too.  To check if
+// an error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.endQuote()
+	w.endPre()
+	w.w.Flush() // nolint: errcheck // checked by Error
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+
+	return err // nolint: wrapcheck // error from the underlying io.Writer
+}
+
+// Render reads Gemini text from src and writes it to dst as a manual page.
+func Render(dst io.Writer, src io.Reader, opts Options) error {
+	return RenderContext(context.Background(), dst, src, opts)
+}
+
+// RenderContext is like Render, but stops reading when the context is done,
+// and returns the error of the context.
+func RenderContext(
+	ctx context.Context,
+	dst io.Writer,
+	src io.Reader,
+	opts Options,
+) error {
+	s := gmitxt.NewScanner(src)
+	w := NewWriter(dst, opts)
+
+	for s.ScanContext(ctx) {
+		w.Write(s.Line()) // nolint: errcheck // checked by Error
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("problem writing manual page: %w", err)
+	}
+
+	return nil
+}
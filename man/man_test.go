@@ -0,0 +1,129 @@
+package man_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/man"
+)
+
+func TestRender(t *testing.T) {
+	opts := man.Options{
+		Title:   "EXAMPLE",
+		Section: "7",
+		Date:    "2021-03-17",
+		Source:  "gmitxt",
+		Manual:  `Gemini "Text"`,
+	}
+	tests := []struct {
+		input  string
+		golden string
+		opts   man.Options
+	}{
+		{"../testdata/example.gmi", "example.man", opts},
+		{"testdata/escape.gmi", "escape.man", opts},
+	}
+
+	for _, test := range tests {
+		t.Logf("rendering %s as %s", test.input, test.golden)
+
+		f, err := os.Open(test.input)
+		if err != nil {
+			t.Fatalf("could not open %s: %v", test.input, err)
+		}
+
+		golden := filepath.Join("testdata", test.golden)
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("could not read file %s: %v", golden, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = man.Render(&buf, f, test.opts)
+		f.Close()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("Expected %s to be rendered as %s, got:\n%s",
+				test.input, golden, buf.Bytes())
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	expected := `\e \-\-flag`
+	if actual := man.Escape(`\ --flag`); actual != expected {
+		t.Errorf("Expected %q, got: %q", expected, actual)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := man.NewWriter(&buf, man.Options{})
+	w.Write(gmitxt.Line{ // nolint: errcheck // checked by Error
+		Type: gmitxt.Quote, Text: []byte("Quote"),
+	})
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := ".RS\n.PP\nQuote\n.RE\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, buf.String())
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	err := man.Render(&strings.Builder{}, errReader{}, man.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+
+	err = man.Render(errWriter{}, strings.NewReader("text\n"),
+		man.Options{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("Expected write error, got: %v", err)
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := man.RenderContext(ctx, &strings.Builder{},
+		strings.NewReader("# Title\n"), man.Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got: %v", err)
+	}
+}
+
+var errTest = errors.New("test error")
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errTest
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTest
+}
@@ -0,0 +1,237 @@
+package gmitxt
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SummaryLength is the maximum length of the summary of a Meta in runes, not
+// including the ellipsis added when it is truncated.
+const SummaryLength = 200
+
+// Meta is the metadata of a page of Gemini text, as used by site builders and
+// feed generators.
+type Meta struct {
+	// Title is the text of the first level 1 heading, or of the first heading
+	// or the first line that is not empty when there is none.
+	Title string
+	// Summary is the first paragraph of text, which is consecutive text lines
+	// joined with single spaces.  It is truncated to SummaryLength runes on a
+	// word boundary, with an ellipsis.
+	Summary string
+	// Date is the first date in the YYYY-MM-DD format in the file name, the
+	// first heading or the first line, or the zero time if there is none.
+	Date time.Time
+	// Words is the number of words in the text, not including URLs and
+	// preformatted text with its alt text.
+	Words int
+	// Lang is the language of the text, such as "fr" for a file named
+	// "index.fr.gmi" or for the lang parameter "fr" of a Gemini response.
+	// Without a language in the lang parameter or the file name, it is guessed
+	// from the script of the letters of the text, such as "ja" for Japanese
+	// kana.  It is empty for text in the Latin script, whose language cannot
+	// be guessed from its script alone.
+	Lang string
+}
+
+// ExtractMeta reads Gemini text from r and returns its metadata in a single
+// pass.  If r has a Name method, such as an *os.File, the date and language
+// are taken from the name first.  Reading stops at the first error, and the
+// metadata of the text read until then is returned.
+func ExtractMeta(r io.Reader) Meta {
+	return ExtractMetaLang(r, "")
+}
+
+// ExtractMetaLang is like ExtractMeta, with the lang parameter of the MIME
+// type of the text, such as the Lang of a Gemini response.  Its first
+// language, such as "en" for "en,fr", is the language of the text.
+func ExtractMetaLang(r io.Reader, lang string) Meta {
+	var (
+		m       Meta
+		heading string // text of the first heading
+		first   string // text of the first line that is not empty
+		para    []string
+		scripts = map[string]int{} // number of letters of each language
+	)
+
+	if named, ok := r.(interface{ Name() string }); ok {
+		name := filepath.Base(named.Name())
+		m.Date = findDate(name)
+		m.Lang = fileLang(name)
+	}
+
+	if lang = strings.TrimSpace(strings.Split(lang, ",")[0]); lang != "" {
+		m.Lang = lang
+	}
+
+	s := NewScanner(r)
+	inPara := true // whether the summary paragraph is not ended
+
+	for s.Scan() {
+		line := s.Line()
+		text := strings.TrimSpace(string(line.Text))
+
+		switch line.Type {
+		case Head1, Head2, Head3:
+			if m.Title == "" && line.Type == Head1 {
+				m.Title = text
+			}
+
+			if heading == "" {
+				heading = text
+			}
+		case Text:
+			if text != "" && inPara {
+				para = append(para, strings.Fields(text)...)
+			}
+		case Link, List, Quote, PreStart, PreBody, PreEnd:
+		}
+
+		if line.Type != Text || (text == "" && len(para) != 0) {
+			inPara = len(para) == 0
+		}
+
+		if line.Type == PreStart || line.Type == PreBody ||
+			line.Type == PreEnd {
+			continue
+		}
+
+		if first == "" {
+			first = text
+		}
+
+		m.Words += len(strings.Fields(text))
+
+		for _, r := range text {
+			if unicode.IsLetter(r) {
+				scripts[script(r)]++
+			}
+		}
+	}
+
+	if m.Title == "" {
+		m.Title = heading
+	}
+
+	if m.Title == "" {
+		m.Title = first
+	}
+
+	m.Summary = truncate(strings.Join(para, " "), SummaryLength)
+
+	if m.Date.IsZero() {
+		m.Date = findDate(heading)
+	}
+
+	if m.Date.IsZero() {
+		m.Date = findDate(first)
+	}
+
+	if m.Lang == "" {
+		m.Lang = guessLang(scripts)
+	}
+
+	return m
+}
+
+// dateRegexp matches a date in the YYYY-MM-DD format.
+var dateRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// findDate returns the first valid date in the YYYY-MM-DD format in the text,
+// or the zero time if there is none.
+func findDate(text string) time.Time {
+	for _, match := range dateRegexp.FindAllString(text, -1) {
+		if date, err := time.Parse("2006-01-02", match); err == nil {
+			return date
+		}
+	}
+
+	return time.Time{}
+}
+
+// langRegexp matches a language code, such as "fr" or "pt-BR".
+var langRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// fileLang returns the language code before the extension of the file name,
+// such as "fr" for "index.fr.gmi", or an empty string if there is none.
+func fileLang(name string) string {
+	parts := strings.Split(name, ".")
+	if len(parts) < 3 || !langRegexp.MatchString(parts[len(parts)-2]) {
+		return ""
+	}
+
+	return parts[len(parts)-2]
+}
+
+// scriptLangs are the languages guessed from the script of letters, in the
+// order they are checked.  Letters of other scripts have no language.
+var scriptLangs = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Latin, ""},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// script returns the language guessed from the script of the letter.
+func script(r rune) string {
+	for _, s := range scriptLangs {
+		if unicode.Is(s.script, r) {
+			return s.lang
+		}
+	}
+
+	return ""
+}
+
+// guessLang returns the language with the most letters.  Han letters count as
+// Japanese when there are kana, as Japanese is written with both.
+func guessLang(scripts map[string]int) string {
+	if scripts["ja"] != 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	lang, most := "", scripts[""]
+
+	for _, s := range scriptLangs {
+		if n := scripts[s.lang]; n > most {
+			lang, most = s.lang, n
+		}
+	}
+
+	return lang
+}
+
+// truncate returns the text truncated to n runes on a word boundary, with an
+// ellipsis when it is truncated.  A first word longer than n runes is cut.
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	cut := n
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+
+	if cut == 0 {
+		cut = n
+	}
+
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
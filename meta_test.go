@@ -0,0 +1,164 @@
+package gmitxt_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/internal/testutil"
+)
+
+func TestExtractMeta(t *testing.T) {
+	date := time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text     string
+		expected gmitxt.Meta
+	}{
+		{"", gmitxt.Meta{}},
+		{"## Intro\n" +
+			"# My  Title \n" +
+			"\n" +
+			"First  paragraph\n" +
+			"on two lines.\n" +
+			"\n" +
+			"Second paragraph.\n" +
+			"=> gemini://example.org/ A link\n" +
+			"```alt text\n" +
+			"not counted\n" +
+			"```\n",
+			gmitxt.Meta{
+				Title:   "My  Title",
+				Summary: "First paragraph on two lines.",
+				Words:   12,
+			}},
+		{"### 2021-03-17 Release\n* Item\nText\n> Quote\nMore\n",
+			gmitxt.Meta{
+				Title:   "2021-03-17 Release",
+				Summary: "Text",
+				Date:    date,
+				Words:   6,
+			}},
+		{"\n=> /about\nPosted 2021-02-30 or 2021-03-17\n",
+			gmitxt.Meta{
+				Title:   "Posted 2021-02-30 or 2021-03-17",
+				Summary: "Posted 2021-02-30 or 2021-03-17",
+				Date:    date,
+				Words:   4,
+			}},
+		{"# こんにちは世界\n日本語の文章です。\n",
+			gmitxt.Meta{
+				Title:   "こんにちは世界",
+				Summary: "日本語の文章です。",
+				Words:   2,
+				Lang:    "ja",
+			}},
+		{"# Привет\nЭто текст на русском, not English.\n",
+			gmitxt.Meta{
+				Title:   "Привет",
+				Summary: "Это текст на русском, not English.",
+				Words:   7,
+				Lang:    "ru",
+			}},
+		{"Բարեւ\n", gmitxt.Meta{Title: "Բարեւ", Summary: "Բարեւ", Words: 1}},
+		{"# 你好\n這是中文。\n", gmitxt.Meta{
+			Title: "你好", Summary: "這是中文。", Words: 2, Lang: "zh",
+		}},
+	}
+
+	for _, test := range tests {
+		m := gmitxt.ExtractMeta(strings.NewReader(test.text))
+		if m != test.expected {
+			t.Errorf("Expected meta %+v for %q, got: %+v", test.expected,
+				test.text, m)
+		}
+	}
+}
+
+func TestExtractMetaSummary(t *testing.T) {
+	long := strings.Repeat("word ", 50)
+
+	m := gmitxt.ExtractMeta(strings.NewReader(long))
+	if expected := strings.Repeat("word ", 39) + "word…"; m.Summary !=
+		expected {
+		t.Errorf("Expected summary %q, got: %q", expected, m.Summary)
+	}
+
+	m = gmitxt.ExtractMeta(strings.NewReader(strings.Repeat("é", 250)))
+	if expected := strings.Repeat("é", 200) + "…"; m.Summary != expected {
+		t.Errorf("Expected summary %q, got: %q", expected, m.Summary)
+	}
+}
+
+func TestExtractMetaFile(t *testing.T) {
+	dir := testutil.TempDir(t, nil)
+
+	tests := []struct {
+		name string
+		date time.Time
+		lang string
+	}{
+		{"2021-03-17-post.fr.gmi",
+			time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC), "fr"},
+		{"index.pt-BR.gmi", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+			"pt-BR"},
+		{"index.gmi", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"notes.2021.gmi", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), ""},
+	}
+
+	for _, test := range tests {
+		name := filepath.Join(dir, test.name)
+
+		err := ioutil.WriteFile(name, []byte("# 2020-12-01\nBonjour\n"), 0o600)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		m := gmitxt.ExtractMeta(f)
+		f.Close()
+
+		if !m.Date.Equal(test.date) || m.Lang != test.lang {
+			t.Errorf("Expected date %s and lang %q for %s, got: %+v",
+				test.date, test.lang, test.name, m)
+		}
+	}
+}
+
+func TestExtractMetaLang(t *testing.T) {
+	text := "# Привет\nЭто текст.\n"
+
+	for _, test := range []struct {
+		lang     string
+		expected string
+	}{
+		{"", "ru"},
+		{"uk", "uk"},
+		{" en , fr", "en"},
+		{",fr", "ru"},
+	} {
+		m := gmitxt.ExtractMetaLang(strings.NewReader(text), test.lang)
+		if m.Lang != test.expected {
+			t.Errorf("Expected lang %q for %q, got: %q", test.expected,
+				test.lang, m.Lang)
+		}
+	}
+}
+
+func TestExtractMetaErrors(t *testing.T) {
+	r := iotest.TimeoutReader(strings.NewReader("# Heading\nText\n"))
+
+	m := gmitxt.ExtractMeta(r)
+	if m.Title != "Heading" || m.Words != 2 {
+		t.Errorf("Expected meta of the text read, got: %+v", m)
+	}
+}
@@ -0,0 +1,539 @@
+// Package proxy serves Gemini capsules over HTTP, so web visitors can browse
+// them.  The Handler fetches the Gemini URL in the path of a request, such as
+// /proxy/gemini/example.org/blog/, and serves the response.
+//
+// Gemini text is rendered as HTML by the html package as it is read, with its
+// links to gemini URLs rewritten to go through the proxy, and other links made
+// absolute so they go to their server directly.  Gemini status codes are
+// mapped to HTTP ones: input prompts are served as a form, redirects as HTTP
+// redirects and permanent failures as not found.  A response that takes longer
+// than the Timeout of the Handler, or whose request is canceled, is stopped.
+//
+// As the proxy serves content of other servers from its own site, responses
+// have a restrictive Content-Security-Policy, and bodies other than Gemini
+// text, plain text and images are served as attachments.  Servers at
+// loopback, private and link-local addresses, or on other ports than 1965,
+// cannot be fetched unless they are allowed, so the proxy cannot be used to
+// reach the network it runs in.
+//
+//     http.Handle(proxy.Prefix, &proxy.Handler{Allow: []string{"*.org"}})
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt"
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/html"
+)
+
+// Prefix is the path the Handler serves, which is followed by the host and
+// path of the Gemini URL.
+const Prefix = "/proxy/gemini/"
+
+// InputParam is the query parameter of the input sent by the form of an
+// input prompt.  Its value is sent as the query of the Gemini URL.
+const InputParam = "input"
+
+// DefaultMaxSize is the most bytes of a response body a Handler serves when
+// it has no MaxSize.
+const DefaultMaxSize = 4 << 20
+
+// DefaultTimeout is the most time a Handler takes to fetch and serve a
+// response when it has no Timeout.
+const DefaultTimeout = time.Minute
+
+// headLength is the most bytes of the start of a response body read before it
+// is served, to find the title and language of Gemini text, and to report
+// errors of short bodies with an error status.
+const headLength = 16 << 10
+
+// htmlType is the content type of the HTML pages of Gemini text.
+const htmlType = "text/html; charset=utf-8"
+
+// defaultPort is the port of Gemini URLs without one.
+const defaultPort = 1965
+
+// contentSecurityPolicy is the Content-Security-Policy of the responses, which
+// allows no scripts, styles or frames, and only forms and images of the proxy.
+const contentSecurityPolicy = "default-src 'none'; img-src 'self'; " +
+	"form-action 'self'; frame-ancestors 'none'"
+
+// inlineTypes are the MIME types of the bodies served inline, which cannot
+// run scripts.  Other bodies are served as attachments.
+var inlineTypes = map[string]bool{
+	"text/plain": true,
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	// errTooLarge is returned when a response body is larger than the
+	// MaxSize of a Handler.
+	errTooLarge = errors.New("response is too large")
+	// errPrivate is returned when the address of a server is not public and
+	// the Handler does not allow private addresses.
+	errPrivate = errors.New("address is not public")
+)
+
+// Handler serves the Gemini URLs in the paths of requests.
+type Handler struct {
+	// Client fetches the Gemini URLs.  If it is nil, a Client with the
+	// default settings is used, which trusts the certificates of servers on
+	// first use in memory.  Redirects are never followed, as they are served
+	// as HTTP redirects.
+	Client *gemini.Client
+	// Allow is a list of globs, such as *.example.org, of the hosts that can
+	// be fetched.  If it is empty, all hosts can be fetched.
+	Allow []string
+	// Deny is a list of globs of the hosts that cannot be fetched, even if
+	// they are allowed.
+	Deny []string
+	// MaxSize is the most bytes of a response body that is served.  If it is
+	// zero, DefaultMaxSize is used.
+	MaxSize int64
+	// Timeout is the most time to fetch and serve a response, after which
+	// the connection to the server is closed.  If it is zero, DefaultTimeout
+	// is used.
+	Timeout time.Duration
+	// Ports are the ports other than 1965 that can be fetched.
+	Ports []int
+	// AllowPrivate allows fetching servers at loopback, private and
+	// link-local addresses, such as to proxy a capsule on the same host.
+	AllowPrivate bool
+}
+
+// ServeHTTP fetches the Gemini URL in the path of the request and serves the
+// response.  The query of the request is the query of the URL, unless the
+// request has the InputParam.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	u, ok := geminiURL(r)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if !h.allowed(u.Hostname()) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+
+		return
+	}
+
+	if !h.allowedPort(u.Port()) {
+		http.Error(w, "port not allowed", http.StatusForbidden)
+
+		return
+	}
+
+	c := gemini.Client{}
+	if h.Client != nil {
+		c = *h.Client
+	}
+
+	c.MaxRedirects = -1
+
+	if !h.AllowPrivate {
+		c.Control = publicOnly(c.Control)
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	r = r.WithContext(ctx)
+
+	res, err := c.DoContext(ctx, u)
+	if errors.Is(err, errPrivate) {
+		http.Error(w, "address not allowed", http.StatusForbidden)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+	defer res.Body.Close()
+
+	h.serve(w, r, res)
+}
+
+// geminiURL returns the Gemini URL in the path of the request.
+func geminiURL(r *http.Request) (*url.URL, bool) {
+	p := strings.TrimPrefix(r.URL.Path, Prefix)
+	if p == r.URL.Path {
+		return nil, false
+	}
+
+	i := strings.IndexByte(p, '/')
+	if i < 0 {
+		// The path of a host alone is the root of the capsule.
+		p, i = p+"/", len(p)
+	}
+
+	if i == 0 {
+		return nil, false
+	}
+
+	u := &url.URL{Scheme: "gemini", Host: p[:i], Path: p[i:]}
+
+	if input, ok := r.URL.Query()[InputParam]; ok {
+		u.RawQuery = queryEscape(input[0])
+	} else {
+		u.RawQuery = r.URL.RawQuery
+	}
+
+	return u, true
+}
+
+// queryEscape escapes the input as the query of a Gemini URL, where spaces
+// are escaped as %20 rather than +.
+func queryEscape(input string) string {
+	return strings.ReplaceAll(url.QueryEscape(input), "+", "%20")
+}
+
+// allowed returns whether the host can be fetched.
+func (h *Handler) allowed(host string) bool {
+	host = strings.ToLower(host)
+
+	for _, glob := range h.Deny {
+		if ok, _ := path.Match(glob, host); ok {
+			return false
+		}
+	}
+
+	if len(h.Allow) == 0 {
+		return true
+	}
+
+	for _, glob := range h.Allow {
+		if ok, _ := path.Match(glob, host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedPort returns whether the port of a URL, which is empty for the
+// default port, can be fetched.
+func (h *Handler) allowedPort(port string) bool {
+	if port == "" {
+		return true
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	} else if n == defaultPort {
+		return true
+	}
+
+	for _, p := range h.Ports {
+		if p == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// privateNets are the networks of private addresses, which are not public
+// but are not loopback or link-local addresses either.
+var privateNets = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+// mustParseCIDR returns the network of the CIDR notation, which must be
+// valid.
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// publicOnly returns a Control of a gemini.Client that refuses to connect to
+// addresses that are not public with errPrivate, then calls control if it is
+// not nil.
+func publicOnly(
+	control func(network, address string, c syscall.RawConn) error,
+) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("problem with address %s: %w", address, err)
+		}
+
+		if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+			return fmt.Errorf("%w: %s", errPrivate, host)
+		}
+
+		if control == nil {
+			return nil
+		}
+
+		return control(network, address, c)
+	}
+}
+
+// isPublic returns whether the IP address is public, which is when it is not
+// a loopback, private, link-local or unspecified address.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serve serves the Gemini response to the request.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request,
+	res *gemini.Response) {
+	switch res.Status / 10 {
+	case gemini.StatusInput / 10:
+		serveInput(w, res)
+	case gemini.StatusSuccess / 10:
+		h.serveBody(w, r, res)
+	case gemini.StatusRedirect / 10:
+		code := http.StatusFound
+		if res.Status == gemini.StatusPermanentRedirect {
+			code = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, Rewrite(res.URL, res.Meta), code)
+	case gemini.StatusTemporaryFailure / 10:
+		code := http.StatusServiceUnavailable
+		if res.Status == gemini.StatusSlowDown {
+			code = http.StatusTooManyRequests
+		}
+
+		http.Error(w, res.Meta, code)
+	case gemini.StatusPermanentFailure / 10:
+		http.Error(w, res.Meta, http.StatusNotFound)
+	default:
+		http.Error(w, res.Meta, http.StatusForbidden)
+	}
+}
+
+// serveBody serves the body of a successful response as it is read.  Gemini
+// text is rendered as HTML with its links rewritten, plain text and images are
+// served as they are, and other bodies are served as attachments.  An error
+// reading the start of the body is served as an error, and a later one aborts
+// the response, so a partial body is not taken for a whole one.
+func (h *Handler) serveBody(w http.ResponseWriter, r *http.Request,
+	res *gemini.Response) {
+	max := h.MaxSize
+	if max == 0 {
+		max = DefaultMaxSize
+	}
+
+	var (
+		body io.Reader = &limitReader{r: res.Body, n: max}
+		typ            = res.Meta
+		err  error
+	)
+
+	t, _ := res.MediaType()
+	if t == gemini.GeminiType {
+		body, err = gmitxt.NewDecoder(body, res.Charset())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("problem decoding response: %v", err),
+				http.StatusBadGateway)
+
+			return
+		}
+
+		typ = htmlType
+	}
+
+	head := make([]byte, headLength)
+
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			err = ctxErr
+		}
+
+		http.Error(w, fmt.Sprintf("problem reading response: %v", err),
+			http.StatusBadGateway)
+
+		return
+	}
+
+	head = head[:n]
+	body = io.MultiReader(bytes.NewReader(head), body)
+
+	w.Header().Set("Content-Type", typ)
+
+	if t != gemini.GeminiType && !inlineTypes[t] {
+		w.Header().Set("Content-Disposition", attachment(res.URL))
+	}
+
+	if lang := res.Lang(); lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+
+	if t == gemini.GeminiType {
+		err = renderText(r.Context(), w, body, head, res)
+	} else {
+		_, err = io.Copy(w, body)
+	}
+
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// renderText renders the Gemini text of the response read from body as an
+// HTML page, with its links rewritten by Rewrite.  The title and language of
+// the page are the ones of the start of the text, head.
+func renderText(ctx context.Context, w io.Writer, body io.Reader,
+	head []byte, res *gemini.Response) error {
+	meta := gmitxt.ExtractMetaLang(bytes.NewReader(head), res.Lang())
+
+	return html.RenderContext(ctx, w, body, html.Options{ // nolint: wrapcheck
+		Document: true,
+		Title:    meta.Title,
+		Lang:     meta.Lang,
+		RewriteURL: func(link string) string {
+			return Rewrite(res.URL, link)
+		},
+	})
+}
+
+// limitReader reads from r until n bytes are left to read, after which it
+// returns errTooLarge if r has more.
+type limitReader struct {
+	r io.Reader
+	n int64 // bytes left to read
+}
+
+// Read reads from the underlying reader up to the bytes left to read.
+func (l *limitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		return int(l.n), errTooLarge
+	}
+
+	l.n -= int64(n)
+
+	return n, err // nolint: wrapcheck // error of the underlying reader
+}
+
+// attachment returns the Content-Disposition of a body served as an
+// attachment, with the file name of the URL if it has one.
+func attachment(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "attachment"
+	}
+
+	// The name cannot be formatted when it has special characters.
+	if d := mime.FormatMediaType("attachment",
+		map[string]string{"filename": name}); d != "" {
+		return d
+	}
+
+	return "attachment"
+}
+
+// Rewrite resolves the link against the URL of the page it is in, and
+// returns its URL through the proxy if it is a gemini URL, or its absolute URL
+// otherwise.  A link that cannot be parsed is returned as it is.
+func Rewrite(page *url.URL, link string) string {
+	u, err := page.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	if u.Scheme != "gemini" || u.Host == "" {
+		return u.String()
+	}
+
+	p := Prefix + u.Host + u.EscapedPath()
+	if u.Path == "" {
+		p += "/"
+	}
+
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+
+	if u.Fragment != "" {
+		p += (&url.URL{Fragment: u.Fragment}).String()
+	}
+
+	return p
+}
+
+// inputForm is the form served for an input prompt.
+var inputForm = template.Must(template.New("input").Parse(`<!DOCTYPE html>
+<title>{{.Prompt}}</title>
+<form method="get">
+<label>{{.Prompt}} <input name="` + InputParam + `" type="{{.Type}}"></label>
+<button>Send</button>
+</form>
+`))
+
+// serveInput serves a form for the input prompt of the response.
+func serveInput(w http.ResponseWriter, res *gemini.Response) {
+	typ := "text"
+	if res.Status == gemini.StatusSensitiveInput {
+		typ = "password"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// The client gets a partial form if the connection fails.
+	_ = inputForm.Execute(w, struct{ Prompt, Type string }{res.Meta, typ})
+}
@@ -0,0 +1,471 @@
+package proxy_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"git.sr.ht/~kiba/gmitxt/gemini"
+	"git.sr.ht/~kiba/gmitxt/proxy"
+)
+
+func TestHandler(t *testing.T) {
+	addr := serve(t, gemini.HandlerFunc(
+		func(w gemini.ResponseWriter, r *gemini.Request) {
+			switch r.URL.Path {
+			case "/page":
+				w.WriteHeader(gemini.StatusSuccess, "text/gemini; lang=en")
+				w.Write([]byte("# Page\r\n" + // nolint: errcheck
+					"=> gemini://other.example/x Other\n" +
+					"=> rel.gmi?q#top\n=> https://web.example/ Web\n"))
+			case "/latin1":
+				w.WriteHeader(gemini.StatusSuccess,
+					"text/gemini; charset=iso-8859-1")
+				w.Write([]byte("# Caf\xe9\n")) // nolint: errcheck
+			case "/image.png":
+				w.WriteHeader(gemini.StatusSuccess, "image/png")
+				w.Write([]byte("png")) // nolint: errcheck
+			case "/page.html":
+				w.WriteHeader(gemini.StatusSuccess, "text/html")
+				w.Write([]byte("<script>")) // nolint: errcheck
+			case "/big":
+				w.WriteHeader(gemini.StatusSuccess, "text/plain")
+				w.Write([]byte(strings.Repeat("a", 201))) // nolint: errcheck
+			case "/echo":
+				w.WriteHeader(gemini.StatusSuccess, gemini.GeminiType)
+				w.Write([]byte(r.URL.RawQuery)) // nolint: errcheck
+			case "/input":
+				w.WriteHeader(gemini.StatusInput, "Your <name>?")
+			case "/secret":
+				w.WriteHeader(gemini.StatusSensitiveInput, "Password")
+			case "/redirect":
+				w.WriteHeader(gemini.StatusRedirect, "page")
+			case "/moved":
+				w.WriteHeader(gemini.StatusPermanentRedirect,
+					"https://web.example/")
+			case "/slow":
+				w.WriteHeader(gemini.StatusSlowDown, "60")
+			case "/down":
+				w.WriteHeader(gemini.StatusServerUnavailable, "Down")
+			case "/cert":
+				w.WriteHeader(gemini.StatusCertificateRequired, "Cert")
+			default:
+				w.WriteHeader(gemini.StatusNotFound, "Not found")
+			}
+		}))
+	h := &proxy.Handler{
+		Client:       &gemini.Client{MaxRedirects: 3},
+		Allow:        []string{"127.0.0.*", "*.example"},
+		Deny:         []string{"bad.example"},
+		MaxSize:      200,
+		Ports:        []int{port(t, addr)},
+		AllowPrivate: true,
+	}
+	base := proxy.Prefix + addr
+
+	tests := []struct {
+		method   string
+		target   string
+		code     int
+		typ      string
+		body     string
+		location string
+	}{
+		{"GET", base + "/page", 200, "text/html; charset=utf-8",
+			"<h1 id=\"page\">Page</h1>\n" +
+				"<p><a href=\"" + proxy.Prefix + "other.example/x\">" +
+				"Other</a></p>\n" +
+				"<p><a href=\"" + base + "/rel.gmi?q#top\">" + base +
+				"/rel.gmi?q#top</a></p>\n" +
+				"<p><a href=\"https://web.example/\">Web</a></p>\n", ""},
+		{"GET", base + "/latin1", 200, "", "<title>Café</title>", ""},
+		{"GET", base + "/image.png", 200, "image/png", "png", ""},
+		{"GET", base + "/page.html", 200, "text/html", "<script>", ""},
+		{"GET", base + "/big", 502, "", "response is too large\n", ""},
+		{"GET", base + "/echo?a%20b", 200, "", "<p>a%20b</p>", ""},
+		{"GET", base + "/echo?input=a+b%26c", 200, "", "<p>a%20b%26c</p>",
+			""},
+		{"GET", base + "/input", 200, "text/html; charset=utf-8",
+			`<input name="input" type="text">`, ""},
+		{"GET", base + "/secret", 200, "", `type="password"`, ""},
+		{"GET", base + "/redirect", 302, "", "", base + "/page"},
+		{"GET", base + "/moved", 301, "", "", "https://web.example/"},
+		{"GET", base + "/slow", 429, "", "60\n", ""},
+		{"GET", base + "/down", 503, "", "Down\n", ""},
+		{"GET", base + "/nope", 404, "", "Not found\n", ""},
+		{"GET", base + "/cert", 403, "", "Cert\n", ""},
+		{"GET", proxy.Prefix + "bad.example/", 403, "", "", ""},
+		{"GET", proxy.Prefix + "example.org/", 403, "", "", ""},
+		{"GET", proxy.Prefix, 404, "", "", ""},
+		{"GET", "/other/", 404, "", "", ""},
+		{"POST", base + "/page", 405, "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Logf("checking %s %s", test.method, test.target)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+
+		if rec.Code != test.code {
+			t.Errorf("Expected status %d, got: %d", test.code, rec.Code)
+		}
+
+		if typ := rec.Header().Get("Content-Type"); test.typ != "" &&
+			typ != test.typ {
+			t.Errorf("Expected content type %q, got: %q", test.typ, typ)
+		}
+
+		if !strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("Expected body with %q, got: %q",
+				test.body, rec.Body.String())
+		}
+
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Errorf("Expected location %q, got: %q", test.location, loc)
+		}
+
+		if csp := rec.Header().Get("Content-Security-Policy"); !strings.
+			HasPrefix(csp, "default-src 'none';") {
+			t.Errorf("Expected restrictive policy, got: %q", csp)
+		}
+
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Error("Expected content type options nosniff")
+		}
+	}
+
+	t.Log("checking only plain text and images are served inline")
+
+	for target, expected := range map[string]string{
+		base + "/page":      "",
+		base + "/image.png": "",
+		base + "/page.html": "attachment; filename=page.html",
+		base + "/big":       "",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+
+		if d := rec.Header().Get("Content-Disposition"); d != expected {
+			t.Errorf("Expected disposition %q for %s, got: %q", expected,
+				target, d)
+		}
+	}
+
+	t.Log("checking the form escapes the prompt")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", base+"/input", nil))
+
+	if !strings.Contains(rec.Body.String(), "Your &lt;name&gt;?") {
+		t.Errorf("Expected an escaped prompt, got: %q", rec.Body.String())
+	}
+
+	t.Log("checking the language of Gemini text")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", base+"/page", nil))
+
+	if lang := rec.Header().Get("Content-Language"); lang != "en" {
+		t.Errorf("Expected content language en, got: %q", lang)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// Nothing listens on the address once the listener is closed.
+	addr := l.Addr().String()
+	l.Close()
+
+	rec := httptest.NewRecorder()
+	(&proxy.Handler{
+		Ports:        []int{port(t, addr)},
+		AllowPrivate: true,
+	}).ServeHTTP(rec, httptest.NewRequest("GET", proxy.Prefix+addr, nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got: %d",
+			http.StatusBadGateway, rec.Code)
+	}
+
+	addr = serve(t, gemini.HandlerFunc(
+		func(w gemini.ResponseWriter, r *gemini.Request) {
+			w.WriteHeader(gemini.StatusSuccess, "text/gemini; charset=koi8-r")
+		}))
+
+	rec = httptest.NewRecorder()
+	(&proxy.Handler{
+		Ports:        []int{port(t, addr)},
+		AllowPrivate: true,
+	}).ServeHTTP(rec, httptest.NewRequest("GET", proxy.Prefix+addr+"/", nil))
+
+	if rec.Code != http.StatusBadGateway ||
+		!strings.Contains(rec.Body.String(), "unsupported charset") {
+		t.Errorf("Expected an unsupported charset, got: %d %q",
+			rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerPrivate(t *testing.T) {
+	addr := serve(t, gemini.HandlerFunc(
+		func(w gemini.ResponseWriter, r *gemini.Request) {
+			w.WriteHeader(gemini.StatusSuccess, gemini.GeminiType)
+		}))
+
+	errRefused := errors.New("refused")
+	h := &proxy.Handler{
+		Client: &gemini.Client{
+			Control: func(string, string, syscall.RawConn) error {
+				return errRefused
+			},
+		},
+		Ports: []int{port(t, addr)},
+	}
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{addr + "/", 403, "address not allowed"},
+		{"localhost/", 403, "address not allowed"},
+		{"10.1.2.3/", 403, "address not allowed"},
+		{"192.168.1.1/", 403, "address not allowed"},
+		{"[fe80::1]/", 403, "address not allowed"},
+		{"[::]/", 403, "address not allowed"},
+		{"127.0.0.1:1966/", 403, "port not allowed"},
+		{"127.0.0.1:99999999999999999999/", 403, "port not allowed"},
+		{"192.0.2.1:1965/", 502, "refused"},
+	}
+
+	for _, test := range tests {
+		t.Logf("checking %s", test.target)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET",
+			proxy.Prefix+test.target, nil))
+
+		if rec.Code != test.code ||
+			!strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("Expected %d %q, got: %d %q", test.code, test.body,
+				rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestHandlerStall(t *testing.T) {
+	short := stall(t, "20 text/gemini\r\n# Partial\n")
+	long := stall(t, "20 text/gemini\r\n"+strings.Repeat("text\n", 10000))
+
+	h := &proxy.Handler{
+		Timeout:      100 * time.Millisecond,
+		Ports:        []int{port(t, short), port(t, long)},
+		AllowPrivate: true,
+	}
+
+	t.Log("checking a server stalling at the start of the body")
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", proxy.Prefix+short+"/", nil))
+
+	if rec.Code != http.StatusBadGateway ||
+		!strings.Contains(rec.Body.String(), "deadline exceeded") {
+		t.Errorf("Expected a deadline error, got: %d %q", rec.Code,
+			rec.Body.String())
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the handler to return after its timeout, took %v",
+			d)
+	}
+
+	t.Log("checking a request canceled while the server stalls")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	rec = httptest.NewRecorder()
+	(&proxy.Handler{
+		Ports:        []int{port(t, short)},
+		AllowPrivate: true,
+	}).ServeHTTP(rec, httptest.NewRequest("GET", proxy.Prefix+short+"/",
+		nil).WithContext(ctx))
+
+	if rec.Code != http.StatusBadGateway ||
+		!strings.Contains(rec.Body.String(), "context canceled") {
+		t.Errorf("Expected a canceled error, got: %d %q", rec.Code,
+			rec.Body.String())
+	}
+
+	t.Log("checking a server stalling after the start of the body")
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + proxy.Prefix + long + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		t.Errorf("Expected the response to be aborted, got: %d bytes", len(b))
+	}
+
+	if !strings.Contains(string(b), "<p>text</p>") {
+		t.Errorf("Expected the start of the body, got: %q", b)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	page, _ := url.Parse("gemini://example.org/blog/post.gmi")
+
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{"other.gmi", proxy.Prefix + "example.org/blog/other.gmi"},
+		{"/", proxy.Prefix + "example.org/"},
+		{"//example.com", proxy.Prefix + "example.com/"},
+		{"gemini://example.com:1966/a%20b?q=1#c d",
+			proxy.Prefix + "example.com:1966/a%20b?q=1#c%20d"},
+		{"https://example.org/", "https://example.org/"},
+		{"gopher://example.org/1/", "gopher://example.org/1/"},
+		{"mailto:kiba@example.org", "mailto:kiba@example.org"},
+		{"%zz", "%zz"},
+	}
+
+	for _, test := range tests {
+		if actual := proxy.Rewrite(page, test.link); actual != test.expected {
+			t.Errorf("Expected %q for %q, got: %q",
+				test.expected, test.link, actual)
+		}
+	}
+}
+
+// port returns the port of the address.
+func port(t *testing.T, addr string) int {
+	t.Helper()
+
+	_, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	n, err := strconv.Atoi(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return n
+}
+
+// serve starts a Gemini server with the handler on a local address, which is
+// returned.  The server is closed when the test ends.
+func serve(t *testing.T, h gemini.Handler) string {
+	t.Helper()
+
+	certPEM, keyPEM, err := gemini.NewCertificate([]string{"127.0.0.1"},
+		time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not load certificate: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	srv := &gemini.Server{
+		Handler:   h,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	errs := make(chan error, 1)
+
+	go func() { errs <- srv.Serve(l) }()
+
+	t.Cleanup(func() {
+		srv.Close()
+
+		if err := <-errs; !errors.Is(err, gemini.ErrServerClosed) {
+			t.Errorf("Expected ErrServerClosed, got: %v", err)
+		}
+	})
+
+	return l.Addr().String()
+}
+
+// stall starts a TLS server on a local address, which is returned, that
+// writes the response to requests and then stalls until the test ends.
+func stall(t *testing.T, response string) string {
+	t.Helper()
+
+	certPEM, keyPEM, err := gemini.NewCertificate([]string{"127.0.0.1"},
+		time.Hour)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("could not load certificate: %v", err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0",
+		&tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		close(done)
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				if _, err := gemini.ReadRequest(
+					bufio.NewReader(conn)); err == nil {
+					io.WriteString(conn, response) // nolint: errcheck
+				}
+
+				<-done
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
@@ -3,13 +3,17 @@ package gmitxt
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"io"
+	"unicode/utf8"
 )
 
 // Scanner provides an interface for reading Gemini formatted text.  Text is
-// assumed to be UTF-8 encoded.  This is a line-based scanner where new lines
-// are delimited by either CRLF (\r\n DOS/Windows format) or LF (\n UNIX
-// format).
+// assumed to be UTF-8 encoded and a leading UTF-8 byte order mark (BOM) is
+// stripped.  Text in other charsets can be decoded to UTF-8 with NewDecoder and
+// the ValidateUTF8 method can be used to report invalid UTF-8.  This is a
+// line-based scanner where new lines are delimited by either CRLF (\r\n
+// DOS/Windows format) or LF (\n UNIX format).
 //
 // This uses the bufio.Scanner from Go's standard library to scan input text
 // line by line.  Each successive call to the Scan method will step through the
@@ -17,7 +21,10 @@ import (
 // calling the Type method.
 //
 // Scanning stops unrecoverably at EOF, the first I/O error, or an input line
-// too large to fit in the buffer.
+// too large to fit in the buffer.  The LongLines method can be used to recover
+// from lines that are too large by truncating, splitting or skipping them.
+// Scanning also stops when the text exceeds the limits set by the Limits
+// method, or when the context given to ScanContext is done.
 //
 // For reference, the text/gemini format is described here:
 //
@@ -28,17 +35,60 @@ import (
 //     gemini://gemini.circumlunar.space/docs/specification.gmi
 //
 type Scanner struct {
-	scan *bufio.Scanner // underlying bufio.Scanner used to scan lines
-	line Line           // scanned Gemini line representation
-	pre  bool           // are we in a preformatted text section?
-	idx  int            // whitespace index to parse links
+	scan     *bufio.Scanner // underlying bufio.Scanner used to scan lines
+	src      *source        // reader scanned by the bufio.Scanner
+	err      error          // error that stopped scanning, if not from scan
+	maxLines uint32         // maximum number of lines, 0 for no limit
+	line     Line           // scanned Gemini line representation
+	pre      bool           // are we in a preformatted text section?
+	idx      int            // whitespace index to parse links
+	policy   LongLinePolicy // how to handle lines too long for the buffer
+	max      int            // maximum line size that fits in the buffer
+	long     bool           // was the last token the start of a long line?
+	discard  bool           // are we discarding the rest of a long line?
+	strict   bool           // report diagnostics for non-conforming lines?
+	diags    []Diagnostic   // diagnostics for the scanned line
+	preNum   uint32         // line number that started preformatted text
+	done     bool           // has the end of the text been reached?
+	closePre bool           // close unclosed preformatted text at the end?
+	utf8     bool           // report diagnostics for invalid UTF-8?
+	started  bool           // has the first line been scanned?
+	off      int64          // number of bytes split from the text
+	tokOff   int64          // byte offset of the last token in the text
 }
 
 // NewScanner returns a new Scanner to read from r.
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{scan: bufio.NewScanner(r)}
+	s := &Scanner{
+		src: &source{r: r},
+		max: bufio.MaxScanTokenSize,
+	}
+	s.scan = bufio.NewScanner(s.src)
+	s.scan.Split(s.split)
+
+	return s
 }
 
+// LongLinePolicy describes how a Scanner handles an input line that is too
+// large to fit in its buffer.
+type LongLinePolicy uint8
+
+const (
+	// LongLineError stops scanning with the bufio.ErrTooLong error.  This is
+	// the default policy.
+	LongLineError LongLinePolicy = iota
+	// LongLineTruncate keeps the start of the line that fits in the buffer and
+	// discards the rest.  The line is flagged as Truncated.
+	LongLineTruncate
+	// LongLineSplit splits the line into fragments that fit in the buffer.
+	// Each fragment is scanned as a separate Line with the same line number
+	// and type.  Fragments are flagged as Split and Continued.
+	LongLineSplit
+	// LongLineSkip discards the whole line.  The line is still scanned with
+	// its line number and type, but is flagged as Skipped and has no text.
+	LongLineSkip
+)
+
 const (
 	whitespace = " \t" // either space or tab
 	tokHead3   = "###"
@@ -48,6 +98,9 @@ const (
 	tokPre     = "```"
 	tokList    = "* "
 	tokQuote   = ">"
+	tokStar    = "*"
+	tokHead4   = "####"
+	bom        = "\xEF\xBB\xBF" // UTF-8 byte order mark
 )
 
 // Scan advances the Scanner to the next line of text, which will then be
@@ -64,44 +117,131 @@ const (
 func (s *Scanner) Scan() bool {
 	s.line.Text = nil
 	s.line.URL = nil
+	s.line.Flags = 0
+	s.diags = s.diags[:0]
+	cont := s.long && s.policy == LongLineSplit
+
+	if s.err != nil {
+		return false
+	}
 
 	if !s.scan.Scan() {
+		return s.end()
+	}
+
+	s.line.Offset = s.tokOff
+
+	if cont {
+		// Continue the fragment of a split line without parsing it.
+		s.line.Text = s.scan.Bytes()
+		s.line.Flags = Continued
+
+		if s.long {
+			s.line.Flags |= Split
+		}
+
+		if s.utf8 {
+			s.validate()
+		}
+
+		return true
+	}
+
+	if s.maxLines > 0 && s.line.Num >= s.maxLines {
+		s.err = ErrTooManyLines
+
 		return false
 	}
 
 	s.line.Num++
+	s.parse()
+
+	if s.strict {
+		s.check()
+	}
+
+	if s.long {
+		s.flag()
+	}
+
+	if s.utf8 {
+		s.validate()
+	}
+
+	return true
+}
+
+// flag sets the flags of the scanned line when it is too long to fit in the
+// buffer.
+func (s *Scanner) flag() {
+	switch s.policy {
+	case LongLineTruncate:
+		s.line.Flags = Truncated
+	case LongLineSplit:
+		s.line.Flags = Split
+	case LongLineSkip:
+		s.line.Flags = Skipped
+		s.line.Text = nil
+		s.line.URL = nil
+	case LongLineError:
+	}
+}
+
+// end handles the end of the text.  It returns true when a PreEnd line was
+// added to close preformatted text that was not closed.
+func (s *Scanner) end() bool {
+	if !s.pre || s.done || s.Err() != nil {
+		s.done = true
+
+		return false
+	}
 
+	s.done = true
+
+	if s.strict {
+		s.report(s.preNum, DiagPreUnclosed, msgPreUnclosed)
+	}
+
+	if !s.closePre {
+		return false
+	}
+
+	s.line.Type = PreEnd
+	s.line.Flags = Synthetic
+	s.line.Offset = s.off
+	s.pre = false
+
+	return true
+}
+
+// parse identifies the Gemini line type of the scanned bytes and sets the
+// text and URL of the line.
+func (s *Scanner) parse() {
 	if s.pre {
 		if bytes.HasPrefix(s.scan.Bytes(), []byte(tokPre)) {
 			// End of preformatted text.
 			s.line.Type = PreEnd
 			s.pre = false
 
-			return true
+			return
 		}
 
 		s.line.Type = PreBody
 		s.line.Text = s.scan.Bytes()
 
-		return true
+		return
 	}
 
 	switch {
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokHead3)):
 		s.line.Type = Head3
 		s.line.Text = trimLeftSpace(s.scan.Bytes()[3:])
-
-		return true
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokHead2)):
 		s.line.Type = Head2
 		s.line.Text = trimLeftSpace(s.scan.Bytes()[2:])
-
-		return true
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokHead1)):
 		s.line.Type = Head1
 		s.line.Text = trimLeftSpace(s.scan.Bytes()[1:])
-
-		return true
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokLink)):
 		s.line.Type = Link
 		s.line.URL = trimLeftSpace(s.scan.Bytes()[2:])
@@ -111,32 +251,200 @@ func (s *Scanner) Scan() bool {
 			s.line.Text = trimLeftSpace(s.line.URL[s.idx:])
 			s.line.URL = s.line.URL[:s.idx]
 		}
-
-		return true
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokPre)):
 		s.line.Type = PreStart
 		s.line.Text = s.scan.Bytes()[3:]
 		s.pre = true
-
-		return true
+		s.preNum = s.line.Num
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokList)):
 		s.line.Type = List
 		s.line.Text = s.scan.Bytes()[2:]
-
-		return true
 	case bytes.HasPrefix(s.scan.Bytes(), []byte(tokQuote)):
 		s.line.Type = Quote
 		s.line.Text = s.scan.Bytes()[1:]
-
-		return true
 	default:
 		s.line.Type = Text
 		s.line.Text = s.scan.Bytes()
+	}
+}
 
-		return true
+// check reports diagnostics for the scanned line when it does not strictly
+// conform to the specification.
+func (s *Scanner) check() {
+	b := s.scan.Bytes()
+
+	if bytes.IndexByte(b, '\r') != -1 {
+		s.report(s.line.Num, DiagBareCR, msgBareCR)
+	}
+
+	switch s.line.Type {
+	case Text:
+		if bytes.HasPrefix(b, []byte(tokStar)) {
+			s.report(s.line.Num, DiagListNoSpace, msgListNoSpace)
+		}
+	case PreEnd:
+		if len(b) > len(tokPre) {
+			s.report(s.line.Num, DiagPreEndText, msgPreEndText)
+		}
+	case Link:
+		if len(s.line.URL) == 0 {
+			s.report(s.line.Num, DiagLinkNoURL, msgLinkNoURL)
+		}
+	case Head3:
+		if bytes.HasPrefix(b, []byte(tokHead4)) {
+			s.report(s.line.Num, DiagHeadingTooDeep, msgHeadingTooDeep)
+		}
+	case Head1, Head2, PreStart, PreBody, List, Quote:
 	}
 }
 
+// validate reports diagnostics for invalid UTF-8 sequences in the scanned
+// line.  Multi-byte sequences cut by the ends of a line that was too long to
+// fit in the buffer are not reported.
+func (s *Scanner) validate() {
+	b := s.scan.Bytes()
+	i := 0
+
+	if s.line.Flags.Has(Continued) {
+		// Skip the rest of a sequence cut by the end of the previous fragment.
+		for i < len(b) && i < utf8.UTFMax-1 && !utf8.RuneStart(b[i]) {
+			i++
+		}
+	}
+
+	for i < len(b) {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !utf8.FullRune(b[i:]) && s.long {
+				return // cut by the end of the buffer
+			}
+
+			s.diags = append(s.diags, Diagnostic{
+				Num:     s.line.Num,
+				Col:     i + 1,
+				Code:    DiagInvalidUTF8,
+				Message: msgInvalidUTF8,
+			})
+		}
+
+		i += size
+	}
+}
+
+// report adds a diagnostic for the scanned line.
+func (s *Scanner) report(num uint32, code DiagnosticCode, msg string) {
+	s.diags = append(s.diags, Diagnostic{Num: num, Code: code, Message: msg})
+}
+
+// split is the bufio.SplitFunc used by the underlying bufio.Scanner.  It keeps
+// track of the byte offset of each token in the text.
+func (s *Scanner) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := s.next(data, atEOF)
+
+	if token != nil {
+		// The token is a slice of data, so the difference of their capacities
+		// is the offset of the token in data.
+		s.tokOff = s.off + int64(cap(data)-cap(token))
+	}
+
+	s.off += int64(advance)
+
+	return advance, token, err
+}
+
+// next splits lines the same as bufio.ScanLines, but when the buffer is full
+// without a new line and the long line policy allows it, the buffer is
+// returned as a token so scanning can continue.
+func (s *Scanner) next(data []byte, atEOF bool) (int, []byte, error) {
+	if s.discard {
+		// Discard the rest of a long line up to and including the new line.
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			s.discard = false
+
+			return i + 1, nil, nil
+		}
+
+		return len(data), nil, nil
+	}
+
+	if atEOF && s.src.err != nil && bytes.IndexByte(data, '\n') == -1 {
+		// Stop without the rest of the text read before the context was done
+		// or the byte limit was exceeded, as it is not a complete line.
+		return 0, nil, s.src.err
+	}
+
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if token != nil || err != nil {
+		s.long = false
+
+		return advance, s.strip(token), err
+	}
+
+	if s.policy == LongLineError || len(data) < s.max {
+		return advance, token, err
+	}
+
+	// The buffer is full and there is no new line; this is a long line.
+	s.long = true
+	s.discard = s.policy != LongLineSplit
+
+	return len(data), s.strip(data), nil
+}
+
+// strip removes a UTF-8 byte order mark from the start of the first line.
+func (s *Scanner) strip(token []byte) []byte {
+	if s.started || token == nil {
+		return token
+	}
+
+	s.started = true
+
+	return bytes.TrimPrefix(token, []byte(bom))
+}
+
+// ScanContext is like Scan, but stops scanning when the context is done.  It
+// returns false when the context is done before or while reading the next
+// line, and the Err method will return the error of the context.  A read that
+// is blocked is not interrupted, so the context is checked before each read
+// of the underlying reader and before each line.
+func (s *Scanner) ScanContext(ctx context.Context) bool {
+	if s.err == nil {
+		s.err = ctx.Err()
+	}
+
+	if s.err != nil {
+		s.line.Text = nil
+		s.line.URL = nil
+		s.line.Flags = 0
+		s.diags = s.diags[:0]
+
+		return false
+	}
+
+	s.src.ctx = ctx
+	ok := s.Scan()
+	s.src.ctx = nil
+
+	return ok
+}
+
+// Limits sets the maximum number of lines and bytes of text to scan.  Scanning
+// stops when the text has more lines than maxLines, and the Err method will
+// return ErrTooManyLines.  Scanning stops when the text has more bytes than
+// maxBytes, and the Err method will return ErrTooManyBytes.  A limit of 0 means
+// there is no limit, which is the default.  Limits should be called before
+// scanning starts.
+func (s *Scanner) Limits(maxLines uint32, maxBytes int64) {
+	s.maxLines = maxLines
+	s.src.max = maxBytes
+}
+
+// LongLines sets the policy used to handle input lines that are too large to
+// fit in the buffer.  By default, scanning stops with bufio.ErrTooLong.
+func (s *Scanner) LongLines(policy LongLinePolicy) {
+	s.policy = policy
+}
+
 // trimLeftSpace is trims any whitespace to the left in the input byte slice.
 // This returns nil if the input byte slice is all whitespace.
 // This is a replacement for bytes.TrimLeft that doesn't allocate.
@@ -156,6 +464,18 @@ func trimLeftSpace(b []byte) []byte {
 	return nil
 }
 
+// trimRightSpace trims any whitespace to the right in the input byte slice.
+// This returns nil if the input byte slice is all whitespace.
+func trimRightSpace(b []byte) []byte {
+	for idx := len(b) - 1; idx >= 0; idx-- {
+		if !isWhitespace(b[idx]) {
+			return b[:idx+1]
+		}
+	}
+
+	return nil
+}
+
 // isWhitespace returns whether a byte character is a whitespace.  The Gemini
 // specification defines whitespace as either a space or a tab character.
 func isWhitespace(char byte) bool {
@@ -166,6 +486,46 @@ func isWhitespace(char byte) bool {
 	return false
 }
 
+// ClosePreformatted sets whether the Scanner closes preformatted text that is
+// not closed by the end of the text.  When set, Scan adds a PreEnd line flagged
+// as Synthetic after the last line, so renderers can end preformatted text
+// correctly.  By default, no line is added and InPreformatted reports whether
+// the text ended inside preformatted text.
+func (s *Scanner) ClosePreformatted(closePre bool) {
+	s.closePre = closePre
+}
+
+// InPreformatted returns whether the Scanner is inside preformatted text.  The
+// line that was just scanned started or is part of preformatted text.  After
+// Scan returns false, it reports whether the text ended without closing
+// preformatted text.
+func (s *Scanner) InPreformatted() bool {
+	return s.pre
+}
+
+// ValidateUTF8 sets whether the Scanner reports diagnostics for invalid UTF-8
+// sequences.  Each invalid sequence is reported with the line number and the
+// column of its first byte in the line.
+func (s *Scanner) ValidateUTF8(validate bool) {
+	s.utf8 = validate
+}
+
+// Strict sets whether the Scanner reports diagnostics for lines that do not
+// strictly conform to the text/gemini specification, or that clients may
+// render differently.  Strict mode does not change how lines are scanned.
+func (s *Scanner) Strict(strict bool) {
+	s.strict = strict
+}
+
+// Diagnostics returns the diagnostics reported in strict mode, or by UTF-8
+// validation, for the line that was just scanned by the Scan method.  After
+// Scan returns false, it returns diagnostics for the end of the text, such as
+// preformatted text that was not closed.  The underlying data will be
+// overwritten by subsequent calls to Scan.
+func (s *Scanner) Diagnostics() []Diagnostic {
+	return s.diags
+}
+
 // Line returns the parsed Line of Gemini text that was just scanned by the Scan
 // method.  The underlying data will be overwritten by subsequent calls to Scan.
 // This does not allocate memory.
@@ -173,8 +533,20 @@ func (s *Scanner) Line() Line {
 	return s.line
 }
 
+// Bytes returns the bytes of the line that was just scanned by the Scan method
+// as they are in the text, without the new line.  The underlying array may
+// point to data that will be overwritten by a subsequent call to Scan.  It does
+// no allocation.
+func (s *Scanner) Bytes() []byte {
+	return s.scan.Bytes()
+}
+
 // Err returns the first non-EOF error that was encountered by the Scanner.
 func (s *Scanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
 	return s.scan.Err()
 }
 
@@ -189,4 +561,9 @@ func (s *Scanner) Err() error {
 // Buffer panics if it is called after scanning has started.
 func (s *Scanner) Buffer(buf []byte, max int) {
 	s.scan.Buffer(buf, max)
+	s.max = max
+
+	if cap(buf) > max {
+		s.max = cap(buf)
+	}
 }
@@ -3,11 +3,13 @@ package gmitxt_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"git.sr.ht/~kiba/gmitxt"
 	"git.sr.ht/~kiba/gmitxt/internal/toast"
@@ -69,9 +71,30 @@ func TestSanner(t *testing.T) {
 	expectEnd(t, s, 39)
 	expectEnd(t, s, 39)
 
+	t.Log("scanning line bytes")
+
+	s = gmitxt.NewScanner(strings.NewReader("=>\tfoo.gmi  Foo \r\n# Bar"))
+	expectBytes(t, s, "=>\tfoo.gmi  Foo ")
+	expectBytes(t, s, "# Bar")
+
+	t.Log("scanning line offsets")
+
+	input := "\xEF\xBB\xBF# A\r\n\nText\n```\ncode"
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.ClosePreformatted(true)
+
+	for _, offset := range []int64{3, 8, 9, 14, 18, 22} {
+		s.Scan()
+
+		if s.Line().Offset != offset {
+			t.Errorf("Line %d: offset was expected to be %d, got: %d",
+				s.Line().Num, offset, s.Line().Offset)
+		}
+	}
+
 	t.Log("scanning with a tiny buffer")
 
-	input := `# This is my test Gemini
+	input = `# This is my test Gemini
 ## This is a level two heading.`
 	buf := make([]byte, 0, 24)
 	s = gmitxt.NewScanner(strings.NewReader(input))
@@ -89,6 +112,339 @@ func TestSanner(t *testing.T) {
 	}
 }
 
+func TestScannerLongLines(t *testing.T) {
+	input := "# Heading\n=> gemini://example.tld/ long link\r\nText\n"
+	buf := make([]byte, 0, 16)
+
+	t.Log("truncating long lines")
+
+	s := gmitxt.NewScanner(strings.NewReader(input))
+	s.Buffer(buf, 16)
+	s.LongLines(gmitxt.LongLineTruncate)
+	expectStart(t, s)
+	expectLine(t, s, 1, gmitxt.Head1, "Heading")
+	expectFlags(t, s, 0)
+	expectLink(t, s, 2, "gemini://exam", "")
+	expectFlags(t, s, gmitxt.Truncated)
+	expectLine(t, s, 3, gmitxt.Text, "Text")
+	expectFlags(t, s, 0)
+	expectEnd(t, s, 3)
+
+	t.Log("splitting long lines")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Buffer(buf, 16)
+	s.LongLines(gmitxt.LongLineSplit)
+	expectLine(t, s, 1, gmitxt.Head1, "Heading")
+	expectFlags(t, s, 0)
+	expectLink(t, s, 2, "gemini://exam", "")
+	expectFlags(t, s, gmitxt.Split)
+	expectFragment(t, s, 2, gmitxt.Link, "ple.tld/ long li")
+	expectFlags(t, s, gmitxt.Split|gmitxt.Continued)
+	expectFragment(t, s, 2, gmitxt.Link, "nk")
+	expectFlags(t, s, gmitxt.Continued)
+
+	if s.Line().Offset != 42 {
+		t.Errorf("Line %d: offset was expected to be 42, got: %d",
+			s.Line().Num, s.Line().Offset)
+	}
+	expectLine(t, s, 3, gmitxt.Text, "Text")
+	expectFlags(t, s, 0)
+	expectEnd(t, s, 3)
+
+	t.Log("skipping long lines")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Buffer(buf, 16)
+	s.LongLines(gmitxt.LongLineSkip)
+	expectLine(t, s, 1, gmitxt.Head1, "Heading")
+	expectFlags(t, s, 0)
+	expectLine(t, s, 2, gmitxt.Link, "")
+	expectFlags(t, s, gmitxt.Skipped)
+	expectLine(t, s, 3, gmitxt.Text, "Text")
+	expectFlags(t, s, 0)
+	expectEnd(t, s, 3)
+
+	t.Log("truncating long lines with a buffer larger than the maximum")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Buffer(buf, 8)
+	s.LongLines(gmitxt.LongLineTruncate)
+	expectLine(t, s, 1, gmitxt.Head1, "Heading")
+	expectFlags(t, s, 0)
+	expectLink(t, s, 2, "gemini://exam", "")
+	expectFlags(t, s, gmitxt.Truncated)
+
+	t.Log("failing on long lines")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Buffer(buf, 16)
+	s.LongLines(gmitxt.LongLineError)
+	expectLine(t, s, 1, gmitxt.Head1, "Heading")
+
+	if s.Scan() {
+		t.Errorf("Line %d: scanner should have stopped", s.Line().Num)
+	}
+
+	if !errors.Is(s.Err(), bufio.ErrTooLong) {
+		t.Errorf("Line %d: scanner should have error `%v`, got: %v",
+			s.Line().Num, bufio.ErrTooLong, s.Err())
+	}
+}
+
+func TestScannerStrict(t *testing.T) {
+	f, err := os.Open(example)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", example, err)
+	}
+	defer f.Close()
+
+	t.Logf("scanning strictly: %s", example)
+
+	s := gmitxt.NewScanner(f)
+	s.Strict(true)
+
+	var diags []gmitxt.Diagnostic
+	for s.Scan() {
+		diags = append(diags, s.Diagnostics()...)
+	}
+
+	expectDiagnostics(t, diags, []gmitxt.Diagnostic{
+		{Num: 18, Code: gmitxt.DiagListNoSpace},
+		{Num: 19, Code: gmitxt.DiagListNoSpace},
+		{Num: 36, Code: gmitxt.DiagPreEndText},
+	})
+
+	t.Log("scanning strictly with unclosed preformatted text")
+
+	input := "#### Deep\n=>\nfoo\rbar\n```alt\ncode"
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Strict(true)
+
+	diags = nil
+	for s.Scan() {
+		diags = append(diags, s.Diagnostics()...)
+	}
+
+	diags = append(diags, s.Diagnostics()...)
+	expectDiagnostics(t, diags, []gmitxt.Diagnostic{
+		{Num: 1, Code: gmitxt.DiagHeadingTooDeep},
+		{Num: 2, Code: gmitxt.DiagLinkNoURL},
+		{Num: 3, Code: gmitxt.DiagBareCR},
+		{Num: 4, Code: gmitxt.DiagPreUnclosed},
+	})
+
+	if s.Scan() || len(s.Diagnostics()) != 0 {
+		t.Errorf("Expected no diagnostics after the end, got: %v",
+			s.Diagnostics())
+	}
+
+	t.Log("scanning leniently")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	for s.Scan() {
+		if len(s.Diagnostics()) != 0 {
+			t.Errorf("Line %d: expected no diagnostics, got: %v",
+				s.Line().Num, s.Diagnostics())
+		}
+	}
+
+	if len(s.Diagnostics()) != 0 {
+		t.Errorf("Expected no diagnostics at the end, got: %v",
+			s.Diagnostics())
+	}
+}
+
+func TestScannerUnclosedPreformatted(t *testing.T) {
+	input := "Text\n```alt\ncode"
+
+	t.Log("scanning unclosed preformatted text")
+
+	s := gmitxt.NewScanner(strings.NewReader(input))
+	expectLine(t, s, 1, gmitxt.Text, "Text")
+	expectPreformatted(t, s, false)
+	expectLine(t, s, 2, gmitxt.PreStart, "alt")
+	expectPreformatted(t, s, true)
+	expectLine(t, s, 3, gmitxt.PreBody, "code")
+	expectPreformatted(t, s, true)
+	expectEnd(t, s, 3)
+	expectPreformatted(t, s, true)
+
+	t.Log("closing unclosed preformatted text")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.ClosePreformatted(true)
+	s.Strict(true)
+	expectLine(t, s, 1, gmitxt.Text, "Text")
+	expectLine(t, s, 2, gmitxt.PreStart, "alt")
+	expectLine(t, s, 3, gmitxt.PreBody, "code")
+	expectFlags(t, s, 0)
+	expectLine(t, s, 3, gmitxt.PreEnd, "")
+	expectFlags(t, s, gmitxt.Synthetic)
+	expectPreformatted(t, s, false)
+	expectDiagnostics(t, s.Diagnostics(), []gmitxt.Diagnostic{
+		{Num: 2, Code: gmitxt.DiagPreUnclosed},
+	})
+	expectEnd(t, s, 3)
+	expectEnd(t, s, 3)
+
+	t.Log("closing closed preformatted text")
+
+	s = gmitxt.NewScanner(strings.NewReader(input + "\n```"))
+	s.ClosePreformatted(true)
+	expectLine(t, s, 1, gmitxt.Text, "Text")
+	expectLine(t, s, 2, gmitxt.PreStart, "alt")
+	expectLine(t, s, 3, gmitxt.PreBody, "code")
+	expectLine(t, s, 4, gmitxt.PreEnd, "")
+	expectFlags(t, s, 0)
+	expectEnd(t, s, 4)
+}
+
+func TestScannerUTF8(t *testing.T) {
+	input := "\xEF\xBB\xBF# Caf\xC3\xA9\n\xEF\xBB\xBFText\n* b\xE9b\xE9\n"
+
+	t.Log("scanning with a byte order mark")
+
+	s := gmitxt.NewScanner(strings.NewReader(input))
+	expectLine(t, s, 1, gmitxt.Head1, "Caf\xC3\xA9")
+	expectLine(t, s, 2, gmitxt.Text, "\xEF\xBB\xBFText")
+	expectLine(t, s, 3, gmitxt.List, "b\xE9b\xE9")
+
+	if len(s.Diagnostics()) != 0 {
+		t.Errorf("Line %d: expected no diagnostics, got: %v",
+			s.Line().Num, s.Diagnostics())
+	}
+
+	expectEnd(t, s, 3)
+
+	t.Log("scanning with UTF-8 validation")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.ValidateUTF8(true)
+	expectLine(t, s, 1, gmitxt.Head1, "Caf\xC3\xA9")
+	expectDiagnostics(t, s.Diagnostics(), nil)
+	expectLine(t, s, 2, gmitxt.Text, "\xEF\xBB\xBFText")
+	expectDiagnostics(t, s.Diagnostics(), nil)
+	expectLine(t, s, 3, gmitxt.List, "b\xE9b\xE9")
+	expectDiagnostics(t, s.Diagnostics(), []gmitxt.Diagnostic{
+		{Num: 3, Col: 4, Code: gmitxt.DiagInvalidUTF8},
+		{Num: 3, Col: 6, Code: gmitxt.DiagInvalidUTF8},
+	})
+	expectEnd(t, s, 3)
+
+	t.Log("scanning with UTF-8 validation of split lines")
+
+	buf := make([]byte, 0, 4)
+	s = gmitxt.NewScanner(strings.NewReader("\xC3\xA9\xC3\xA9\xC3\xA9\n"))
+	s.Buffer(buf, 4)
+	s.LongLines(gmitxt.LongLineSplit)
+	s.ValidateUTF8(true)
+	expectLine(t, s, 1, gmitxt.Text, "\xC3\xA9\xC3\xA9")
+	expectDiagnostics(t, s.Diagnostics(), nil)
+	expectFragment(t, s, 1, gmitxt.Text, "\xC3\xA9")
+	expectDiagnostics(t, s.Diagnostics(), nil)
+
+	s = gmitxt.NewScanner(strings.NewReader("a\xC3\xA9\xC3\xA9\xE9\n"))
+	s.Buffer(buf, 4)
+	s.LongLines(gmitxt.LongLineSplit)
+	s.ValidateUTF8(true)
+	expectLine(t, s, 1, gmitxt.Text, "a\xC3\xA9\xC3")
+	expectDiagnostics(t, s.Diagnostics(), nil)
+	expectFragment(t, s, 1, gmitxt.Text, "\xA9\xE9")
+	expectDiagnostics(t, s.Diagnostics(), []gmitxt.Diagnostic{
+		{Num: 1, Col: 2, Code: gmitxt.DiagInvalidUTF8},
+	})
+}
+
+func TestScannerContext(t *testing.T) {
+	input := "# One\nTwo\n"
+
+	t.Log("scanning with a context")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := gmitxt.NewScanner(strings.NewReader(input))
+	expectLineContext(ctx, t, s, 1, gmitxt.Head1, "One")
+	expectLineContext(ctx, t, s, 2, gmitxt.Text, "Two")
+	expectEnd(t, s, 2)
+
+	t.Log("scanning with a context that is done")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	expectLineContext(ctx, t, s, 1, gmitxt.Head1, "One")
+	cancel()
+	expectEndContext(ctx, t, s, 1, context.Canceled)
+	expectEndContext(context.Background(), t, s, 1, context.Canceled)
+
+	t.Log("scanning with a context that is done while reading")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	var read int
+
+	s = gmitxt.NewScanner(readerFunc(func(p []byte) (int, error) {
+		if read == 8 {
+			cancel()
+		}
+
+		n := copy(p[:1], input[read:])
+		read += n
+
+		return n, nil
+	}))
+	expectLineContext(ctx, t, s, 1, gmitxt.Head1, "One")
+	expectEndContext(ctx, t, s, 1, context.Canceled)
+}
+
+func TestScannerLimits(t *testing.T) {
+	input := "# One\nTwo\n"
+
+	t.Log("scanning within the limits")
+
+	s := gmitxt.NewScanner(strings.NewReader(input))
+	s.Limits(2, int64(len(input)))
+	expectLine(t, s, 1, gmitxt.Head1, "One")
+	expectLine(t, s, 2, gmitxt.Text, "Two")
+	expectEnd(t, s, 2)
+
+	t.Log("scanning more lines than the limit")
+
+	s = gmitxt.NewScanner(strings.NewReader(input))
+	s.Limits(1, 0)
+	expectLine(t, s, 1, gmitxt.Head1, "One")
+	expectEndContext(context.Background(), t, s, 1, gmitxt.ErrTooManyLines)
+
+	if s.Scan() {
+		t.Errorf("Line %d: scanner should have stopped", s.Line().Num)
+	}
+
+	t.Log("scanning more bytes than the limit")
+
+	s = gmitxt.NewScanner(iotest.OneByteReader(strings.NewReader(input)))
+	s.Limits(0, int64(len(input)-1))
+	expectLine(t, s, 1, gmitxt.Head1, "One")
+	expectEndContext(context.Background(), t, s, 1, gmitxt.ErrTooManyBytes)
+	expectEndContext(context.Background(), t, s, 1, gmitxt.ErrTooManyBytes)
+}
+
+func TestLineFlagHas(t *testing.T) {
+	flags := gmitxt.Split | gmitxt.Continued
+
+	if !flags.Has(gmitxt.Split) {
+		t.Errorf("Expected flags %08b to have Split", flags)
+	}
+
+	if !flags.Has(gmitxt.Split | gmitxt.Continued) {
+		t.Errorf("Expected flags %08b to have Split and Continued", flags)
+	}
+
+	if flags.Has(gmitxt.Truncated) {
+		t.Errorf("Expected flags %08b to not have Truncated", flags)
+	}
+}
+
 func BenchmarkScanner(b *testing.B) {
 	input, err := ioutil.ReadFile(example)
 	if err != nil {
@@ -245,3 +601,138 @@ func expectLink(t *testing.T, s *gmitxt.Scanner, num uint32, url, text string) {
 			s.Line().Num, []byte(text), s.Line().Text)
 	}
 }
+
+func expectFlags(t *testing.T, s *gmitxt.Scanner, flags gmitxt.LineFlag) {
+	if s.Line().Flags != flags {
+		t.Errorf("Line %d: flags were expected to be %08b, got: %08b",
+			s.Line().Num, flags, s.Line().Flags)
+	}
+}
+
+func expectFragment(
+	t *testing.T,
+	s *gmitxt.Scanner,
+	num uint32,
+	typ gmitxt.LineType,
+	expected string,
+) {
+	s.Scan()
+
+	if s.Line().Num != num {
+		t.Errorf("Line number was expected to be %d, but got: %d",
+			num, s.Line().Num)
+	}
+
+	if s.Line().Type != typ {
+		t.Errorf("Line %d: type was not detected as %s, got: %s",
+			s.Line().Num, typ, s.Line().Type)
+	}
+
+	if !bytes.Equal(s.Line().Text, []byte(expected)) {
+		t.Errorf("Line %d: bytes do not match %x got: %x",
+			s.Line().Num, []byte(expected), s.Line().Text)
+	}
+}
+
+func expectDiagnostics(t *testing.T, got, expected []gmitxt.Diagnostic) {
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v",
+			len(expected), len(got), got)
+	}
+
+	for i := range expected {
+		if got[i].Num != expected[i].Num || got[i].Code != expected[i].Code {
+			t.Errorf("Expected diagnostic %s on line %d, got: %s on line %d",
+				expected[i].Code, expected[i].Num, got[i].Code, got[i].Num)
+		}
+
+		if got[i].Col != expected[i].Col {
+			t.Errorf("Line %d: expected diagnostic %s at col %d, got: %d",
+				got[i].Num, got[i].Code, expected[i].Col, got[i].Col)
+		}
+
+		if got[i].Message == "" {
+			t.Errorf("Line %d: diagnostic %s has no message",
+				got[i].Num, got[i].Code)
+		}
+	}
+}
+
+func expectPreformatted(t *testing.T, s *gmitxt.Scanner, pre bool) {
+	if s.InPreformatted() != pre {
+		t.Errorf("Line %d: in preformatted text was expected to be %t",
+			s.Line().Num, pre)
+	}
+}
+
+// readerFunc is an io.Reader implemented by a function.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func expectLineContext(
+	ctx context.Context,
+	t *testing.T,
+	s *gmitxt.Scanner,
+	num uint32,
+	typ gmitxt.LineType,
+	expected string,
+) {
+	if !s.ScanContext(ctx) {
+		t.Errorf("Line %d: scanner stopped with error: %v",
+			s.Line().Num, s.Err())
+	}
+
+	if s.Line().Num != num {
+		t.Errorf("Line number was expected to be %d, but got: %d",
+			num, s.Line().Num)
+	}
+
+	if s.Line().Type != typ {
+		t.Errorf("Line %d: type was not detected as %s, got: %s",
+			s.Line().Num, typ, s.Line().Type)
+	}
+
+	if !bytes.Equal(s.Line().Text, []byte(expected)) {
+		t.Errorf("Line %d: bytes do not match %x got: %x",
+			s.Line().Num, []byte(expected), s.Line().Text)
+	}
+}
+
+func expectEndContext(
+	ctx context.Context,
+	t *testing.T,
+	s *gmitxt.Scanner,
+	num uint32,
+	expected error,
+) {
+	if s.ScanContext(ctx) {
+		t.Errorf("Line %d: scanner should have stopped", s.Line().Num)
+	}
+
+	if s.Line().Num != num {
+		t.Errorf("Line number was expected to be %d, but got: %d",
+			num, s.Line().Num)
+	}
+
+	if !errors.Is(s.Err(), expected) {
+		t.Errorf("Line %d: scanner should have error `%v`, got: %v",
+			s.Line().Num, expected, s.Err())
+	}
+
+	if len(s.Line().Text) != 0 {
+		t.Errorf("Line %d: end text should be an empty string, got: `%s`",
+			s.Line().Num, s.Line().Text)
+	}
+}
+
+func expectBytes(t *testing.T, s *gmitxt.Scanner, expected string) {
+	s.Scan()
+
+	if !bytes.Equal(s.Bytes(), []byte(expected)) {
+		t.Errorf("Line %d: line bytes do not match %q got: %q",
+			s.Line().Num, expected, s.Bytes())
+	}
+}
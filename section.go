@@ -0,0 +1,117 @@
+package gmitxt
+
+import (
+	"fmt"
+	"io"
+)
+
+// Section is a section of Gemini text.  Each heading starts a section that
+// owns the lines until the next heading of the same or a higher level, which
+// are its lines and the subsections of lower level headings.
+type Section struct {
+	// Heading is the heading line of the section.  It is the zero Line for
+	// the root section returned by Sections.
+	Heading Line
+	// Level is the level of the heading, from 1 to 3, or 0 for the root
+	// section.
+	Level int
+	// Lines are the lines of the section after its heading and before its
+	// first subsection.
+	Lines []Line
+	// Sections are the subsections of the section, in order.
+	Sections []*Section
+}
+
+// Sections reads Gemini text from r and returns its sections as a tree.  The
+// returned root section has the lines before the first heading, and the
+// sections of the headings as subsections.  A heading is a subsection of the
+// closest heading before it with a higher level, so a level 3 heading after a
+// level 1 heading is one of its subsections.  The lines are copied, so they
+// can be kept after scanning.
+func Sections(r io.Reader) (*Section, error) {
+	s := NewScanner(r)
+	root := &Section{}
+	stack := []*Section{root} // open sections, from the root to the last
+
+	for s.Scan() {
+		line := copyLine(s.Line())
+		level := 0
+
+		switch line.Type {
+		case Head1, Head2, Head3:
+			level = int(line.Type-Head1) + 1
+		case Text, Link, PreStart, PreBody, PreEnd, List, Quote:
+			top := stack[len(stack)-1]
+			top.Lines = append(top.Lines, line)
+
+			continue
+		}
+
+		for stack[len(stack)-1].Level >= level {
+			stack = stack[:len(stack)-1]
+		}
+
+		sec := &Section{Heading: line, Level: level}
+		top := stack[len(stack)-1]
+		top.Sections = append(top.Sections, sec)
+		stack = append(stack, sec)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("problem reading Gemini text: %w", err)
+	}
+
+	return root, nil
+}
+
+// copyLine returns a copy of the line that does not share the data of the
+// scanner.
+func copyLine(line Line) Line {
+	line.Text = append([]byte(nil), line.Text...)
+
+	if line.URL != nil {
+		line.URL = append([]byte(nil), line.URL...)
+	}
+
+	return line
+}
+
+// Title returns the text of the heading of the section.
+func (sec *Section) Title() string {
+	return string(sec.Heading.Text)
+}
+
+// AllLines returns all the lines of the section in order: its heading, its
+// lines and the lines of its subsections.  The root section has no heading.
+func (sec *Section) AllLines() []Line {
+	var lines []Line
+
+	if sec.Level != 0 {
+		lines = append(lines, sec.Heading)
+	}
+
+	lines = append(lines, sec.Lines...)
+
+	for _, sub := range sec.Sections {
+		lines = append(lines, sub.AllLines()...)
+	}
+
+	return lines
+}
+
+// Find returns the first section, in the order of the text, for which match
+// returns true.  The section itself is checked first, then its subsections.
+// It returns nil if no section matches.
+func (sec *Section) Find(match func(*Section) bool) *Section {
+	if match(sec) {
+		return sec
+	}
+
+	for _, sub := range sec.Sections {
+		if found := sub.Find(match); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
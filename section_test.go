@@ -0,0 +1,104 @@
+package gmitxt_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+func TestSections(t *testing.T) {
+	text := "Intro\n" +
+		"# One\n" +
+		"one text\n" +
+		"### One deep\n" +
+		"=> /deep Deep\n" +
+		"## One sub\n" +
+		"```\n" +
+		"# not a heading\n" +
+		"```\n" +
+		"# Two\n" +
+		"## Two sub\n" +
+		"* item\n"
+
+	root, err := gmitxt.Sections(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if root.Level != 0 || root.Title() != "" || len(root.Lines) != 1 ||
+		string(root.Lines[0].Text) != "Intro" || len(root.Sections) != 2 {
+		t.Fatalf("Expected root with intro and 2 sections, got: %+v", root)
+	}
+
+	one, two := root.Sections[0], root.Sections[1]
+
+	if one.Title() != "One" || one.Level != 1 || len(one.Lines) != 1 ||
+		len(one.Sections) != 2 {
+		t.Errorf("Expected section One with 2 subsections, got: %+v", one)
+	}
+
+	if deep := one.Sections[0]; deep.Title() != "One deep" ||
+		deep.Level != 3 || string(deep.Lines[0].URL) != "/deep" {
+		t.Errorf("Expected section One deep, got: %+v", deep)
+	}
+
+	if sub := one.Sections[1]; sub.Title() != "One sub" ||
+		len(sub.Lines) != 3 || len(sub.Sections) != 0 {
+		t.Errorf("Expected section One sub with 3 lines, got: %+v", sub)
+	}
+
+	if two.Title() != "Two" || len(two.Lines) != 0 ||
+		len(two.Sections) != 1 || two.Sections[0].Lines[0].Num != 12 {
+		t.Errorf("Expected section Two with a subsection, got: %+v", two)
+	}
+
+	lines := root.AllLines()
+	if len(lines) != 12 {
+		t.Fatalf("Expected 12 lines, got %d", len(lines))
+	}
+
+	for i, line := range lines {
+		if line.Num != uint32(i+1) {
+			t.Errorf("Expected line %d, got line %d", i+1, line.Num)
+		}
+	}
+
+	if lines := one.AllLines(); len(lines) != 8 ||
+		string(lines[7].Text) != "" || lines[7].Type != gmitxt.PreEnd {
+		t.Errorf("Expected lines 2 to 9 for section One, got: %+v", lines)
+	}
+}
+
+func TestSectionFind(t *testing.T) {
+	root, err := gmitxt.Sections(strings.NewReader(
+		"# A\n## B\n### C\n# D\n### C\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found := root.Find(func(sec *gmitxt.Section) bool {
+		return sec.Title() == "C"
+	})
+	if found == nil || found.Heading.Num != 3 {
+		t.Errorf("Expected the first section C, got: %+v", found)
+	}
+
+	found = root.Find(func(sec *gmitxt.Section) bool {
+		return sec.Title() == "E"
+	})
+	if found != nil {
+		t.Errorf("Expected no section, got: %+v", found)
+	}
+}
+
+func TestSectionsErrors(t *testing.T) {
+	r := iotest.TimeoutReader(strings.NewReader("# Heading"))
+
+	_, err := gmitxt.Sections(r)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("Expected error `%v`, got: %v", iotest.ErrTimeout, err)
+	}
+}
@@ -0,0 +1,52 @@
+package gmitxt
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrTooManyLines is returned by a Scanner when the text has more lines
+	// than its line limit.
+	ErrTooManyLines = errors.New("too many lines")
+	// ErrTooManyBytes is returned by a Scanner when the text has more bytes
+	// than its byte limit.
+	ErrTooManyBytes = errors.New("too many bytes")
+)
+
+// source is the reader scanned by a Scanner.  It stops reading when a context
+// is done or when more bytes than the byte limit are read.
+type source struct {
+	r   io.Reader
+	ctx context.Context // context to check before reading, can be nil
+	max int64           // maximum number of bytes to read, 0 for no limit
+	n   int64           // number of bytes read
+	err error           // error returned for a done context or the limit
+}
+
+func (src *source) Read(p []byte) (int, error) {
+	if src.ctx != nil {
+		if err := src.ctx.Err(); err != nil {
+			src.err = err
+
+			return 0, err
+		}
+	}
+
+	if src.max > 0 && int64(len(p)) > src.max-src.n {
+		// Read one byte more than the limit to tell if it is exceeded.
+		p = p[:src.max-src.n+1]
+	}
+
+	n, err := src.r.Read(p)
+	src.n += int64(n)
+
+	if src.max > 0 && src.n > src.max {
+		src.err = ErrTooManyBytes
+
+		return n - int(src.n-src.max), src.err
+	}
+
+	return n, err
+}
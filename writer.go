@@ -0,0 +1,107 @@
+package gmitxt
+
+import (
+	"bufio"
+	"io"
+)
+
+// Writer writes lines of Gemini text.  Each line is written in its canonical
+// form with a single space after the heading, link and list tokens, and a LF
+// (\n UNIX format) new line.  Lines that were split by a Scanner are joined
+// back into a single line.
+//
+// As returned by NewWriter, a Writer writes lines with a buffer.  The client
+// should call the Flush method to guarantee all data has been forwarded to
+// the underlying io.Writer.  Any errors that occurred should be checked by
+// calling the Error method.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a new Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes a single line of Gemini text.  The text of PreEnd lines is not
+// written, as it should be ignored.  A line flagged as Split is written without
+// a new line, and a line flagged as Continued is written without its line type
+// token, so the fragments of a split line are written as one line.  If there
+// was an error, it is returned and can also be retrieved by the Error method.
+func (w *Writer) Write(line Line) error {
+	if !line.Flags.Has(Continued) {
+		w.writeToken(line)
+	}
+
+	if line.Type != PreEnd {
+		w.w.Write(line.Text) // nolint: errcheck // checked by Error
+	}
+
+	if !line.Flags.Has(Split) {
+		w.w.WriteByte('\n') // nolint: errcheck // checked by Error
+	}
+
+	return w.Error()
+}
+
+// writeToken writes the token that starts a line of the given type.  A link is
+// written with its URL and the space before its text, and a link without a URL
+// is written as its token alone, without trailing whitespace.  The token of an
+// empty list item keeps its space, as the line would be text without it.
+func (w *Writer) writeToken(line Line) {
+	var token string
+
+	switch line.Type {
+	case Head1:
+		token = tokHead1
+	case Head2:
+		token = tokHead2
+	case Head3:
+		token = tokHead3
+	case Link:
+		w.w.WriteString(tokLink) // nolint: errcheck // checked by Error
+
+		if len(line.URL) != 0 {
+			w.w.WriteByte(' ')  // nolint: errcheck // checked by Error
+			w.w.Write(line.URL) // nolint: errcheck // checked by Error
+		}
+
+		if len(line.Text) != 0 {
+			w.w.WriteByte(' ') // nolint: errcheck // checked by Error
+		}
+
+		return
+	case PreStart, PreEnd:
+		token = tokPre
+	case List:
+		token = tokList
+	case Quote:
+		token = tokQuote
+	case Text, PreBody:
+		return
+	}
+
+	w.w.WriteString(token) // nolint: errcheck // checked by Error
+
+	if len(line.Text) != 0 && isHeading(line.Type) {
+		w.w.WriteByte(' ') // nolint: errcheck // checked by Error
+	}
+}
+
+// isHeading returns whether the line type is a heading of any level.
+func isHeading(typ LineType) bool {
+	return typ == Head1 || typ == Head2 || typ == Head3
+}
+
+// Flush writes any buffered data to the underlying io.Writer.  To check if an
+// error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.w.Flush() // nolint: errcheck // checked by Error
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+
+	return err // nolint: wrapcheck // error from the underlying io.Writer
+}
@@ -0,0 +1,94 @@
+package gmitxt_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"git.sr.ht/~kiba/gmitxt"
+)
+
+func TestWriter(t *testing.T) {
+	lines := []gmitxt.Line{
+		{Type: gmitxt.Head1, Text: []byte("Heading 1")},
+		{Type: gmitxt.Head2, Text: []byte("Heading 2")},
+		{Type: gmitxt.Head3, Text: []byte("Heading 3")},
+		{Type: gmitxt.Head1},
+		{Type: gmitxt.Text, Text: []byte("Text")},
+		{Type: gmitxt.Text},
+		{Type: gmitxt.List, Text: []byte("List")},
+		{Type: gmitxt.List},
+		{Type: gmitxt.Quote, Text: []byte(" Quote")},
+		{Type: gmitxt.Link, URL: []byte("gemini://example.tld/")},
+		{Type: gmitxt.Link, URL: []byte("foo.gmi"), Text: []byte("Foo")},
+		{Type: gmitxt.PreStart, Text: []byte("go")},
+		{Type: gmitxt.PreBody, Text: []byte("\tfmt.Println(\"hello\")  ")},
+		{Type: gmitxt.PreEnd, Text: []byte("ignored")},
+		{Type: gmitxt.Link, URL: []byte("gemini://exam"), Flags: gmitxt.Split},
+		{
+			Type:  gmitxt.Link,
+			Text:  []byte("ple.tld/ long li"),
+			Flags: gmitxt.Split | gmitxt.Continued,
+		},
+		{Type: gmitxt.Link, Text: []byte("nk"), Flags: gmitxt.Continued},
+	}
+
+	expected := `# Heading 1
+## Heading 2
+### Heading 3
+#
+Text
+
+* List
+* 
+> Quote
+=> gemini://example.tld/
+=> foo.gmi Foo
+` + "```go\n\tfmt.Println(\"hello\")  \n```\n" + `=> gemini://example.tld/ long link
+`
+
+	var buf bytes.Buffer
+
+	w := gmitxt.NewWriter(&buf)
+	for _, line := range lines {
+		if err := w.Write(line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	w.Flush()
+
+	if w.Error() != nil {
+		t.Errorf("unexpected error: %v", w.Error())
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected written text:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	t.Log("writing with an error")
+
+	w = gmitxt.NewWriter(errWriter{})
+	if err := w.Write(lines[0]); err != nil {
+		t.Fatalf("unexpected error before flushing: %v", err)
+	}
+
+	w.Flush()
+
+	if !errors.Is(w.Error(), errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, w.Error())
+	}
+
+	if err := w.Write(lines[0]); !errors.Is(err, errWrite) {
+		t.Errorf("Expected error `%v`, got: %v", errWrite, err)
+	}
+}
+
+var errWrite = errors.New("write error")
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}